@@ -0,0 +1,140 @@
+// Command export downloads every suggestion from a running autocomplete
+// server through its admin export endpoint, as JSON Lines or CSV.
+//
+//	export -out backup.jsonl -prefix app -category tech
+//
+// The output can be loaded back with the import command.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
+)
+
+func main() {
+	var (
+		out      = flag.String("out", "-", "File to write, - for standard output")
+		format   = flag.String("format", "", "csv or jsonl (default: from the file extension, else jsonl)")
+		prefix   = flag.String("prefix", "", "Only export terms starting with this prefix")
+		category = flag.String("category", "", "Only export suggestions in this category")
+		addr     = flag.String("addr", getEnvString("AUTOCOMPLETE_URL", "http://localhost:8080"), "Server base URL")
+		apiKey   = flag.String("api-key", os.Getenv("API_KEY"), "Admin API key")
+	)
+	flag.Parse()
+
+	exportFormat, err := resolveFormat(*out, *format)
+	if err != nil {
+		fail(err)
+	}
+
+	body, err := download(*addr, *apiKey, exportFormat, *prefix, *category)
+	if err != nil {
+		fail(err)
+	}
+	defer body.Close()
+
+	if *out == "-" {
+		if _, err := io.Copy(os.Stdout, body); err != nil {
+			fail(err)
+		}
+		return
+	}
+
+	if err := writeFile(*out, body); err != nil {
+		fail(err)
+	}
+}
+
+// download requests the export and returns the response body
+func download(addr, apiKey string, format importer.Format, prefix, category string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("format", string(format))
+	if prefix != "" {
+		query.Set("prefix", prefix)
+	}
+	if category != "" {
+		query.Set("category", category)
+	}
+	endpoint := strings.TrimRight(addr, "/") + "/api/v1/admin/suggestions/export?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return nil, fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// resolveFormat uses the explicit format if given, else the file extension,
+// falling back to JSON Lines
+func resolveFormat(out, format string) (importer.Format, error) {
+	if format == "" && out != "-" {
+		if fromPath, err := importer.FormatFromPath(out); err == nil {
+			format = string(fromPath)
+		}
+	}
+	if format == "" {
+		return importer.FormatJSONL, nil
+	}
+
+	parsed, err := importer.ParseFormat(format)
+	if err != nil {
+		return "", err
+	}
+	if parsed != importer.FormatJSONL && parsed != importer.FormatCSV {
+		return "", fmt.Errorf("export format must be csv or jsonl, got %q", format)
+	}
+	return parsed, nil
+}
+
+// writeFile writes next to the destination first and renames into place,
+// so a failed export never truncates an earlier backup
+func writeFile(path string, body io.Reader) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "export:", err)
+	os.Exit(2)
+}
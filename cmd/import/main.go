@@ -0,0 +1,171 @@
+// Command import loads a CSV, TSV or JSON Lines file of suggestions into a
+// running autocomplete server through its admin import endpoint.
+//
+//	import -file corpus.csv -mode replace -dry-run
+//
+// With -validate the file is only checked locally and no server is needed.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
+)
+
+func main() {
+	var (
+		file     = flag.String("file", "", "File to import, - for standard input")
+		format   = flag.String("format", "", "csv, tsv or jsonl (default: from the file extension)")
+		mode     = flag.String("mode", string(importer.ModeUpsert), "upsert keeps terms missing from the file, replace deletes them")
+		dryRun   = flag.Bool("dry-run", false, "Report what would change without changing anything")
+		validate = flag.Bool("validate", false, "Only validate the file locally, without contacting the server")
+		rebuild  = flag.Bool("rebuild", false, "Build a new index from the file and swap it in whole, instead of importing into the live one")
+		addr     = flag.String("addr", getEnvString("AUTOCOMPLETE_URL", "http://localhost:8080"), "Server base URL")
+		apiKey   = flag.String("api-key", os.Getenv("API_KEY"), "Admin API key")
+	)
+	flag.Parse()
+
+	if *file == "" {
+		fmt.Fprintln(os.Stderr, "import: -file is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	importFormat, err := resolveFormat(*file, *format)
+	if err != nil {
+		fail(err)
+	}
+	importMode, err := importer.ParseMode(*mode)
+	if err != nil {
+		fail(err)
+	}
+	if *rebuild && *dryRun {
+		fail(fmt.Errorf("-rebuild can't be combined with -dry-run; use -validate to check the file"))
+	}
+
+	input := os.Stdin
+	if *file != "-" {
+		if input, err = os.Open(*file); err != nil {
+			fail(err)
+		}
+		defer input.Close()
+	}
+
+	var report *importer.Report
+	if *validate {
+		imp := importer.New(nil, importer.Options{Format: importFormat, Mode: importMode})
+		report, err = imp.Import(context.Background(), input)
+	} else if *rebuild {
+		report, err = uploadRebuild(*addr, *apiKey, input, importFormat)
+	} else {
+		report, err = upload(*addr, *apiKey, input, importFormat, importMode, *dryRun)
+	}
+	if err != nil {
+		fail(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(report); err != nil {
+		fail(err)
+	}
+
+	if report.Invalid > 0 {
+		os.Exit(1)
+	}
+}
+
+// upload streams the file to the server's import endpoint
+func upload(addr, apiKey string, body io.Reader, format importer.Format, mode importer.Mode, dryRun bool) (*importer.Report, error) {
+	query := url.Values{}
+	query.Set("format", string(format))
+	query.Set("mode", string(mode))
+	query.Set("dry_run", strconv.FormatBool(dryRun))
+
+	var report importer.Report
+	if err := post(addr, "/api/v1/admin/suggestions/import", apiKey, query, body, format, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// uploadRebuild streams the file to the server's index rebuild endpoint
+func uploadRebuild(addr, apiKey string, body io.Reader, format importer.Format) (*importer.Report, error) {
+	query := url.Values{}
+	query.Set("source", "import")
+	query.Set("format", string(format))
+
+	var response struct {
+		Import *importer.Report `json:"import"`
+	}
+	if err := post(addr, "/api/v1/admin/index/rebuild", apiKey, query, body, format, &response); err != nil {
+		return nil, err
+	}
+	if response.Import == nil {
+		return nil, fmt.Errorf("invalid response: no import report")
+	}
+	return response.Import, nil
+}
+
+// post streams the file to an admin endpoint and decodes the JSON response
+func post(addr, path, apiKey string, query url.Values, body io.Reader, format importer.Format, response any) error {
+	endpoint := strings.TrimRight(addr, "/") + path + "?" + query.Encode()
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", format.ContentType())
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("server returned %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("invalid response: %w", err)
+	}
+	return nil
+}
+
+// resolveFormat uses the explicit format if given, else the file extension
+func resolveFormat(file, format string) (importer.Format, error) {
+	if format != "" {
+		return importer.ParseFormat(format)
+	}
+	if file == "-" {
+		return "", fmt.Errorf("-format is required when reading standard input")
+	}
+	return importer.FormatFromPath(file)
+}
+
+func getEnvString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "import:", err)
+	os.Exit(2)
+}
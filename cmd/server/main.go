@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,8 +17,12 @@ import (
 	"github.com/alexnthnz/search-autocomplete/internal/api"
 	"github.com/alexnthnz/search-autocomplete/internal/cache"
 	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/internal/personalization"
 	"github.com/alexnthnz/search-autocomplete/internal/pipeline"
+	"github.com/alexnthnz/search-autocomplete/internal/ranking"
 	"github.com/alexnthnz/search-autocomplete/internal/service"
+	"github.com/alexnthnz/search-autocomplete/internal/trending"
 )
 
 func main() {
@@ -43,23 +49,62 @@ func main() {
 
 	// Initialize cache
 	var cacheInstance cache.Cache
+	var invalidationBus cache.InvalidationBus
 	if config.CacheEnabled {
 		if config.RedisEnabled {
 			redisConfig := cache.Config{
-				Host:     config.RedisHost,
-				Port:     config.RedisPort,
-				Password: config.RedisPassword,
-				DB:       config.RedisDB,
-				TTL:      config.CacheTTL,
+				Host:      config.RedisHost,
+				Port:      config.RedisPort,
+				Password:  config.RedisPassword,
+				DB:        config.RedisDB,
+				TTL:       config.CacheTTL,
+				Namespace: config.CacheNamespace,
+			}
+			redisCache := cache.NewRedisCache(redisConfig, logger, sharedMetrics)
+
+			// Share invalidations so other instances don't serve stale results
+			if config.CacheInvalidationEnabled {
+				channel := config.CacheInvalidationChannel
+				if channel == "" {
+					channel = redisCache.InvalidationChannel()
+				}
+				bus, err := cache.NewRedisBus(redisCache.Client(), channel, logger, sharedMetrics)
+				if err != nil {
+					logger.WithError(err).Fatal("Failed to subscribe to cache invalidations")
+				}
+				defer bus.Close()
+				invalidationBus = bus
+			}
+
+			if config.CacheL1Enabled {
+				l1 := cache.NewInMemoryCache(cache.MemoryConfig{
+					Name:       "l1",
+					TTL:        config.CacheL1TTL,
+					MaxEntries: config.CacheL1MaxEntries,
+					MaxBytes:   int64(config.CacheMaxBytes),
+				}, logger, sharedMetrics)
+				cacheInstance = cache.NewTieredCache(l1, redisCache, logger, sharedMetrics)
+				logger.Info("Using in-memory L1 cache in front of Redis")
+			} else {
+				cacheInstance = redisCache
+				logger.Info("Using Redis cache")
 			}
-			cacheInstance = cache.NewRedisCache(redisConfig, logger, sharedMetrics)
-			logger.Info("Using Redis cache")
 		} else {
-			cacheInstance = cache.NewInMemoryCache(config.CacheTTL, logger, sharedMetrics)
+			cacheInstance = cache.NewInMemoryCache(cache.MemoryConfig{
+				TTL:        config.CacheTTL,
+				MaxEntries: config.CacheMaxEntries,
+				MaxBytes:   int64(config.CacheMaxBytes),
+			}, logger, sharedMetrics)
 			logger.Info("Using in-memory cache")
 		}
 	}
 
+	// Ranking stages are configured per deployment
+	categoryWeights, err := ranking.ParseWeights(config.RankingCategoryWeights)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid RANKING_CATEGORY_WEIGHTS")
+	}
+
 	// Initialize autocomplete service
 	serviceConfig := service.Config{
 		MaxSuggestions:  config.MaxSuggestions,
@@ -67,31 +112,143 @@ func main() {
 		FuzzyThreshold:  config.FuzzyThreshold,
 		CacheEnabled:    config.CacheEnabled,
 		PersonalizedRec: config.PersonalizedRec,
+		IndexType:       config.IndexType,
+		ScoreHalfLife:   config.ScoreHalfLife,
+		Ranking: ranking.Config{
+			Stages:          ranking.ParseStages(config.RankingStages),
+			CategoryWeights: categoryWeights,
+			RecencyHalfLife: config.RankingRecencyHalfLife,
+		},
+		Personalization: personalization.Config{
+			MaxProfiles: config.PersonalizationMaxProfiles,
+			MaxTerms:    config.PersonalizationMaxTerms,
+			TTL:         config.PersonalizationTTL,
+			HalfLife:    config.PersonalizationHalfLife,
+		},
+		Trending: trending.Config{
+			Window:     config.TrendingWindow,
+			Baseline:   config.TrendingBaseline,
+			HalfLife:   config.TrendingHalfLife,
+			MaxQueries: config.TrendingMaxQueries,
+		},
+	}
+
+	// Rebuilt indexes are snapshotted as soon as they're swapped in
+	snapshotPath := filepath.Join(config.DataDir, "index.snapshot")
+	if config.SnapshotEnabled {
+		serviceConfig.SnapshotPath = snapshotPath
 	}
 
 	autocompleteService := service.NewAutocompleteService(serviceConfig, cacheInstance, logger, sharedMetrics)
+	if invalidationBus != nil {
+		autocompleteService.AttachInvalidationBus(invalidationBus)
+	}
+
+	// Restore the index from the last snapshot, seeding sample data on first boot
+	restored := false
+	if config.SnapshotEnabled {
+		if _, err := autocompleteService.LoadSnapshot(snapshotPath); err == nil {
+			restored = true
+		} else if !os.IsNotExist(err) {
+			logger.WithError(err).Error("Failed to restore index snapshot")
+		}
+	}
+
+	// Replay mutations made since the snapshot and log every later one
+	if config.SnapshotEnabled && config.WALEnabled {
+		wal, err := persistence.OpenWAL(persistence.WALConfig{
+			Dir:          filepath.Join(config.DataDir, "wal"),
+			SyncPolicy:   persistence.SyncPolicy(config.WALSyncPolicy),
+			SyncInterval: config.WALSyncInterval,
+		}, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to open write-ahead log")
+		}
+		defer wal.Close()
+
+		replayed, err := autocompleteService.AttachWAL(wal)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to replay write-ahead log")
+		}
+		restored = restored || replayed > 0
+	}
 
-	// Load sample data
-	autocompleteService.LoadSampleData()
+	if !restored {
+		autocompleteService.LoadSampleData()
+	}
 
 	// Initialize data pipeline
 	pipelineConfig := pipeline.Config{
 		BatchSize:     config.PipelineBatchSize,
 		FlushInterval: config.PipelineFlushInterval,
 		QueueSize:     config.PipelineQueueSize,
+		TrendInterval: config.TrendingInterval,
+
+		MaxLag:              config.PipelineMaxLag,
+		BackpressureTimeout: config.PipelineBackpressureTimeout,
 	}
 
 	dataPipeline := pipeline.NewDataPipeline(autocompleteService, pipelineConfig, logger, sharedMetrics)
 
-	// Start data pipeline
+	// Make search logs durable. A fresh index is rebuilt from all retained
+	// history; a restored one already counts the searches logged before its
+	// snapshot, so the pipeline resumes where it left off.
+	historyLogged := false
+	if config.QueryLogEnabled {
+		queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{
+			Dir:          filepath.Join(config.DataDir, "querylog"),
+			SegmentBytes: config.QueryLogSegmentBytes,
+			Retention:    config.QueryLogRetention,
+			SyncPolicy:   persistence.SyncPolicy(config.WALSyncPolicy),
+			SyncInterval: config.WALSyncInterval,
+		}, logger)
+		if err != nil {
+			logger.WithError(err).Fatal("Failed to open query log")
+		}
+		defer queryLog.Close()
+
+		if err := dataPipeline.AttachQueryLog(queryLog, !restored); err != nil {
+			logger.WithError(err).Fatal("Failed to attach query log")
+		}
+		historyLogged = queryLog.LastOffset() > 0
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Snapshots are stopped after the pipeline so the final one includes its last flush
+	if config.SnapshotEnabled {
+		snapshotter := persistence.NewSnapshotter(autocompleteService, persistence.Config{
+			Path:     snapshotPath,
+			Interval: config.SnapshotInterval,
+		}, logger, sharedMetrics)
+		snapshotter.Start(ctx)
+		defer snapshotter.Stop()
+	}
+
+	// Start data pipeline
 	dataPipeline.Start(ctx)
 	defer dataPipeline.Stop()
 
-	// Load historical data for testing
-	go dataPipeline.LoadHistoricalData()
+	// Seed a fresh index with no logged history from historical search logs,
+	// or from simulated history for testing when there are none
+	if !restored && !historyLogged {
+		if config.BackfillDir != "" {
+			go func() {
+				_, err := dataPipeline.Backfill(ctx, pipeline.BackfillConfig{
+					Dir:        config.BackfillDir,
+					Pattern:    config.BackfillPattern,
+					Path:       config.BackfillPath,
+					QueryParam: config.BackfillQueryParam,
+				})
+				if err != nil {
+					logger.WithError(err).Error("Historical log backfill failed")
+				}
+			}()
+		} else {
+			go dataPipeline.LoadHistoricalData()
+		}
+	}
 
 	// Initialize API handler and router
 	apiHandler := api.NewHandler(autocompleteService, dataPipeline, logger, sharedMetrics)
@@ -137,53 +294,127 @@ func main() {
 
 // Config holds application configuration
 type Config struct {
-	Port                  int
-	APIKey                string
-	EnableCORS            bool
-	LogLevel              string
-	ReadTimeout           time.Duration
-	WriteTimeout          time.Duration
-	IdleTimeout           time.Duration
-	MaxSuggestions        int
-	EnableFuzzy           bool
-	FuzzyThreshold        int
-	PersonalizedRec       bool
-	CacheEnabled          bool
-	CacheTTL              time.Duration
-	RedisEnabled          bool
-	RedisHost             string
-	RedisPort             int
-	RedisPassword         string
-	RedisDB               int
-	PipelineBatchSize     int
-	PipelineFlushInterval time.Duration
-	PipelineQueueSize     int
+	Port                        int
+	APIKey                      string
+	EnableCORS                  bool
+	LogLevel                    string
+	ReadTimeout                 time.Duration
+	WriteTimeout                time.Duration
+	IdleTimeout                 time.Duration
+	MaxSuggestions              int
+	EnableFuzzy                 bool
+	FuzzyThreshold              int
+	PersonalizedRec             bool
+	PersonalizationMaxProfiles  int
+	PersonalizationMaxTerms     int
+	PersonalizationTTL          time.Duration
+	PersonalizationHalfLife     time.Duration
+	IndexType                   string
+	ScoreHalfLife               time.Duration
+	RankingStages               string
+	RankingCategoryWeights      string
+	RankingRecencyHalfLife      time.Duration
+	CacheEnabled                bool
+	CacheTTL                    time.Duration
+	CacheNamespace              string
+	CacheMaxEntries             int
+	CacheMaxBytes               int
+	CacheL1Enabled              bool
+	CacheL1TTL                  time.Duration
+	CacheL1MaxEntries           int
+	CacheInvalidationEnabled    bool
+	CacheInvalidationChannel    string
+	RedisEnabled                bool
+	RedisHost                   string
+	RedisPort                   int
+	RedisPassword               string
+	RedisDB                     int
+	PipelineBatchSize           int
+	PipelineFlushInterval       time.Duration
+	PipelineQueueSize           int
+	TrendingInterval            time.Duration
+	TrendingWindow              time.Duration
+	TrendingBaseline            time.Duration
+	TrendingHalfLife            time.Duration
+	TrendingMaxQueries          int
+	DataDir                     string
+	SnapshotEnabled             bool
+	SnapshotInterval            time.Duration
+	WALEnabled                  bool
+	WALSyncPolicy               string
+	WALSyncInterval             time.Duration
+	QueryLogEnabled             bool
+	QueryLogSegmentBytes        int64
+	QueryLogRetention           time.Duration
+	PipelineMaxLag              int
+	PipelineBackpressureTimeout time.Duration
+	BackfillDir                 string
+	BackfillPattern             string
+	BackfillPath                string
+	BackfillQueryParam          string
 }
 
 // loadConfig loads configuration from environment variables with defaults
 func loadConfig() Config {
 	config := Config{
-		Port:                  8080,
-		APIKey:                os.Getenv("API_KEY"),
-		EnableCORS:            getEnvBool("ENABLE_CORS", true),
-		LogLevel:              getEnvString("LOG_LEVEL", "info"),
-		ReadTimeout:           getEnvDuration("READ_TIMEOUT", 10*time.Second),
-		WriteTimeout:          getEnvDuration("WRITE_TIMEOUT", 10*time.Second),
-		IdleTimeout:           getEnvDuration("IDLE_TIMEOUT", 60*time.Second),
-		MaxSuggestions:        getEnvInt("MAX_SUGGESTIONS", 10),
-		EnableFuzzy:           getEnvBool("ENABLE_FUZZY", true),
-		FuzzyThreshold:        getEnvInt("FUZZY_THRESHOLD", 2),
-		PersonalizedRec:       getEnvBool("PERSONALIZED_REC", false),
-		CacheEnabled:          getEnvBool("CACHE_ENABLED", true),
-		CacheTTL:              getEnvDuration("CACHE_TTL", 5*time.Minute),
-		RedisEnabled:          getEnvBool("REDIS_ENABLED", false),
-		RedisHost:             getEnvString("REDIS_HOST", "localhost"),
-		RedisPort:             getEnvInt("REDIS_PORT", 6379),
-		RedisPassword:         os.Getenv("REDIS_PASSWORD"),
-		RedisDB:               getEnvInt("REDIS_DB", 0),
-		PipelineBatchSize:     getEnvInt("PIPELINE_BATCH_SIZE", 100),
-		PipelineFlushInterval: getEnvDuration("PIPELINE_FLUSH_INTERVAL", 30*time.Second),
-		PipelineQueueSize:     getEnvInt("PIPELINE_QUEUE_SIZE", 10000),
+		Port:                        8080,
+		APIKey:                      os.Getenv("API_KEY"),
+		EnableCORS:                  getEnvBool("ENABLE_CORS", true),
+		LogLevel:                    getEnvString("LOG_LEVEL", "info"),
+		ReadTimeout:                 getEnvDuration("READ_TIMEOUT", 10*time.Second),
+		WriteTimeout:                getEnvDuration("WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:                 getEnvDuration("IDLE_TIMEOUT", 60*time.Second),
+		MaxSuggestions:              getEnvInt("MAX_SUGGESTIONS", 10),
+		EnableFuzzy:                 getEnvBool("ENABLE_FUZZY", true),
+		FuzzyThreshold:              getEnvInt("FUZZY_THRESHOLD", 2),
+		PersonalizedRec:             getEnvBool("PERSONALIZED_REC", false),
+		PersonalizationMaxProfiles:  getEnvInt("PERSONALIZATION_MAX_PROFILES", 10000),
+		PersonalizationMaxTerms:     getEnvInt("PERSONALIZATION_MAX_TERMS", 50),
+		PersonalizationTTL:          getEnvDuration("PERSONALIZATION_TTL", 24*time.Hour),
+		PersonalizationHalfLife:     getEnvDuration("PERSONALIZATION_HALF_LIFE", 6*time.Hour),
+		IndexType:                   getEnvString("INDEX_TYPE", "trie"),
+		ScoreHalfLife:               getEnvDuration("SCORE_HALF_LIFE", 7*24*time.Hour),
+		RankingStages:               getEnvString("RANKING_STAGES", strings.Join(ranking.DefaultStages, ",")),
+		RankingCategoryWeights:      getEnvString("RANKING_CATEGORY_WEIGHTS", ""),
+		RankingRecencyHalfLife:      getEnvDuration("RANKING_RECENCY_HALF_LIFE", 7*24*time.Hour),
+		CacheEnabled:                getEnvBool("CACHE_ENABLED", true),
+		CacheTTL:                    getEnvDuration("CACHE_TTL", 5*time.Minute),
+		CacheNamespace:              os.Getenv("CACHE_NAMESPACE"),
+		CacheMaxEntries:             getEnvInt("CACHE_MAX_ENTRIES", 10000),
+		CacheMaxBytes:               getEnvInt("CACHE_MAX_BYTES", 64<<20),
+		CacheL1Enabled:              getEnvBool("CACHE_L1_ENABLED", true),
+		CacheL1TTL:                  getEnvDuration("CACHE_L1_TTL", 10*time.Second),
+		CacheL1MaxEntries:           getEnvInt("CACHE_L1_MAX_ENTRIES", 1000),
+		CacheInvalidationEnabled:    getEnvBool("CACHE_INVALIDATION_ENABLED", true),
+		CacheInvalidationChannel:    os.Getenv("CACHE_INVALIDATION_CHANNEL"),
+		RedisEnabled:                getEnvBool("REDIS_ENABLED", false),
+		RedisHost:                   getEnvString("REDIS_HOST", "localhost"),
+		RedisPort:                   getEnvInt("REDIS_PORT", 6379),
+		RedisPassword:               os.Getenv("REDIS_PASSWORD"),
+		RedisDB:                     getEnvInt("REDIS_DB", 0),
+		PipelineBatchSize:           getEnvInt("PIPELINE_BATCH_SIZE", 100),
+		PipelineFlushInterval:       getEnvDuration("PIPELINE_FLUSH_INTERVAL", 30*time.Second),
+		PipelineQueueSize:           getEnvInt("PIPELINE_QUEUE_SIZE", 10000),
+		TrendingInterval:            getEnvDuration("TRENDING_INTERVAL", time.Minute),
+		TrendingWindow:              getEnvDuration("TRENDING_WINDOW", time.Hour),
+		TrendingBaseline:            getEnvDuration("TRENDING_BASELINE", 24*time.Hour),
+		TrendingHalfLife:            getEnvDuration("TRENDING_HALF_LIFE", time.Hour),
+		TrendingMaxQueries:          getEnvInt("TRENDING_MAX_QUERIES", 1000),
+		DataDir:                     getEnvString("DATA_DIR", "data"),
+		SnapshotEnabled:             getEnvBool("SNAPSHOT_ENABLED", true),
+		SnapshotInterval:            getEnvDuration("SNAPSHOT_INTERVAL", 5*time.Minute),
+		WALEnabled:                  getEnvBool("WAL_ENABLED", true),
+		WALSyncPolicy:               getEnvString("WAL_SYNC_POLICY", "interval"),
+		WALSyncInterval:             getEnvDuration("WAL_SYNC_INTERVAL", time.Second),
+		QueryLogEnabled:             getEnvBool("QUERY_LOG_ENABLED", true),
+		QueryLogSegmentBytes:        int64(getEnvInt("QUERY_LOG_SEGMENT_BYTES", 64<<20)),
+		QueryLogRetention:           getEnvDuration("QUERY_LOG_RETENTION", 7*24*time.Hour),
+		PipelineMaxLag:              getEnvInt("PIPELINE_MAX_LAG", 100000),
+		PipelineBackpressureTimeout: getEnvDuration("PIPELINE_BACKPRESSURE_TIMEOUT", time.Second),
+		BackfillDir:                 os.Getenv("BACKFILL_DIR"),
+		BackfillPattern:             getEnvString("BACKFILL_PATTERN", "*"),
+		BackfillPath:                getEnvString("BACKFILL_PATH", "/api/v1/autocomplete"),
+		BackfillQueryParam:          getEnvString("BACKFILL_QUERY_PARAM", "q"),
 	}
 
 	// Override port if specified
@@ -241,6 +472,11 @@ func printStartupInfo(config Config, logger *logrus.Logger) {
 		"cache_enabled": config.CacheEnabled,
 		"redis_enabled": config.RedisEnabled,
 		"fuzzy_enabled": config.EnableFuzzy,
+		"index_type":    config.IndexType,
+		"snapshots":     config.SnapshotEnabled,
+		"wal":           config.SnapshotEnabled && config.WALEnabled,
+		"query_log":     config.QueryLogEnabled,
+		"backfill_dir":  config.BackfillDir,
 		"cors_enabled":  config.EnableCORS,
 		"api_key_set":   config.APIKey != "",
 	}).Info("Configuration loaded")
@@ -249,6 +485,8 @@ func printStartupInfo(config Config, logger *logrus.Logger) {
 	logger.Info(fmt.Sprintf("  • Health Check:     GET  http://localhost:%d/api/v1/health", config.Port))
 	logger.Info(fmt.Sprintf("  • Autocomplete:     GET  http://localhost:%d/api/v1/autocomplete?q=<query>", config.Port))
 	logger.Info(fmt.Sprintf("  • Autocomplete:     POST http://localhost:%d/api/v1/autocomplete", config.Port))
+	logger.Info(fmt.Sprintf("  • Selections:       POST http://localhost:%d/api/v1/autocomplete/selections", config.Port))
+	logger.Info(fmt.Sprintf("  • Trending:         GET  http://localhost:%d/api/v1/trending", config.Port))
 	logger.Info(fmt.Sprintf("  • Statistics:       GET  http://localhost:%d/api/v1/stats", config.Port))
 	logger.Info(fmt.Sprintf("  • Web Interface:    GET  http://localhost:%d/", config.Port))
 
@@ -1,6 +1,7 @@
 package api
 
 import (
+	stderrors "errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,6 +11,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 
+	"github.com/alexnthnz/search-autocomplete/internal/exporter"
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
 	"github.com/alexnthnz/search-autocomplete/internal/metrics"
 	"github.com/alexnthnz/search-autocomplete/internal/pipeline"
 	"github.com/alexnthnz/search-autocomplete/internal/service"
@@ -77,16 +80,41 @@ func (h *Handler) AutocompleteHandler(c *gin.Context) {
 	// Sanitize the query
 	query = h.validator.SanitizeQuery(query)
 
-	// Parse optional parameters
-	limit := 10 // default
+	// Parse optional parameters. Limits above the server maximum are clamped.
+	limit := 0 // service default
 	if limitStr := c.Query("limit"); limitStr != "" {
-		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 && parsed <= 50 {
+		if parsed, err := strconv.Atoi(limitStr); err == nil && parsed > 0 {
 			limit = parsed
 		}
 	}
+	limit = h.service.ClampLimit(limit)
+
+	var fuzzy *bool
+	if fuzzyStr := c.Query("fuzzy"); fuzzyStr != "" {
+		parsed, err := strconv.ParseBool(fuzzyStr)
+		if err != nil {
+			apiErr := errors.NewValidationError("Invalid fuzzy value", "Query parameter 'fuzzy' must be true or false")
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+		fuzzy = &parsed
+	}
+
+	explain := false
+	if explainStr := c.Query("explain"); explainStr != "" {
+		parsed, err := strconv.ParseBool(explainStr)
+		if err != nil {
+			apiErr := errors.NewValidationError("Invalid explain value", "Query parameter 'explain' must be true or false")
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+		explain = parsed
+	}
 
 	userID := c.Query("user_id")
 	sessionID := c.Query("session_id")
+	category := c.Query("category")
+	locale := c.Query("locale")
 
 	// Validate userID and sessionID if provided
 	if userID != "" {
@@ -105,12 +133,28 @@ func (h *Handler) AutocompleteHandler(c *gin.Context) {
 		}
 	}
 
+	if err := utils.ValidateCategory(category); err != nil {
+		apiErr := errors.NewValidationError("Invalid category", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	if err := utils.ValidateLocale(locale); err != nil {
+		apiErr := errors.NewValidationError("Invalid locale", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
 	// Create request
 	req := models.AutocompleteRequest{
 		Query:     query,
 		Limit:     limit,
 		UserID:    userID,
 		SessionID: sessionID,
+		Fuzzy:     fuzzy,
+		Explain:   explain,
+		Category:  category,
+		Locale:    locale,
 	}
 
 	// Get suggestions
@@ -173,14 +217,21 @@ func (h *Handler) AutocompletePostHandler(c *gin.Context) {
 		}
 	}
 
-	// Set default limit
-	if req.Limit <= 0 {
-		req.Limit = 10
+	if err := utils.ValidateCategory(req.Category); err != nil {
+		apiErr := errors.NewValidationError("Invalid category", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
 	}
-	if req.Limit > 50 {
-		req.Limit = 50
+
+	if err := utils.ValidateLocale(req.Locale); err != nil {
+		apiErr := errors.NewValidationError("Invalid locale", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
 	}
 
+	// Apply the default limit and the server maximum
+	req.Limit = h.service.ClampLimit(req.Limit)
+
 	// Get suggestions
 	response, err := h.service.GetSuggestions(c.Request.Context(), req)
 	if err != nil {
@@ -197,6 +248,83 @@ func (h *Handler) AutocompletePostHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// SelectionHandler records a suggestion the user picked from an autocomplete
+// response
+func (h *Handler) SelectionHandler(c *gin.Context) {
+	// Rate limiting
+	if !h.rateLimiter.Allow() {
+		apiErr := errors.NewRateLimitError()
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	var selection models.SelectionLog
+	if err := c.ShouldBindJSON(&selection); err != nil {
+		apiErr := errors.NewValidationError("Invalid request body", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	if err := h.validator.ValidateQuery(selection.Query); err != nil {
+		apiErr := errors.NewValidationError("Invalid query", err.Error())
+		h.metrics.RecordError("api", "validation_failed")
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+	selection.Query = h.validator.SanitizeQuery(selection.Query)
+
+	if err := utils.ValidateTerm(selection.Term); err != nil {
+		apiErr := errors.NewValidationError("Invalid term", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	if selection.Position < 0 {
+		apiErr := errors.NewValidationError("Invalid position", "Position must be a non-negative integer")
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	if err := utils.ValidateUserID(selection.UserID); err != nil {
+		apiErr := errors.NewValidationError("Invalid user ID", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	if err := utils.ValidateSessionID(selection.SessionID); err != nil {
+		apiErr := errors.NewValidationError("Invalid session ID", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	selection.Timestamp = time.Now()
+
+	// The user's own history is updated right away; frequencies and
+	// query-wide ranking are updated when the pipeline processes the batch
+	h.service.RecordSelection(selection.UserID, selection.SessionID, selection.Term)
+
+	if h.pipeline != nil {
+		if err := h.pipeline.LogSelection(selection); err != nil {
+			h.logger.WithError(err).Warn("Failed to send selection to pipeline")
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message": "Selection recorded",
+		"term":    selection.Term,
+	})
+}
+
+// TrendingHandler returns the queries currently trending
+func (h *Handler) TrendingHandler(c *gin.Context) {
+	trending := h.service.Trending().Trending()
+
+	c.JSON(http.StatusOK, gin.H{
+		"trending": trending,
+		"count":    len(trending),
+	})
+}
+
 // AddSuggestionHandler allows adding new suggestions (admin endpoint)
 func (h *Handler) AddSuggestionHandler(c *gin.Context) {
 	var suggestion models.Suggestion
@@ -285,6 +413,265 @@ func (h *Handler) BatchAddSuggestionsHandler(c *gin.Context) {
 	})
 }
 
+// ImportSuggestionsHandler streams a CSV, TSV or JSON Lines file of
+// suggestions from the request body into the index and returns a report of
+// what was imported and which rows were rejected
+func (h *Handler) ImportSuggestionsHandler(c *gin.Context) {
+	format, apiErr := importFormat(c)
+	if apiErr != nil {
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	mode, err := importer.ParseMode(c.Query("mode"))
+	if err != nil {
+		apiErr := errors.NewValidationError("Invalid mode", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			apiErr := errors.NewValidationError("Invalid dry_run value", "dry_run must be true or false")
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+	}
+
+	// Large files take longer than the server's request timeouts allow
+	controller := http.NewResponseController(c.Writer)
+	_ = controller.SetReadDeadline(time.Time{})
+	_ = controller.SetWriteDeadline(time.Time{})
+
+	imp := importer.New(h.service, importer.Options{Format: format, Mode: mode, DryRun: dryRun})
+	report, err := imp.Import(c.Request.Context(), c.Request.Body)
+	if stderrors.Is(err, importer.ErrInvalidFile) {
+		apiErr := errors.NewValidationError("Invalid import file", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+	if err != nil {
+		// Batches stored before the failure stay stored; the report says
+		// how far the import got
+		h.logger.WithError(err).WithField("rows", report.Rows).Error("Failed to import suggestions")
+		h.metrics.RecordError("api", "service_failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    errors.ErrCodeInternal,
+			"message": "Failed to import suggestions",
+			"details": "Rows before the failure were imported",
+			"import":  report,
+		})
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"format":  report.Format,
+		"mode":    report.Mode,
+		"dry_run": report.DryRun,
+		"rows":    report.Rows,
+		"invalid": report.Invalid,
+		"added":   report.Added,
+		"updated": report.Updated,
+		"removed": report.Removed,
+	}).Info("Imported suggestions")
+
+	c.JSON(http.StatusOK, report)
+}
+
+// importFormat reads an import file's format from the 'format' query
+// parameter, falling back to the Content-Type
+func importFormat(c *gin.Context) (importer.Format, *errors.APIError) {
+	if name := c.Query("format"); name != "" {
+		format, err := importer.ParseFormat(name)
+		if err != nil {
+			return "", errors.NewValidationError("Invalid format", err.Error())
+		}
+		return format, nil
+	}
+
+	format, ok := importer.FormatFromContentType(c.ContentType())
+	if !ok {
+		return "", errors.NewValidationError("Format is required", "Set the 'format' query parameter or a CSV, TSV or JSON Lines Content-Type")
+	}
+	return format, nil
+}
+
+// ExportSuggestionsHandler streams every suggestion, optionally only those
+// starting with a prefix or in a category, as JSON Lines or CSV in term order
+func (h *Handler) ExportSuggestionsHandler(c *gin.Context) {
+	format := importer.FormatJSONL
+	if name := c.Query("format"); name != "" {
+		var err error
+		format, err = importer.ParseFormat(name)
+		if err != nil || (format != importer.FormatJSONL && format != importer.FormatCSV) {
+			apiErr := errors.NewValidationError("Invalid format", "Format must be jsonl or csv")
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+	}
+
+	prefix := c.Query("prefix")
+	if prefix != "" {
+		if err := h.validator.ValidateQuery(prefix); err != nil {
+			apiErr := errors.NewValidationError("Invalid prefix", err.Error())
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+	}
+
+	category := c.Query("category")
+	if err := utils.ValidateCategory(category); err != nil {
+		apiErr := errors.NewValidationError("Invalid category", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	// Large exports take longer than the server's write timeout allows
+	_ = http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	// The count is only known once the export is written, so it's sent
+	// as a trailer
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="suggestions.%s"`, format))
+	c.Header("Trailer", "X-Suggestion-Count")
+	c.Status(http.StatusOK)
+
+	count, err := exporter.Write(c.Writer, format, h.service.ExportSuggestions(prefix, category))
+	c.Writer.Header().Set("X-Suggestion-Count", strconv.Itoa(count))
+	if err != nil {
+		// The status has been sent, so all that can be done is to stop
+		h.logger.WithError(err).Warn("Failed to stream export")
+		return
+	}
+
+	h.logger.WithFields(logrus.Fields{
+		"format":   format,
+		"prefix":   prefix,
+		"category": category,
+		"count":    count,
+	}).Info("Exported suggestions")
+}
+
+// IndexStatusHandler describes the live index generation and the one kept
+// for rollback
+func (h *Handler) IndexStatusHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, h.service.IndexStatus())
+}
+
+// errRebuildRejected aborts a rebuild whose import file has invalid rows
+var errRebuildRejected = stderrors.New("import file has invalid rows")
+
+// RebuildIndexHandler builds a new index on the side, from an import file in
+// the request body or from the configured snapshot, and swaps it in for the
+// live one. Searches are served from the live index until the swap.
+func (h *Handler) RebuildIndexHandler(c *gin.Context) {
+	var load func(*service.IndexBuilder) error
+	var report *importer.Report
+
+	source := c.Query("source")
+	switch source {
+	case "import":
+		format, apiErr := importFormat(c)
+		if apiErr != nil {
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+
+		// Large files take longer than the server's request timeouts allow
+		controller := http.NewResponseController(c.Writer)
+		_ = controller.SetReadDeadline(time.Time{})
+		_ = controller.SetWriteDeadline(time.Time{})
+
+		load = func(b *service.IndexBuilder) error {
+			imp := importer.New(b, importer.Options{Format: format, Mode: importer.ModeUpsert})
+			var err error
+			report, err = imp.Import(c.Request.Context(), c.Request.Body)
+			if err == nil && report.Invalid > 0 {
+				return errRebuildRejected
+			}
+			return err
+		}
+	case "snapshot":
+		path := h.service.SnapshotPath()
+		if path == "" {
+			apiErr := errors.NewValidationError("Snapshots are not enabled", "Rebuilding from a snapshot needs SNAPSHOT_ENABLED")
+			c.JSON(apiErr.HTTPStatus, apiErr)
+			return
+		}
+		load = func(b *service.IndexBuilder) error {
+			return h.service.LoadSnapshotInto(b, path)
+		}
+	default:
+		apiErr := errors.NewValidationError("Invalid source", "Source must be import or snapshot")
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	status, err := h.service.Rebuild(source, load)
+	switch {
+	case stderrors.Is(err, service.ErrRebuildInProgress):
+		apiErr := errors.NewConflictError("Rebuild already in progress", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	case stderrors.Is(err, errRebuildRejected):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    errors.ErrCodeValidation,
+			"message": "Invalid import file",
+			"details": "The live index was kept because some rows were invalid",
+			"import":  report,
+		})
+		return
+	case stderrors.Is(err, importer.ErrInvalidFile):
+		apiErr := errors.NewValidationError("Invalid import file", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	case err != nil && status.Active.Generation == 0: // Failed before the swap
+		h.logger.WithError(err).Error("Failed to rebuild index")
+		h.metrics.RecordError("api", "service_failed")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    errors.ErrCodeInternal,
+			"message": "Failed to rebuild index",
+			"details": "The live index was kept",
+			"import":  report,
+		})
+		return
+	case err != nil:
+		// The new index is live but a restart would come back to the old one
+		h.metrics.RecordError("api", "snapshot_failed")
+		apiErr := errors.NewInternalError("Index rebuilt but not snapshotted", err)
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Index rebuilt",
+		"index":   status,
+		"import":  report,
+	})
+}
+
+// RollbackIndexHandler swaps the index replaced by the last rebuild back in
+func (h *Handler) RollbackIndexHandler(c *gin.Context) {
+	status, err := h.service.Rollback()
+	if stderrors.Is(err, service.ErrNoPreviousIndex) {
+		apiErr := errors.NewConflictError("Nothing to roll back to", err.Error())
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+	if err != nil {
+		h.metrics.RecordError("api", "snapshot_failed")
+		apiErr := errors.NewInternalError("Index rolled back but not snapshotted", err)
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Index rolled back",
+		"index":   status,
+	})
+}
+
 // UpdateFrequencyHandler updates the frequency of a suggestion
 func (h *Handler) UpdateFrequencyHandler(c *gin.Context) {
 	term := c.Param("term")
@@ -315,7 +702,13 @@ func (h *Handler) UpdateFrequencyHandler(c *gin.Context) {
 		return
 	}
 
-	h.service.UpdateFrequency(term, frequency)
+	if err := h.service.UpdateFrequency(term, frequency); err != nil {
+		h.logger.WithError(err).Error("Failed to update frequency")
+		h.metrics.RecordError("api", "service_failed")
+		apiErr := errors.NewInternalError("Failed to update frequency", err)
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":   "Frequency updated successfully",
@@ -340,7 +733,14 @@ func (h *Handler) DeleteSuggestionHandler(c *gin.Context) {
 		return
 	}
 
-	deleted := h.service.DeleteSuggestion(term)
+	deleted, err := h.service.DeleteSuggestion(term)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to delete suggestion")
+		h.metrics.RecordError("api", "service_failed")
+		apiErr := errors.NewInternalError("Failed to delete suggestion", err)
+		c.JSON(apiErr.HTTPStatus, apiErr)
+		return
+	}
 	if !deleted {
 		apiErr := errors.NewNotFoundError("suggestion")
 		c.JSON(apiErr.HTTPStatus, apiErr)
@@ -484,6 +884,9 @@ func (h *Handler) logQuery(query, userID, sessionID, ipAddress string) {
 		"ip":         searchLog.IPAddress,
 	}).Info("Search query logged")
 
+	// Feed the user's history for personalization
+	h.service.RecordSearch(userID, sessionID, query)
+
 	// Send to data pipeline for processing
 	if h.pipeline != nil {
 		if err := h.pipeline.LogQuery(searchLog); err != nil {
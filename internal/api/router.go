@@ -31,6 +31,10 @@ func SetupRouter(handler *Handler, apiKey string, enableCORS bool) *gin.Engine {
 		// Autocomplete endpoints
 		v1.GET("/autocomplete", handler.AutocompleteHandler)
 		v1.POST("/autocomplete", handler.AutocompletePostHandler)
+		v1.POST("/autocomplete/selections", handler.SelectionHandler)
+
+		// Queries searched for much more often than usual
+		v1.GET("/trending", handler.TrendingHandler)
 
 		// Health check
 		v1.GET("/health", handler.HealthHandler)
@@ -48,8 +52,15 @@ func SetupRouter(handler *Handler, apiKey string, enableCORS bool) *gin.Engine {
 		// Suggestion management
 		admin.POST("/suggestions", handler.AddSuggestionHandler)
 		admin.POST("/suggestions/batch", handler.BatchAddSuggestionsHandler)
+		admin.POST("/suggestions/import", handler.ImportSuggestionsHandler)
+		admin.GET("/suggestions/export", handler.ExportSuggestionsHandler)
 		admin.PUT("/suggestions/:term/frequency", handler.UpdateFrequencyHandler)
 		admin.DELETE("/suggestions/:term", handler.DeleteSuggestionHandler)
+
+		// Index generations
+		admin.GET("/index", handler.IndexStatusHandler)
+		admin.POST("/index/rebuild", handler.RebuildIndexHandler)
+		admin.POST("/index/rollback", handler.RollbackIndexHandler)
 	}
 
 	// Add a simple frontend for testing (optional)
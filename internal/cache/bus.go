@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+)
+
+// DefaultInvalidationChannel is the Redis channel invalidations are
+// published on without a namespace
+const DefaultInvalidationChannel = "autocomplete:{" + DefaultNamespace + "}:invalidations"
+
+// Invalidation tells every instance which cached results have gone stale
+type Invalidation struct {
+	Origin     string   `json:"origin"`               // Instance that published it
+	Prefixes   []string `json:"prefixes,omitempty"`   // Queries whose results changed
+	Generation uint64   `json:"generation,omitempty"` // Index generation the origin swapped in, if it did
+	Contents   uint64   `json:"contents,omitempty"`   // Hash of the suggestions in that generation
+}
+
+// InvalidationBus broadcasts invalidations between instances. Delivery is
+// best effort: an instance that misses one serves stale results until they
+// expire.
+type InvalidationBus interface {
+	Publish(ctx context.Context, invalidation Invalidation) error
+	// Subscribe registers a handler for every invalidation published,
+	// including the subscriber's own
+	Subscribe(handler func(Invalidation))
+	Close() error
+}
+
+// Purger is implemented by caches that can drop every entry at once
+type Purger interface {
+	Purge(ctx context.Context) error
+}
+
+// handlers is a set of invalidation handlers shared by the buses
+type handlers struct {
+	mutex sync.RWMutex
+	list  []func(Invalidation)
+}
+
+func (h *handlers) add(handler func(Invalidation)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.list = append(h.list, handler)
+}
+
+func (h *handlers) deliver(invalidation Invalidation) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	for _, handler := range h.list {
+		handler(invalidation)
+	}
+}
+
+// LocalBus delivers invalidations to subscribers in the same process, before
+// Publish returns. Several services sharing one stand in for a cluster in
+// tests.
+type LocalBus struct {
+	handlers handlers
+}
+
+// NewLocalBus creates an in-process invalidation bus
+func NewLocalBus() *LocalBus {
+	return &LocalBus{}
+}
+
+// Publish delivers an invalidation to every subscriber
+func (b *LocalBus) Publish(ctx context.Context, invalidation Invalidation) error {
+	b.handlers.deliver(invalidation)
+	return nil
+}
+
+// Subscribe registers a handler for every invalidation published
+func (b *LocalBus) Subscribe(handler func(Invalidation)) {
+	b.handlers.add(handler)
+}
+
+// Close does nothing; there is nothing to release
+func (b *LocalBus) Close() error {
+	return nil
+}
+
+// RedisBus broadcasts invalidations over Redis pub/sub
+type RedisBus struct {
+	client   *redis.Client
+	pubsub   *redis.PubSub
+	channel  string
+	handlers handlers
+	logger   *logrus.Logger
+	metrics  *metrics.Metrics
+	done     chan struct{}
+}
+
+// NewRedisBus subscribes to an invalidation channel, by default
+// DefaultInvalidationChannel
+func NewRedisBus(client *redis.Client, channel string, logger *logrus.Logger, metricsInstance *metrics.Metrics) (*RedisBus, error) {
+	if channel == "" {
+		channel = DefaultInvalidationChannel
+	}
+
+	ctx := context.Background()
+	pubsub := client.Subscribe(ctx, channel)
+	// Wait for the subscription, so nothing published after this returns is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	bus := &RedisBus{
+		client:  client,
+		pubsub:  pubsub,
+		channel: channel,
+		logger:  logger,
+		metrics: metricsInstance,
+		done:    make(chan struct{}),
+	}
+	go bus.receive()
+
+	return bus, nil
+}
+
+// Publish broadcasts an invalidation to every subscribed instance
+func (b *RedisBus) Publish(ctx context.Context, invalidation Invalidation) error {
+	data, err := json.Marshal(invalidation)
+	if err != nil {
+		return err
+	}
+	if err := b.client.Publish(ctx, b.channel, data).Err(); err != nil {
+		b.metrics.RecordError("cache", "invalidation_publish_failed")
+		return err
+	}
+	b.metrics.RecordCacheInvalidation("published")
+	return nil
+}
+
+// Subscribe registers a handler for every invalidation published
+func (b *RedisBus) Subscribe(handler func(Invalidation)) {
+	b.handlers.add(handler)
+}
+
+// Close unsubscribes and waits for the receiving routine to stop
+func (b *RedisBus) Close() error {
+	err := b.pubsub.Close()
+	<-b.done
+	return err
+}
+
+// receive delivers invalidations until the subscription is closed. The
+// client resubscribes by itself after a lost connection.
+func (b *RedisBus) receive() {
+	defer close(b.done)
+
+	for message := range b.pubsub.Channel() {
+		var invalidation Invalidation
+		if err := json.Unmarshal([]byte(message.Payload), &invalidation); err != nil {
+			b.logger.WithError(err).Warn("Ignoring malformed cache invalidation")
+			b.metrics.RecordError("cache", "invalidation_unmarshal_failed")
+			continue
+		}
+		b.metrics.RecordCacheInvalidation("received")
+		b.handlers.deliver(invalidation)
+	}
+}
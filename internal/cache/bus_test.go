@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBus_DeliversToEverySubscriber(t *testing.T) {
+	bus := NewLocalBus()
+	var first, second []Invalidation
+	bus.Subscribe(func(invalidation Invalidation) { first = append(first, invalidation) })
+	bus.Subscribe(func(invalidation Invalidation) { second = append(second, invalidation) })
+
+	invalidation := Invalidation{Origin: "a", Prefixes: []string{"a", "ap"}}
+	require.NoError(t, bus.Publish(context.Background(), invalidation))
+	require.NoError(t, bus.Publish(context.Background(), Invalidation{Origin: "b", Generation: 2}))
+
+	assert.Equal(t, []Invalidation{invalidation, {Origin: "b", Generation: 2}}, first)
+	assert.Equal(t, first, second)
+	assert.NoError(t, bus.Close())
+}
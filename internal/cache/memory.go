@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Rough per-entry costs, in bytes, on top of the strings an entry holds
+const (
+	entryOverhead      = 128 // List element, map slot and bookkeeping
+	suggestionOverhead = 96  // A models.Suggestion's fixed fields
+	metadataOverhead   = 32  // Each metadata map slot
+)
+
+// MemoryConfig holds in-memory cache configuration
+type MemoryConfig struct {
+	Name       string // Cache type in metrics, default "memory"
+	TTL        time.Duration
+	MaxEntries int   // Queries cached before the least recently used is evicted, default 10000
+	MaxBytes   int64 // Approximate memory budget for cached results, default 64MB
+}
+
+// MemoryStats reports what an in-memory cache holds and how it has been used
+type MemoryStats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"` // Entries dropped to stay within bounds or because they expired
+}
+
+// InMemoryCache is a size-bounded, expiring cache of query results that is
+// safe for concurrent use. The least recently used entries are evicted to
+// stay within MaxEntries and MaxBytes.
+type InMemoryCache struct {
+	config  MemoryConfig
+	logger  *logrus.Logger
+	metrics *metrics.Metrics
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	recent  *list.List // Most recently used entry at the front
+	bytes   int64
+	stats   MemoryStats
+	now     func() time.Time
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// memoryEntry is one cached query
+type memoryEntry struct {
+	query       string
+	suggestions []models.Suggestion
+	expiry      time.Time
+	size        int64
+}
+
+// NewInMemoryCache creates a new in-memory cache
+func NewInMemoryCache(config MemoryConfig, logger *logrus.Logger, metricsInstance *metrics.Metrics) *InMemoryCache {
+	if config.Name == "" {
+		config.Name = "memory"
+	}
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 10000
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 64 << 20
+	}
+
+	cache := &InMemoryCache{
+		config:  config,
+		logger:  logger,
+		metrics: metricsInstance,
+		entries: make(map[string]*list.Element),
+		recent:  list.New(),
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+
+	// Start cleanup routine
+	go cache.cleanup()
+
+	return cache
+}
+
+// Get retrieves suggestions from in-memory cache
+func (c *InMemoryCache) Get(ctx context.Context, query string) ([]models.Suggestion, bool) {
+	start := time.Now()
+
+	c.mutex.Lock()
+	var suggestions []models.Suggestion
+	element, found := c.entries[query]
+	if found {
+		entry := element.Value.(*memoryEntry)
+		if c.now().After(entry.expiry) {
+			c.remove(element, "expired")
+			found = false
+		} else {
+			c.recent.MoveToFront(element)
+			suggestions = entry.suggestions
+		}
+	}
+	if found {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	c.mutex.Unlock()
+
+	// Record cache operation duration
+	c.metrics.RecordCacheOperation("get", c.config.Name, time.Since(start))
+
+	if !found {
+		c.metrics.RecordCacheMiss(c.config.Name)
+		return nil, false
+	}
+
+	c.metrics.RecordCacheHit(c.config.Name)
+	return suggestions, true
+}
+
+// Set stores suggestions in in-memory cache. Results too large for the
+// whole byte budget aren't cached.
+func (c *InMemoryCache) Set(ctx context.Context, query string, suggestions []models.Suggestion) error {
+	start := time.Now()
+
+	entry := &memoryEntry{
+		query:       query,
+		suggestions: append([]models.Suggestion(nil), suggestions...), // The caller may reuse its slice
+		size:        entrySize(query, suggestions),
+	}
+
+	c.mutex.Lock()
+	entry.expiry = c.now().Add(c.config.TTL)
+	if element, ok := c.entries[query]; ok {
+		c.remove(element, "")
+	}
+	if entry.size <= c.config.MaxBytes {
+		for c.recent.Len() >= c.config.MaxEntries || c.bytes+entry.size > c.config.MaxBytes {
+			c.remove(c.recent.Back(), "size")
+		}
+		c.entries[query] = c.recent.PushFront(entry)
+		c.bytes += entry.size
+	} else {
+		c.logger.WithFields(logrus.Fields{
+			"query": query,
+			"bytes": entry.size,
+		}).Debug("Result too large to cache")
+	}
+	c.updateSize()
+	c.mutex.Unlock()
+
+	// Record cache operation duration
+	c.metrics.RecordCacheOperation("set", c.config.Name, time.Since(start))
+
+	return nil
+}
+
+// Delete removes a query from in-memory cache
+func (c *InMemoryCache) Delete(ctx context.Context, query string) error {
+	start := time.Now()
+
+	c.mutex.Lock()
+	if element, ok := c.entries[query]; ok {
+		c.remove(element, "")
+		c.updateSize()
+	}
+	c.mutex.Unlock()
+
+	// Record cache operation duration
+	c.metrics.RecordCacheOperation("delete", c.config.Name, time.Since(start))
+
+	return nil
+}
+
+// Purge drops every entry
+func (c *InMemoryCache) Purge(ctx context.Context) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]*list.Element)
+	c.recent.Init()
+	c.bytes = 0
+	c.updateSize()
+	return nil
+}
+
+// Stats returns what the cache holds and how it has been used
+func (c *InMemoryCache) Stats() MemoryStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := c.stats
+	stats.Entries = c.recent.Len()
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Close stops the cleanup routine
+func (c *InMemoryCache) Close() error {
+	c.stopOnce.Do(func() { close(c.stop) })
+	return nil
+}
+
+// remove drops an entry, counting it as evicted unless reason is empty.
+// Callers must hold the mutex.
+func (c *InMemoryCache) remove(element *list.Element, reason string) {
+	entry := element.Value.(*memoryEntry)
+	c.recent.Remove(element)
+	delete(c.entries, entry.query)
+	c.bytes -= entry.size
+
+	if reason != "" {
+		c.stats.Evictions++
+		c.metrics.RecordCacheEviction(c.config.Name, reason)
+	}
+}
+
+// updateSize publishes the cache's size. Callers must hold the mutex.
+func (c *InMemoryCache) updateSize() {
+	c.metrics.UpdateCacheSize(c.config.Name, c.recent.Len(), c.bytes)
+}
+
+// cleanup removes expired items from cache
+func (c *InMemoryCache) cleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.removeExpired()
+		}
+	}
+}
+
+// removeExpired drops every expired entry
+func (c *InMemoryCache) removeExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := c.now()
+	for element := c.recent.Back(); element != nil; {
+		previous := element.Prev()
+		if now.After(element.Value.(*memoryEntry).expiry) {
+			c.remove(element, "expired")
+		}
+		element = previous
+	}
+	c.updateSize()
+}
+
+// entrySize estimates the memory a cached result holds
+func entrySize(query string, suggestions []models.Suggestion) int64 {
+	size := int64(entryOverhead + len(query))
+	for _, suggestion := range suggestions {
+		size += int64(suggestionOverhead + len(suggestion.Term) + len(suggestion.Category))
+		for key, value := range suggestion.Metadata {
+			size += int64(metadataOverhead + len(key) + len(value))
+		}
+	}
+	return size
+}
@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// newTestCache returns a cache whose clock only moves when advanced
+func newTestCache(t *testing.T, config MemoryConfig) (*InMemoryCache, func(time.Duration)) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	c := NewInMemoryCache(config, logger, metrics.NewMetrics())
+	c.now = func() time.Time { return now }
+	t.Cleanup(func() { c.Close() })
+	return c, func(d time.Duration) { now = now.Add(d) }
+}
+
+func suggestions(terms ...string) []models.Suggestion {
+	result := make([]models.Suggestion, len(terms))
+	for i, term := range terms {
+		result[i] = models.Suggestion{Term: term, Frequency: 1}
+	}
+	return result
+}
+
+func TestInMemoryCache_GetSetDelete(t *testing.T) {
+	c, _ := newTestCache(t, MemoryConfig{})
+	ctx := context.Background()
+
+	_, found := c.Get(ctx, "ap")
+	assert.False(t, found)
+
+	stored := suggestions("apple", "apricot")
+	require.NoError(t, c.Set(ctx, "ap", stored))
+	stored[0].Term = "changed"
+
+	cached, found := c.Get(ctx, "ap")
+	require.True(t, found)
+	assert.Equal(t, suggestions("apple", "apricot"), cached, "the caller's slice isn't aliased")
+
+	require.NoError(t, c.Delete(ctx, "ap"))
+	_, found = c.Get(ctx, "ap")
+	assert.False(t, found)
+	require.NoError(t, c.Delete(ctx, "missing"))
+
+	stats := c.Stats()
+	assert.Equal(t, MemoryStats{Hits: 1, Misses: 2}, stats)
+}
+
+func TestInMemoryCache_Expiry(t *testing.T) {
+	c, advance := newTestCache(t, MemoryConfig{TTL: time.Minute})
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "a", suggestions("apple")))
+	require.NoError(t, c.Set(ctx, "b", suggestions("banana")))
+
+	advance(30 * time.Second)
+	require.NoError(t, c.Set(ctx, "c", suggestions("cherry")))
+
+	advance(31 * time.Second)
+	_, found := c.Get(ctx, "a")
+	assert.False(t, found, "expired entries are dropped on read")
+
+	c.removeExpired()
+	stats := c.Stats()
+	assert.Equal(t, 1, stats.Entries, "the cleanup drops the rest")
+	assert.Equal(t, int64(2), stats.Evictions)
+
+	_, found = c.Get(ctx, "c")
+	assert.True(t, found)
+}
+
+func TestInMemoryCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestCache(t, MemoryConfig{MaxEntries: 3})
+	ctx := context.Background()
+
+	for _, query := range []string{"a", "b", "c"} {
+		require.NoError(t, c.Set(ctx, query, suggestions(query)))
+	}
+	_, found := c.Get(ctx, "a")
+	require.True(t, found)
+
+	require.NoError(t, c.Set(ctx, "d", suggestions("d")))
+
+	_, found = c.Get(ctx, "b")
+	assert.False(t, found, "b was the least recently used")
+	for _, query := range []string{"a", "c", "d"} {
+		_, found := c.Get(ctx, query)
+		assert.True(t, found, query)
+	}
+
+	// Replacing an entry doesn't evict another
+	require.NoError(t, c.Set(ctx, "d", suggestions("date")))
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, int64(1), stats.Evictions)
+}
+
+func TestInMemoryCache_ByteBudget(t *testing.T) {
+	one := entrySize("q0", suggestions("term"))
+	c, _ := newTestCache(t, MemoryConfig{MaxBytes: 3 * one})
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, c.Set(ctx, fmt.Sprintf("q%d", i), suggestions("term")))
+	}
+
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Entries)
+	assert.Equal(t, 3*one, stats.Bytes)
+	assert.Equal(t, int64(2), stats.Evictions)
+
+	// A result bigger than the whole budget isn't cached, and evicts nothing
+	require.NoError(t, c.Set(ctx, "huge", suggestions(strings.Repeat("x", int(3*one)))))
+	_, found := c.Get(ctx, "huge")
+	assert.False(t, found)
+	assert.Equal(t, 3, c.Stats().Entries)
+
+	require.NoError(t, c.Delete(ctx, "q4"))
+	assert.Equal(t, 2*one, c.Stats().Bytes)
+}
+
+func TestInMemoryCache_Concurrent(t *testing.T) {
+	c, _ := newTestCache(t, MemoryConfig{MaxEntries: 50})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				query := fmt.Sprintf("q%d", (w*i)%100)
+				switch i % 3 {
+				case 0:
+					assert.NoError(t, c.Set(ctx, query, suggestions(query)))
+				case 1:
+					c.Get(ctx, query)
+				default:
+					assert.NoError(t, c.Delete(ctx, query))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	assert.LessOrEqual(t, stats.Entries, 50)
+	assert.Equal(t, int64(8*167), stats.Hits+stats.Misses, "every read is counted")
+}
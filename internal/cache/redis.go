@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -13,25 +14,37 @@ import (
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 )
 
+// scanBatch is how many keys are asked for per SCAN and deleted per UNLINK
+const scanBatch = 500
+
+// DefaultNamespace is the namespace of a cache configured without one
+const DefaultNamespace = "default"
+
 // RedisCache implements caching using Redis
 type RedisCache struct {
 	client  *redis.Client
 	ttl     time.Duration
+	prefix  string // Starts every key, see keyPrefix
 	logger  *logrus.Logger
 	metrics *metrics.Metrics
 }
 
 // Config holds Redis configuration
 type Config struct {
-	Host     string
-	Port     int
-	Password string
-	DB       int
-	TTL      time.Duration
+	Host      string
+	Port      int
+	Password  string
+	DB        int
+	TTL       time.Duration
+	Namespace string // Separates environments, tenants or index versions sharing a Redis, e.g. "prod:v2"; no braces
 }
 
 // NewRedisCache creates a new Redis cache instance
 func NewRedisCache(config Config, logger *logrus.Logger, metricsInstance *metrics.Metrics) *RedisCache {
+	if err := validateNamespace(config.Namespace); err != nil {
+		logger.WithError(err).Fatal("Invalid cache namespace")
+	}
+
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     fmt.Sprintf("%s:%d", config.Host, config.Port),
 		Password: config.Password,
@@ -50,6 +63,7 @@ func NewRedisCache(config Config, logger *logrus.Logger, metricsInstance *metric
 	return &RedisCache{
 		client:  rdb,
 		ttl:     config.TTL,
+		prefix:  keyPrefix(config.Namespace),
 		logger:  logger,
 		metrics: metricsInstance,
 	}
@@ -135,21 +149,41 @@ func (r *RedisCache) Delete(ctx context.Context, query string) error {
 	return nil
 }
 
-// Clear removes all cached queries matching a pattern
+// Clear removes the namespace's cached queries matching a glob pattern, or
+// all of them if pattern is empty. Keys are found with SCAN and deleted in
+// batches, so Redis keeps serving other clients meanwhile.
 func (r *RedisCache) Clear(ctx context.Context, pattern string) error {
 	if pattern == "" {
-		pattern = "autocomplete:*"
+		pattern = "*"
 	}
 
-	keys, err := r.client.Keys(ctx, pattern).Result()
-	if err != nil {
-		return fmt.Errorf("failed to get keys: %w", err)
+	var batch []string
+	deleted := 0
+	err := r.scan(ctx, escapeGlob(r.prefix)+pattern, func(key string) error {
+		batch = append(batch, key)
+		if len(batch) < scanBatch {
+			return nil
+		}
+		if err := r.client.Unlink(ctx, batch...).Err(); err != nil {
+			return err
+		}
+		deleted += len(batch)
+		batch = batch[:0]
+		return nil
+	})
+	if err == nil && len(batch) > 0 {
+		err = r.client.Unlink(ctx, batch...).Err()
+		deleted += len(batch)
 	}
-
-	if len(keys) > 0 {
-		return r.client.Del(ctx, keys...).Err()
+	if err != nil {
+		r.metrics.RecordError("cache", "clear_failed")
+		return fmt.Errorf("failed to clear keys: %w", err)
 	}
 
+	r.logger.WithFields(logrus.Fields{
+		"pattern": pattern,
+		"deleted": deleted,
+	}).Info("Cleared cache")
 	return nil
 }
 
@@ -160,21 +194,46 @@ func (r *RedisCache) GetStats(ctx context.Context) (map[string]interface{}, erro
 		return nil, fmt.Errorf("failed to get Redis stats: %w", err)
 	}
 
-	// Get key count for autocomplete
-	keys, err := r.client.Keys(ctx, "autocomplete:*").Result()
+	// Count the namespace's keys
+	keys := 0
+	err = r.scan(ctx, escapeGlob(r.prefix)+"*", func(string) error {
+		keys++
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get key count: %w", err)
 	}
 
 	stats := map[string]interface{}{
 		"redis_info":        info,
-		"autocomplete_keys": len(keys),
+		"autocomplete_keys": keys,
+		"key_prefix":        r.prefix,
 		"ttl_seconds":       r.ttl.Seconds(),
 	}
 
 	return stats, nil
 }
 
+// scan calls fn for every key matching a glob pattern, a batch at a time
+func (r *RedisCache) scan(ctx context.Context, match string, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := r.client.Scan(ctx, cursor, match, scanBatch).Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
 // Warmup pre-loads common queries into cache
 func (r *RedisCache) Warmup(ctx context.Context, commonQueries map[string][]models.Suggestion) error {
 	r.logger.Info("Starting cache warmup")
@@ -192,103 +251,56 @@ func (r *RedisCache) Warmup(ctx context.Context, commonQueries map[string][]mode
 
 // buildKey creates a standardized cache key
 func (r *RedisCache) buildKey(query string) string {
-	return fmt.Sprintf("autocomplete:%s", query)
+	return r.prefix + query
 }
 
-// Close closes the Redis connection
-func (r *RedisCache) Close() error {
-	return r.client.Close()
+// InvalidationChannel returns the namespace's channel for cache
+// invalidations, so that only instances sharing the namespace hear them
+func (r *RedisCache) InvalidationChannel() string {
+	return r.prefix + "invalidations"
 }
 
-// InMemoryCache implements a simple in-memory cache as fallback
-type InMemoryCache struct {
-	data    map[string]cacheItem
-	ttl     time.Duration
-	logger  *logrus.Logger
-	metrics *metrics.Metrics
-}
-
-type cacheItem struct {
-	suggestions []models.Suggestion
-	expiry      time.Time
-}
-
-// NewInMemoryCache creates a new in-memory cache
-func NewInMemoryCache(ttl time.Duration, logger *logrus.Logger, metricsInstance *metrics.Metrics) *InMemoryCache {
-	cache := &InMemoryCache{
-		data:    make(map[string]cacheItem),
-		ttl:     ttl,
-		logger:  logger,
-		metrics: metricsInstance,
+// keyPrefix returns the prefix of every key in a namespace,
+// "autocomplete:{<namespace>}:". The closing brace ends the namespace, so
+// no namespace's keys start with another's prefix, the way "prod:v2:..."
+// would start with "prod:".
+func keyPrefix(namespace string) string {
+	if namespace == "" {
+		namespace = DefaultNamespace
 	}
-
-	// Start cleanup routine
-	go cache.cleanup()
-
-	return cache
+	return "autocomplete:{" + namespace + "}:"
 }
 
-// Get retrieves suggestions from in-memory cache
-func (c *InMemoryCache) Get(ctx context.Context, query string) ([]models.Suggestion, bool) {
-	start := time.Now()
-
-	item, exists := c.data[query]
-
-	// Record cache operation duration
-	c.metrics.RecordCacheOperation("get", "memory", time.Since(start))
-
-	if !exists || time.Now().After(item.expiry) {
-		if exists {
-			delete(c.data, query) // Clean expired item
-		}
-		c.metrics.RecordCacheMiss("memory")
-		return nil, false
+// validateNamespace checks that a namespace can be told apart from others
+// in a key
+func validateNamespace(namespace string) error {
+	if strings.ContainsAny(namespace, "{}") {
+		return fmt.Errorf("cache namespace %q may not contain braces", namespace)
 	}
-
-	c.metrics.RecordCacheHit("memory")
-	return item.suggestions, true
+	return nil
 }
 
-// Set stores suggestions in in-memory cache
-func (c *InMemoryCache) Set(ctx context.Context, query string, suggestions []models.Suggestion) error {
-	start := time.Now()
-
-	c.data[query] = cacheItem{
-		suggestions: suggestions,
-		expiry:      time.Now().Add(c.ttl),
+// escapeGlob escapes the characters SCAN's MATCH treats specially
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
 	}
-
-	// Record cache operation duration
-	c.metrics.RecordCacheOperation("set", "memory", time.Since(start))
-
-	return nil
+	return b.String()
 }
 
-// Delete removes a query from in-memory cache
-func (c *InMemoryCache) Delete(ctx context.Context, query string) error {
-	start := time.Now()
-
-	delete(c.data, query)
-
-	// Record cache operation duration
-	c.metrics.RecordCacheOperation("delete", "memory", time.Since(start))
-
-	return nil
+// Client returns the underlying Redis client
+func (r *RedisCache) Client() *redis.Client {
+	return r.client
 }
 
-// cleanup removes expired items from cache
-func (c *InMemoryCache) cleanup() {
-	ticker := time.NewTicker(time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		now := time.Now()
-		for key, item := range c.data {
-			if now.After(item.expiry) {
-				delete(c.data, key)
-			}
-		}
-	}
+// Close closes the Redis connection
+func (r *RedisCache) Close() error {
+	return r.client.Close()
 }
 
 // Cache interface defines the caching contract
@@ -0,0 +1,257 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+)
+
+// fakeRedis speaks just enough of the Redis protocol for RedisCache: PING,
+// GET, SET, DEL, EXPIRE, INFO, SCAN and UNLINK. It records the size of every
+// UNLINK.
+type fakeRedis struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	data    map[string]string
+	order   []string // Every key ever set, so deletes don't move SCAN cursors
+	unlinks []int
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := &fakeRedis{listener: listener, data: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return f
+}
+
+func (f *fakeRedis) addr() (string, int) {
+	addr := f.listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (f *fakeRedis) keys() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.data))
+	for key := range f.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		if _, err := io.WriteString(conn, f.handle(args)); err != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads a command sent as an array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "SET":
+		if _, ok := f.data[args[1]]; !ok {
+			f.order = append(f.order, args[1])
+		}
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "DEL", "UNLINK":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.data[key]; ok {
+				delete(f.data, key)
+				deleted++
+			}
+		}
+		if strings.ToUpper(args[0]) == "UNLINK" {
+			f.unlinks = append(f.unlinks, len(args)-1)
+		}
+		return fmt.Sprintf(":%d\r\n", deleted)
+	case "EXPIRE":
+		return ":1\r\n"
+	case "INFO":
+		return bulk("# Stats\r\n")
+	case "SCAN":
+		return f.scan(args)
+	default:
+		return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+// scan pages through the keys in the order they were set; the cursor is the
+// next index
+func (f *fakeRedis) scan(args []string) string {
+	cursor, _ := strconv.Atoi(args[1])
+	match, count := "*", 10
+	for i := 2; i+1 < len(args); i += 2 {
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			count, _ = strconv.Atoi(args[i+1])
+		}
+	}
+
+	end := min(cursor+count, len(f.order))
+	var matched []string
+	for _, key := range f.order[cursor:end] {
+		if _, ok := f.data[key]; !ok {
+			continue
+		}
+		if ok, _ := path.Match(match, key); ok {
+			matched = append(matched, key)
+		}
+	}
+	if end == len(f.order) {
+		end = 0
+	}
+
+	reply := fmt.Sprintf("*2\r\n%s*%d\r\n", bulk(strconv.Itoa(end)), len(matched))
+	for _, key := range matched {
+		reply += bulk(key)
+	}
+	return reply
+}
+
+func bulk(s string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s)
+}
+
+func newTestRedisCache(t *testing.T, f *fakeRedis, namespace string) *RedisCache {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+	host, port := f.addr()
+	r := NewRedisCache(Config{Host: host, Port: port, TTL: time.Minute, Namespace: namespace}, logger, metrics.NewMetrics())
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRedisCache_NamespacedKeys(t *testing.T) {
+	tests := []struct {
+		namespace string
+		key       string
+		channel   string
+	}{
+		{"", "autocomplete:{default}:ap", "autocomplete:{default}:invalidations"},
+		{"prod", "autocomplete:{prod}:ap", "autocomplete:{prod}:invalidations"},
+		{"staging:tenant-a:v2", "autocomplete:{staging:tenant-a:v2}:ap", "autocomplete:{staging:tenant-a:v2}:invalidations"},
+	}
+
+	for _, tt := range tests {
+		r := &RedisCache{prefix: keyPrefix(tt.namespace)}
+		assert.Equal(t, tt.key, r.buildKey("ap"), tt.namespace)
+		assert.Equal(t, tt.channel, r.InvalidationChannel(), tt.namespace)
+	}
+	assert.Equal(t, DefaultInvalidationChannel, (&RedisCache{prefix: keyPrefix("")}).InvalidationChannel())
+
+	assert.NoError(t, validateNamespace("prod:v2"))
+	assert.Error(t, validateNamespace("prod}:x"), "braces would let one namespace's keys look like another's")
+}
+
+func TestRedisCache_ClearStaysInNamespace(t *testing.T) {
+	f := newFakeRedis(t)
+	ctx := context.Background()
+
+	prod := newTestRedisCache(t, f, "prod")
+	for i := 0; i < 1200; i++ {
+		require.NoError(t, prod.Set(ctx, fmt.Sprintf("1:q%04d", i), suggestions("apple")))
+	}
+	require.NoError(t, prod.Set(ctx, "2:ap", suggestions("apple")))
+	require.NoError(t, newTestRedisCache(t, f, "prod:v2").Set(ctx, "1:ap", suggestions("apple")))
+	require.NoError(t, newTestRedisCache(t, f, "").Set(ctx, "1:ap", suggestions("apple")))
+
+	stats, err := prod.GetStats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1201, stats["autocomplete_keys"], "keys in namespaces starting with this one's name aren't counted")
+
+	// A pattern clears part of the namespace
+	require.NoError(t, prod.Clear(ctx, "2:*"))
+	_, found := prod.Get(ctx, "2:ap")
+	assert.False(t, found)
+	assert.Equal(t, []int{1}, f.unlinks)
+
+	f.unlinks = nil
+	require.NoError(t, prod.Clear(ctx, ""))
+	assert.Equal(t, []int{500, 500, 200}, f.unlinks, "keys are unlinked in batches")
+	assert.Equal(t, []string{"autocomplete:{default}:1:ap", "autocomplete:{prod:v2}:1:ap"}, f.keys())
+}
+
+func TestEscapeGlob(t *testing.T) {
+	assert.Equal(t, "autocomplete:prod:", escapeGlob("autocomplete:prod:"))
+	assert.Equal(t, `autocomplete:a\*b\?\[c\]\\:`, escapeGlob(`autocomplete:a*b?[c]\:`))
+}
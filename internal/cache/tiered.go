@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// TieredCache puts a small per-process cache (L1) in front of a shared one
+// (L2), usually Redis, so hot queries don't pay a network round trip. L1
+// entries should expire quickly: another instance's writes to L2 only show
+// through once they do.
+type TieredCache struct {
+	l1      Cache
+	l2      Cache
+	logger  *logrus.Logger
+	metrics *metrics.Metrics
+}
+
+// NewTieredCache creates a cache that checks l1 before l2
+func NewTieredCache(l1, l2 Cache, logger *logrus.Logger, metricsInstance *metrics.Metrics) *TieredCache {
+	return &TieredCache{
+		l1:      l1,
+		l2:      l2,
+		logger:  logger,
+		metrics: metricsInstance,
+	}
+}
+
+// Get retrieves suggestions from L1, falling back to L2. L2 hits are copied
+// into L1.
+func (t *TieredCache) Get(ctx context.Context, query string) ([]models.Suggestion, bool) {
+	if suggestions, found := t.l1.Get(ctx, query); found {
+		return suggestions, true
+	}
+
+	suggestions, found := t.l2.Get(ctx, query)
+	if !found {
+		return nil, false
+	}
+
+	if err := t.l1.Set(ctx, query, suggestions); err != nil {
+		t.logger.WithError(err).Warn("Failed to back-fill L1 cache")
+		t.metrics.RecordError("cache", "l1_set_failed")
+	}
+	return suggestions, true
+}
+
+// Set stores suggestions in both tiers
+func (t *TieredCache) Set(ctx context.Context, query string, suggestions []models.Suggestion) error {
+	return errors.Join(t.l2.Set(ctx, query, suggestions), t.l1.Set(ctx, query, suggestions))
+}
+
+// Delete removes a query from both tiers
+func (t *TieredCache) Delete(ctx context.Context, query string) error {
+	return errors.Join(t.l2.Delete(ctx, query), t.l1.Delete(ctx, query))
+}
+
+// Purge drops every entry from whichever tiers can drop them all at once
+func (t *TieredCache) Purge(ctx context.Context) error {
+	var errs []error
+	for _, tier := range []Cache{t.l1, t.l2} {
+		if purger, ok := tier.(Purger); ok {
+			errs = append(errs, purger.Purge(ctx))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes whichever tiers hold resources
+func (t *TieredCache) Close() error {
+	var errs []error
+	for _, tier := range []Cache{t.l1, t.l2} {
+		if closer, ok := tier.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// remoteCache stands in for Redis, counting round trips
+type remoteCache struct {
+	data   map[string][]models.Suggestion
+	gets   int
+	setErr error
+}
+
+func (r *remoteCache) Get(ctx context.Context, query string) ([]models.Suggestion, bool) {
+	r.gets++
+	suggestions, found := r.data[query]
+	return suggestions, found
+}
+
+func (r *remoteCache) Set(ctx context.Context, query string, suggestions []models.Suggestion) error {
+	if r.setErr != nil {
+		return r.setErr
+	}
+	r.data[query] = suggestions
+	return nil
+}
+
+func (r *remoteCache) Delete(ctx context.Context, query string) error {
+	delete(r.data, query)
+	return nil
+}
+
+func newTestTieredCache(t *testing.T) (*TieredCache, *InMemoryCache, *remoteCache, func(time.Duration)) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.FatalLevel)
+
+	l1, advance := newTestCache(t, MemoryConfig{Name: "l1", TTL: 10 * time.Second})
+	l2 := &remoteCache{data: make(map[string][]models.Suggestion)}
+	return NewTieredCache(l1, l2, logger, metrics.NewMetrics()), l1, l2, advance
+}
+
+func TestTieredCache_BackfillsL1(t *testing.T) {
+	c, l1, l2, advance := newTestTieredCache(t)
+	ctx := context.Background()
+
+	// Cached by another instance
+	l2.data["ap"] = suggestions("apple")
+
+	for i := 0; i < 3; i++ {
+		cached, found := c.Get(ctx, "ap")
+		require.True(t, found)
+		assert.Equal(t, suggestions("apple"), cached)
+	}
+	assert.Equal(t, 1, l2.gets, "later reads are served from L1")
+
+	// L1 entries expire, so other instances' changes show through
+	l2.data["ap"] = suggestions("apricot")
+	advance(11 * time.Second)
+	cached, _ := c.Get(ctx, "ap")
+	assert.Equal(t, suggestions("apricot"), cached)
+	assert.Equal(t, 2, l2.gets)
+
+	_, found := c.Get(ctx, "missing")
+	assert.False(t, found)
+	assert.Equal(t, MemoryStats{Entries: 1, Bytes: l1.Stats().Bytes, Hits: 2, Misses: 3, Evictions: 1}, l1.Stats())
+}
+
+func TestTieredCache_SetAndDeleteBothTiers(t *testing.T) {
+	c, l1, l2, _ := newTestTieredCache(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "ba", suggestions("banana")))
+	assert.Contains(t, l2.data, "ba")
+	_, found := l1.Get(ctx, "ba")
+	assert.True(t, found)
+
+	require.NoError(t, c.Delete(ctx, "ba"))
+	assert.NotContains(t, l2.data, "ba")
+	_, found = c.Get(ctx, "ba")
+	assert.False(t, found)
+
+	// L1 still serves this instance when L2 is unavailable
+	l2.setErr = errors.New("connection refused")
+	assert.Error(t, c.Set(ctx, "ch", suggestions("cherry")))
+	_, found = c.Get(ctx, "ch")
+	assert.True(t, found)
+}
+
+func TestTieredCache_PurgeDropsPurgeableTiers(t *testing.T) {
+	c, l1, l2, _ := newTestTieredCache(t)
+	ctx := context.Background()
+
+	require.NoError(t, c.Set(ctx, "ap", suggestions("apple")))
+	require.NoError(t, c.Purge(ctx))
+
+	assert.Zero(t, l1.Stats().Entries)
+	assert.Contains(t, l2.data, "ap", "tiers that can't purge keep their entries")
+}
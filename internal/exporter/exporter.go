@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// columns are the CSV columns. Metadata is a JSON object in one column, so
+// the header is known before the first suggestion is read.
+var columns = []string{"term", "frequency", "score", "category", "updated_at", "metadata"}
+
+// record is the shape of a JSON Lines record
+type record struct {
+	Term      string            `json:"term"`
+	Frequency int64             `json:"frequency"`
+	Score     float64           `json:"score"`
+	Category  string            `json:"category,omitempty"`
+	UpdatedAt *time.Time        `json:"updated_at,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// Write writes suggestions to w in the given format as they are iterated and
+// returns how many were written. Only CSV and JSON Lines are supported; both
+// are laid out the way the importer reads them, so an export can be loaded
+// back as is.
+func Write(w io.Writer, format importer.Format, suggestions iter.Seq[models.Suggestion]) (int, error) {
+	switch format {
+	case importer.FormatJSONL:
+		return writeJSONLines(w, suggestions)
+	case importer.FormatCSV:
+		return writeCSV(w, suggestions)
+	default:
+		return 0, fmt.Errorf("export format %q is not supported", format)
+	}
+}
+
+func writeJSONLines(w io.Writer, suggestions iter.Seq[models.Suggestion]) (int, error) {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	encoder.SetEscapeHTML(false)
+
+	written := 0
+	for suggestion := range suggestions {
+		rec := record{
+			Term:      suggestion.Term,
+			Frequency: suggestion.Frequency,
+			Score:     suggestion.Score,
+			Category:  suggestion.Category,
+			Metadata:  suggestion.Metadata,
+		}
+		if !suggestion.UpdatedAt.IsZero() {
+			rec.UpdatedAt = &suggestion.UpdatedAt
+		}
+		if err := encoder.Encode(rec); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	return written, buffered.Flush()
+}
+
+func writeCSV(w io.Writer, suggestions iter.Seq[models.Suggestion]) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(columns); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	row := make([]string, len(columns))
+	for suggestion := range suggestions {
+		row[0] = suggestion.Term
+		row[1] = strconv.FormatInt(suggestion.Frequency, 10)
+		row[2] = strconv.FormatFloat(suggestion.Score, 'g', -1, 64)
+		row[3] = suggestion.Category
+		row[4] = ""
+		if !suggestion.UpdatedAt.IsZero() {
+			row[4] = suggestion.UpdatedAt.UTC().Format(time.RFC3339Nano)
+		}
+		row[5] = ""
+		if len(suggestion.Metadata) > 0 {
+			metadata, err := json.Marshal(suggestion.Metadata)
+			if err != nil {
+				return written, err
+			}
+			row[5] = string(metadata)
+		}
+
+		if err := writer.Write(row); err != nil {
+			return written, err
+		}
+		written++
+	}
+
+	writer.Flush()
+	return written, writer.Error()
+}
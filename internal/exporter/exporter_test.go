@@ -0,0 +1,83 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// memoryTarget collects imported suggestions in order
+type memoryTarget struct {
+	suggestions []models.Suggestion
+}
+
+func (m *memoryTarget) UpsertSuggestions(suggestions []models.Suggestion) (added, updated int, err error) {
+	m.suggestions = append(m.suggestions, suggestions...)
+	return len(suggestions), 0, nil
+}
+
+func (m *memoryTarget) RemoveSuggestionsExcept(func(term string) bool) (int, error) {
+	return 0, nil
+}
+
+func (m *memoryTarget) GetSuggestion(string) (models.Suggestion, bool) {
+	return models.Suggestion{}, false
+}
+
+func (m *memoryTarget) SuggestionCount() int {
+	return len(m.suggestions)
+}
+
+func testSuggestions() []models.Suggestion {
+	return []models.Suggestion{
+		{Term: "apple pie", Frequency: 50, Score: 1.25, Category: "food", UpdatedAt: time.Date(2024, 1, 15, 10, 30, 0, 500, time.UTC), Metadata: map[string]string{"brand": "acme", "note": "a, \"quoted\" <b>"}},
+		{Term: "Application", Frequency: 100},
+		{Term: "apricot", Frequency: 7, Category: "fruit", Metadata: map[string]string{"origin": "spain"}},
+	}
+}
+
+func TestWrite_RoundTrip(t *testing.T) {
+	for _, format := range []importer.Format{importer.FormatJSONL, importer.FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := Write(&buf, format, slices.Values(testSuggestions()))
+			require.NoError(t, err)
+			assert.Equal(t, 3, n)
+
+			target := &memoryTarget{}
+			report, err := importer.New(target, importer.Options{Format: format}).Import(context.Background(), &buf)
+			require.NoError(t, err)
+			assert.Empty(t, report.Errors)
+			assert.Equal(t, testSuggestions(), target.suggestions)
+		})
+	}
+}
+
+func TestWrite_Layout(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := Write(&buf, importer.FormatCSV, slices.Values(testSuggestions()))
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 4)
+	assert.Equal(t, "term,frequency,score,category,updated_at,metadata", lines[0])
+	assert.Equal(t, "Application,100,0,,,", lines[2])
+	assert.Equal(t, `apricot,7,0,fruit,,"{""origin"":""spain""}"`, lines[3], "metadata is one JSON object")
+
+	buf.Reset()
+	_, err = Write(&buf, importer.FormatJSONL, slices.Values(testSuggestions()[1:2]))
+	require.NoError(t, err)
+	assert.Equal(t, "{\"term\":\"Application\",\"frequency\":100,\"score\":0}\n", buf.String())
+
+	_, err = Write(&buf, importer.FormatTSV, nil)
+	assert.Error(t, err)
+}
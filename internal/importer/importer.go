@@ -0,0 +1,264 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+	"github.com/alexnthnz/search-autocomplete/pkg/utils"
+)
+
+// Mode decides what happens to stored suggestions missing from the file
+type Mode string
+
+const (
+	ModeUpsert  Mode = "upsert"  // Add new terms and replace existing ones, keep the rest
+	ModeReplace Mode = "replace" // Like upsert, then delete every term not in the file
+)
+
+// Limits on the optional fields of a row
+const (
+	maxMetadataEntries    = 32
+	maxMetadataKeyBytes   = 64
+	maxMetadataValueBytes = 1024
+)
+
+// ErrInvalidFile is returned when an import file can't be read at all, as
+// opposed to having invalid rows
+var ErrInvalidFile = errors.New("invalid import file")
+
+// ParseMode parses a mode name
+func ParseMode(name string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(name))) {
+	case "", ModeUpsert:
+		return ModeUpsert, nil
+	case ModeReplace:
+		return ModeReplace, nil
+	default:
+		return "", fmt.Errorf("unknown import mode %q", name)
+	}
+}
+
+// Target is where imported suggestions are stored
+type Target interface {
+	UpsertSuggestions(suggestions []models.Suggestion) (added, updated int, err error)
+	RemoveSuggestionsExcept(keep func(term string) bool) (int, error)
+	GetSuggestion(term string) (models.Suggestion, bool)
+	SuggestionCount() int
+}
+
+// Options controls an import
+type Options struct {
+	Format    Format
+	Mode      Mode
+	DryRun    bool // Validate and count changes without storing anything
+	BatchSize int  // Suggestions stored per batch
+	MaxErrors int  // Row errors listed in the report; all are counted
+}
+
+// RowError describes a row that was rejected
+type RowError struct {
+	Line  int    `json:"line"`
+	Term  string `json:"term,omitempty"`
+	Error string `json:"error"`
+}
+
+// Report summarizes an import. A term repeated in the file counts once as
+// added or updated and then as updated for each repeat; the last row wins.
+type Report struct {
+	Format         Format     `json:"format"`
+	Mode           Mode       `json:"mode"`
+	DryRun         bool       `json:"dry_run"`
+	Rows           int        `json:"rows"`
+	Valid          int        `json:"valid"`
+	Invalid        int        `json:"invalid"`
+	Duplicates     int        `json:"duplicates"`
+	Added          int        `json:"added"`
+	Updated        int        `json:"updated"`
+	Removed        int        `json:"removed"`
+	ReplaceSkipped bool       `json:"replace_skipped,omitempty"` // Replace mode deletes nothing unless every row was valid
+	Errors         []RowError `json:"errors,omitempty"`
+}
+
+// Importer streams suggestions from a file into a target
+type Importer struct {
+	target  Target
+	options Options
+}
+
+// New creates an importer. With a nil target rows are only validated.
+func New(target Target, options Options) *Importer {
+	if options.Mode == "" {
+		options.Mode = ModeUpsert
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 1000
+	}
+	if options.MaxErrors <= 0 {
+		options.MaxErrors = 100
+	}
+	if target == nil {
+		options.DryRun = true
+	}
+
+	return &Importer{target: target, options: options}
+}
+
+// Import reads every row from r. Rows that fail validation are reported and
+// skipped; the returned error is for problems that stop the import, such as
+// an unreadable header or a failure to store a batch.
+func (i *Importer) Import(ctx context.Context, r io.Reader) (*Report, error) {
+	report := &Report{Format: i.options.Format, Mode: i.options.Mode, DryRun: i.options.DryRun}
+
+	reader, err := newRowReader(i.options.Format, r)
+	if err != nil {
+		return report, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+
+	seen := make(map[string]struct{})
+	existing := 0 // Stored terms that appear in the file
+	batch := make([]models.Suggestion, 0, i.options.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		added, updated, err := i.target.UpsertSuggestions(batch)
+		report.Added += added
+		report.Updated += updated
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		row, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		report.Rows++
+
+		if row.err == nil {
+			row.err = validate(row.suggestion)
+		}
+		if row.err != nil {
+			report.Invalid++
+			if len(report.Errors) < i.options.MaxErrors {
+				report.Errors = append(report.Errors, RowError{Line: row.line, Term: row.suggestion.Term, Error: row.err.Error()})
+			}
+			continue
+		}
+		report.Valid++
+
+		key := strings.ToLower(row.suggestion.Term)
+		_, duplicate := seen[key]
+		stored := false
+		if duplicate {
+			report.Duplicates++
+		} else {
+			seen[key] = struct{}{}
+			if _, stored = i.lookup(key); stored {
+				existing++
+			}
+		}
+
+		if i.options.DryRun {
+			if stored || duplicate {
+				report.Updated++
+			} else {
+				report.Added++
+			}
+			continue
+		}
+
+		batch = append(batch, row.suggestion)
+		if len(batch) >= i.options.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if !i.options.DryRun {
+		if err := flush(); err != nil {
+			return report, err
+		}
+	}
+
+	if i.options.Mode != ModeReplace || i.target == nil {
+		return report, nil
+	}
+	if report.Invalid > 0 {
+		report.ReplaceSkipped = true
+		return report, nil
+	}
+
+	if i.options.DryRun {
+		report.Removed = i.target.SuggestionCount() - existing
+		return report, nil
+	}
+
+	keep := func(term string) bool {
+		_, ok := seen[strings.ToLower(term)]
+		return ok
+	}
+	if report.Removed, err = i.target.RemoveSuggestionsExcept(keep); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// lookup finds a stored suggestion, reporting none without a target
+func (i *Importer) lookup(term string) (models.Suggestion, bool) {
+	if i.target == nil {
+		return models.Suggestion{}, false
+	}
+	return i.target.GetSuggestion(term)
+}
+
+// validate checks a parsed suggestion
+func validate(suggestion models.Suggestion) error {
+	if err := utils.ValidateTerm(suggestion.Term); err != nil {
+		return err
+	}
+	if suggestion.Frequency < 0 {
+		return errors.New("frequency cannot be negative")
+	}
+	if suggestion.Score < 0 || math.IsNaN(suggestion.Score) || math.IsInf(suggestion.Score, 0) {
+		return errors.New("score must be a non-negative number")
+	}
+	if err := utils.ValidateCategory(suggestion.Category); err != nil {
+		return err
+	}
+
+	if len(suggestion.Metadata) > maxMetadataEntries {
+		return fmt.Errorf("more than %d metadata entries", maxMetadataEntries)
+	}
+	for key, value := range suggestion.Metadata {
+		if key == "" || len(key) > maxMetadataKeyBytes {
+			return fmt.Errorf("metadata keys must be 1 to %d bytes", maxMetadataKeyBytes)
+		}
+		if isColumn(strings.ToLower(key)) {
+			return fmt.Errorf("metadata key %q is a reserved column name", key)
+		}
+		if len(value) > maxMetadataValueBytes {
+			return fmt.Errorf("metadata value for %q is too long", key)
+		}
+		if !utf8.ValidString(key) || !utf8.ValidString(value) {
+			return errors.New("metadata is not valid UTF-8")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package importer
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// memoryTarget stores suggestions in a map keyed by lower case term
+type memoryTarget struct {
+	suggestions map[string]models.Suggestion
+	batches     int
+}
+
+func newMemoryTarget(terms ...string) *memoryTarget {
+	target := &memoryTarget{suggestions: make(map[string]models.Suggestion)}
+	for _, term := range terms {
+		target.suggestions[term] = models.Suggestion{Term: term, Frequency: 1}
+	}
+	return target
+}
+
+func (m *memoryTarget) UpsertSuggestions(suggestions []models.Suggestion) (added, updated int, err error) {
+	m.batches++
+	for _, suggestion := range suggestions {
+		key := strings.ToLower(suggestion.Term)
+		if _, ok := m.suggestions[key]; ok {
+			updated++
+		} else {
+			added++
+		}
+		m.suggestions[key] = suggestion
+	}
+	return added, updated, nil
+}
+
+func (m *memoryTarget) RemoveSuggestionsExcept(keep func(term string) bool) (int, error) {
+	removed := 0
+	for term := range m.suggestions {
+		if !keep(term) {
+			delete(m.suggestions, term)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryTarget) GetSuggestion(term string) (models.Suggestion, bool) {
+	suggestion, ok := m.suggestions[strings.ToLower(term)]
+	return suggestion, ok
+}
+
+func (m *memoryTarget) SuggestionCount() int {
+	return len(m.suggestions)
+}
+
+func TestImport_Formats(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"csv", FormatCSV, "\ufeffTerm,Frequency,Category,Brand\nkiwi,300,fruit,acme\n\"melon, honeydew\",20,fruit,\n"},
+		{"tsv", FormatTSV, "term\tfrequency\tcategory\tbrand\nkiwi\t300\tfruit\tacme\nmelon, honeydew\t20\tfruit\t\n"},
+		{"csv metadata column", FormatCSV, "term,frequency,category,metadata\nkiwi,300,fruit,\"{\"\"brand\"\":\"\"acme\"\"}\"\n\"melon, honeydew\",20,fruit,\n"},
+		{"jsonl", FormatJSONL, "{\"term\":\"kiwi\",\"frequency\":300,\"category\":\"fruit\",\"metadata\":{\"brand\":\"acme\"}}\n\n{\"term\":\"melon, honeydew\",\"frequency\":20,\"category\":\"fruit\"}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := newMemoryTarget()
+			report, err := New(target, Options{Format: tt.format}).Import(context.Background(), strings.NewReader(tt.input))
+			require.NoError(t, err)
+
+			assert.Equal(t, 2, report.Rows)
+			assert.Equal(t, 2, report.Added)
+			assert.Empty(t, report.Errors)
+			assert.Equal(t, models.Suggestion{Term: "kiwi", Frequency: 300, Category: "fruit", Metadata: map[string]string{"brand": "acme"}}, target.suggestions["kiwi"])
+			assert.Nil(t, target.suggestions["melon, honeydew"].Metadata, "empty columns are not metadata")
+		})
+	}
+}
+
+func TestImport_ValidationReport(t *testing.T) {
+	input := strings.Join([]string{
+		"term,frequency,score",
+		"kiwi,10,",
+		",5,",
+		"<script>,1,",
+		"mango,abc,",
+		"papaya,-1,",
+		"kiwi,12,",
+		"lime,1,2,3",
+	}, "\n")
+
+	target := newMemoryTarget("kiwi")
+	report, err := New(target, Options{Format: FormatCSV, MaxErrors: 3}).Import(context.Background(), strings.NewReader(input))
+	require.NoError(t, err)
+
+	assert.Equal(t, 7, report.Rows)
+	assert.Equal(t, 2, report.Valid)
+	assert.Equal(t, 5, report.Invalid)
+	assert.Equal(t, 1, report.Duplicates)
+	assert.Equal(t, 2, report.Updated, "a repeated term replaces the earlier row")
+	assert.Equal(t, int64(12), target.suggestions["kiwi"].Frequency)
+
+	require.Len(t, report.Errors, 3, "errors listed are capped")
+	assert.Equal(t, RowError{Line: 3, Error: "term cannot be empty"}, report.Errors[0])
+	assert.Equal(t, 4, report.Errors[1].Line)
+	assert.Equal(t, RowError{Line: 5, Term: "mango", Error: `invalid frequency "abc"`}, report.Errors[2])
+}
+
+func TestImport_Modes(t *testing.T) {
+	input := "term,frequency\nkiwi,10\nmango,5\n"
+
+	// A dry run reports the same counts without storing anything
+	target := newMemoryTarget("kiwi", "apple", "banana")
+	report, err := New(target, Options{Format: FormatCSV, Mode: ModeReplace, DryRun: true}).Import(context.Background(), strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, Report{Format: FormatCSV, Mode: ModeReplace, DryRun: true, Rows: 2, Valid: 2, Added: 1, Updated: 1, Removed: 2}, *report)
+	assert.Len(t, target.suggestions, 3)
+	assert.Zero(t, target.batches)
+
+	report, err = New(target, Options{Format: FormatCSV, Mode: ModeReplace, BatchSize: 1}).Import(context.Background(), strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, Report{Format: FormatCSV, Mode: ModeReplace, Rows: 2, Valid: 2, Added: 1, Updated: 1, Removed: 2}, *report)
+	assert.Len(t, target.suggestions, 2)
+	assert.Equal(t, 2, target.batches)
+
+	// Upsert keeps terms missing from the file
+	target = newMemoryTarget("apple")
+	report, err = New(target, Options{Format: FormatCSV}).Import(context.Background(), strings.NewReader(input))
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Removed)
+	assert.Len(t, target.suggestions, 3)
+
+	// Replace deletes nothing when any row was rejected
+	target = newMemoryTarget("apple")
+	report, err = New(target, Options{Format: FormatCSV, Mode: ModeReplace}).Import(context.Background(), strings.NewReader(input+"<b>,1\n"))
+	require.NoError(t, err)
+	assert.True(t, report.ReplaceSkipped)
+	assert.Contains(t, target.suggestions, "apple")
+}
+
+func TestImport_InvalidFile(t *testing.T) {
+	for _, input := range []string{"", "frequency,category\n10,fruit\n", "term,term\nkiwi,kiwi\n"} {
+		_, err := New(newMemoryTarget(), Options{Format: FormatCSV}).Import(context.Background(), strings.NewReader(input))
+		assert.ErrorIs(t, err, ErrInvalidFile, "input %q", input)
+	}
+
+	report, err := New(nil, Options{Format: FormatJSONL}).Import(context.Background(), strings.NewReader("{\"term\":\"kiwi\",\"popularity\":1}\n"))
+	require.NoError(t, err, "bad records are row errors")
+	assert.True(t, report.DryRun, "without a target rows are only validated")
+	assert.Equal(t, 1, report.Invalid)
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := FormatFromPath("data/corpus.NDJSON")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSONL, format)
+
+	_, err = FormatFromPath("corpus")
+	assert.Error(t, err)
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+
+	format, ok := FormatFromContentType("text/csv; charset=utf-8")
+	assert.True(t, ok)
+	assert.Equal(t, FormatCSV, format)
+	_, ok = FormatFromContentType("application/json")
+	assert.False(t, ok)
+}
@@ -0,0 +1,302 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Format is the layout of an import file
+type Format string
+
+const (
+	FormatCSV   Format = "csv"   // Comma-separated with a header row
+	FormatTSV   Format = "tsv"   // Tab-separated with a header row
+	FormatJSONL Format = "jsonl" // One JSON suggestion per line
+)
+
+// maxLineBytes bounds a single JSON Lines record
+const maxLineBytes = 1 << 20
+
+// ParseFormat parses a format name
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "csv":
+		return FormatCSV, nil
+	case "tsv", "tab":
+		return FormatTSV, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	default:
+		return "", fmt.Errorf("unknown import format %q", name)
+	}
+}
+
+// FormatFromPath picks a format from a file extension
+func FormatFromPath(path string) (Format, error) {
+	ext := strings.TrimPrefix(filepath.Ext(path), ".")
+	if ext == "" {
+		return "", fmt.Errorf("cannot tell the format of %q, set it explicitly", path)
+	}
+	return ParseFormat(ext)
+}
+
+// FormatFromContentType picks a format from a MIME type
+func FormatFromContentType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", false
+	}
+
+	switch mediaType {
+	case "text/csv":
+		return FormatCSV, true
+	case "text/tab-separated-values":
+		return FormatTSV, true
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines":
+		return FormatJSONL, true
+	default:
+		return "", false
+	}
+}
+
+// ContentType returns the MIME type of a format
+func (f Format) ContentType() string {
+	switch f {
+	case FormatTSV:
+		return "text/tab-separated-values"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	default:
+		return "text/csv"
+	}
+}
+
+// row is one record read from an import file. err is set when the record
+// could be read but not parsed.
+type row struct {
+	line       int
+	suggestion models.Suggestion
+	err        error
+}
+
+// rowReader reads records one at a time. It returns io.EOF at the end and
+// any other error when the file can't be read any further.
+type rowReader interface {
+	next() (row, error)
+}
+
+// newRowReader returns a reader for the given format
+func newRowReader(format Format, r io.Reader) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newDelimitedReader(r, ',')
+	case FormatTSV:
+		return newDelimitedReader(r, '\t')
+	case FormatJSONL:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+		return &jsonLinesReader{scanner: scanner}, nil
+	default:
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+}
+
+// Known columns of delimited files. Any other column is stored as metadata,
+// as are the entries of a JSON object in the metadata column.
+const (
+	columnTerm      = "term"
+	columnFrequency = "frequency"
+	columnScore     = "score"
+	columnCategory  = "category"
+	columnUpdatedAt = "updated_at"
+	columnMetadata  = "metadata"
+)
+
+// isColumn reports whether name is a known column, which metadata keys may
+// not shadow
+func isColumn(name string) bool {
+	switch name {
+	case columnTerm, columnFrequency, columnScore, columnCategory, columnUpdatedAt, columnMetadata:
+		return true
+	}
+	return false
+}
+
+// delimitedReader reads CSV and TSV files. The first row names the columns.
+type delimitedReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newDelimitedReader(r io.Reader, comma rune) (*delimitedReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.LazyQuotes = comma == '\t'
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid header: %w", err)
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "" {
+			return nil, fmt.Errorf("invalid header: column %d has no name", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid header: duplicate column %q", name)
+		}
+		seen[name] = true
+		columns[i] = name
+	}
+	if !seen[columnTerm] {
+		return nil, fmt.Errorf("invalid header: missing %q column", columnTerm)
+	}
+
+	return &delimitedReader{reader: reader, columns: columns}, nil
+}
+
+func (d *delimitedReader) next() (row, error) {
+	record, err := d.reader.Read()
+	if err == io.EOF {
+		return row{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		// The reader moves on to the next record after a parse error
+		return row{line: parseErr.StartLine, err: parseErr.Err}, nil
+	}
+	if err != nil {
+		return row{}, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	r := row{line: line}
+	for i, value := range record {
+		value = strings.TrimSpace(value)
+		switch d.columns[i] {
+		case columnTerm:
+			r.suggestion.Term = value
+		case columnFrequency:
+			if value == "" {
+				continue
+			}
+			if r.suggestion.Frequency, err = strconv.ParseInt(value, 10, 64); err != nil {
+				r.err = fmt.Errorf("invalid frequency %q", value)
+			}
+		case columnScore:
+			if value == "" {
+				continue
+			}
+			if r.suggestion.Score, err = strconv.ParseFloat(value, 64); err != nil {
+				r.err = fmt.Errorf("invalid score %q", value)
+			}
+		case columnCategory:
+			r.suggestion.Category = value
+		case columnUpdatedAt:
+			if value == "" {
+				continue
+			}
+			if r.suggestion.UpdatedAt, err = time.Parse(time.RFC3339Nano, value); err != nil {
+				r.err = fmt.Errorf("invalid updated_at %q", value)
+			}
+		case columnMetadata:
+			if value == "" {
+				continue
+			}
+			var metadata map[string]string
+			if err := json.Unmarshal([]byte(value), &metadata); err != nil {
+				r.err = errors.New("metadata must be a JSON object of strings")
+				continue
+			}
+			if r.suggestion.Metadata == nil {
+				r.suggestion.Metadata = make(map[string]string, len(metadata))
+			}
+			for key, v := range metadata {
+				r.suggestion.Metadata[key] = v
+			}
+		default:
+			if value == "" {
+				continue
+			}
+			if r.suggestion.Metadata == nil {
+				r.suggestion.Metadata = make(map[string]string)
+			}
+			r.suggestion.Metadata[d.columns[i]] = value
+		}
+	}
+
+	return r, nil
+}
+
+// jsonLinesReader reads one JSON object per line, skipping blank lines
+type jsonLinesReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// jsonRecord is the shape of a JSON Lines record
+type jsonRecord struct {
+	Term      string            `json:"term"`
+	Frequency int64             `json:"frequency"`
+	Score     float64           `json:"score"`
+	Category  string            `json:"category"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+func (j *jsonLinesReader) next() (row, error) {
+	for j.scanner.Scan() {
+		j.line++
+		line := bytes.TrimSpace(j.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record jsonRecord
+		decoder := json.NewDecoder(bytes.NewReader(line))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&record); err != nil {
+			return row{line: j.line, err: fmt.Errorf("invalid JSON: %w", err)}, nil
+		}
+		if decoder.More() {
+			return row{line: j.line, err: errors.New("invalid JSON: more than one value on the line")}, nil
+		}
+
+		return row{line: j.line, suggestion: models.Suggestion{
+			Term:      strings.TrimSpace(record.Term),
+			Frequency: record.Frequency,
+			Score:     record.Score,
+			Category:  strings.TrimSpace(record.Category),
+			UpdatedAt: record.UpdatedAt,
+			Metadata:  record.Metadata,
+		}}, nil
+	}
+
+	if err := j.scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return row{}, fmt.Errorf("line %d is longer than %d bytes", j.line+1, maxLineBytes)
+		}
+		return row{}, err
+	}
+	return row{}, io.EOF
+}
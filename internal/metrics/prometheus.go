@@ -21,9 +21,13 @@ type Metrics struct {
 	ActiveRequests  prometheus.Gauge
 
 	// Cache metrics
-	CacheHitsTotal   *prometheus.CounterVec
-	CacheMissesTotal *prometheus.CounterVec
-	CacheOperations  *prometheus.HistogramVec
+	CacheHitsTotal     *prometheus.CounterVec
+	CacheMissesTotal   *prometheus.CounterVec
+	CacheOperations    *prometheus.HistogramVec
+	CacheEvictions     *prometheus.CounterVec
+	CacheEntries       *prometheus.GaugeVec
+	CacheBytes         *prometheus.GaugeVec
+	CacheInvalidations *prometheus.CounterVec
 
 	// Trie metrics
 	TrieSearches *prometheus.CounterVec
@@ -40,6 +44,9 @@ type Metrics struct {
 	PipelineQueueSize prometheus.Gauge
 	PipelineLatency   *prometheus.HistogramVec
 
+	// Persistence metrics
+	SnapshotDuration prometheus.Histogram
+
 	// Error metrics
 	ErrorsTotal *prometheus.CounterVec
 }
@@ -94,6 +101,34 @@ func NewMetrics() *Metrics {
 				},
 				[]string{"operation", "cache_type"},
 			),
+			CacheEvictions: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "autocomplete_cache_evictions_total",
+					Help: "Total number of cache entries evicted",
+				},
+				[]string{"cache_type", "reason"},
+			),
+			CacheEntries: promauto.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: "autocomplete_cache_entries",
+					Help: "Current number of cached entries",
+				},
+				[]string{"cache_type"},
+			),
+			CacheBytes: promauto.NewGaugeVec(
+				prometheus.GaugeOpts{
+					Name: "autocomplete_cache_bytes",
+					Help: "Approximate memory held by cached entries",
+				},
+				[]string{"cache_type"},
+			),
+			CacheInvalidations: promauto.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "autocomplete_cache_invalidations_total",
+					Help: "Total number of cache invalidations broadcast between instances",
+				},
+				[]string{"direction"},
+			),
 
 			// Trie metrics
 			TrieSearches: promauto.NewCounterVec(
@@ -159,6 +194,15 @@ func NewMetrics() *Metrics {
 				[]string{"stage"},
 			),
 
+			// Persistence metrics
+			SnapshotDuration: promauto.NewHistogram(
+				prometheus.HistogramOpts{
+					Name:    "autocomplete_snapshot_duration_seconds",
+					Help:    "Time taken to write index snapshots",
+					Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+				},
+			),
+
 			// Error metrics
 			ErrorsTotal: promauto.NewCounterVec(
 				prometheus.CounterOpts{
@@ -203,6 +247,22 @@ func (m *Metrics) RecordCacheOperation(operation, cacheType string, duration tim
 	m.CacheOperations.WithLabelValues(operation, cacheType).Observe(duration.Seconds())
 }
 
+// RecordCacheEviction records a cache entry evicted for a reason
+func (m *Metrics) RecordCacheEviction(cacheType, reason string) {
+	m.CacheEvictions.WithLabelValues(cacheType, reason).Inc()
+}
+
+// UpdateCacheSize updates the cache size gauges
+func (m *Metrics) UpdateCacheSize(cacheType string, entries int, bytes int64) {
+	m.CacheEntries.WithLabelValues(cacheType).Set(float64(entries))
+	m.CacheBytes.WithLabelValues(cacheType).Set(float64(bytes))
+}
+
+// RecordCacheInvalidation records an invalidation published or received
+func (m *Metrics) RecordCacheInvalidation(direction string) {
+	m.CacheInvalidations.WithLabelValues(direction).Inc()
+}
+
 // RecordTrieSearch records a trie search
 func (m *Metrics) RecordTrieSearch(resultCount int) {
 	var label string
@@ -259,6 +319,11 @@ func (m *Metrics) RecordPipelineLatency(stage string, duration time.Duration) {
 	m.PipelineLatency.WithLabelValues(stage).Observe(duration.Seconds())
 }
 
+// RecordSnapshot records a completed index snapshot
+func (m *Metrics) RecordSnapshot(duration time.Duration) {
+	m.SnapshotDuration.Observe(duration.Seconds())
+}
+
 // RecordError records an error
 func (m *Metrics) RecordError(errorType, component string) {
 	m.ErrorsTotal.WithLabelValues(errorType, component).Inc()
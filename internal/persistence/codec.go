@@ -0,0 +1,209 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// maxStringBytes bounds length-prefixed strings so a corrupt length can't
+// trigger a huge allocation
+const maxStringBytes = 1 << 20
+
+// maxMetadataEntries bounds a suggestion's metadata for the same reason
+const maxMetadataEntries = 1 << 10
+
+var (
+	errStringTooLong   = errors.New("encoded string too long")
+	errTooManyMetadata = errors.New("too many metadata entries")
+)
+
+// encoder writes the binary primitives used by the on-disk formats. The
+// first error sticks and turns every later call into a no-op.
+type encoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *encoder) uint16(v uint16) {
+	binary.BigEndian.PutUint16(e.buf[:2], v)
+	e.bytes(e.buf[:2])
+}
+
+func (e *encoder) uint64(v uint64) {
+	binary.BigEndian.PutUint64(e.buf[:8], v)
+	e.bytes(e.buf[:8])
+}
+
+func (e *encoder) int64(v int64) {
+	e.uint64(uint64(v))
+}
+
+func (e *encoder) varint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.bytes(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	n := binary.PutUvarint(e.buf[:], uint64(len(s)))
+	e.bytes(e.buf[:n])
+	e.bytes([]byte(s))
+}
+
+func (e *encoder) time(t time.Time) {
+	if t.IsZero() {
+		e.varint(0)
+		return
+	}
+	e.varint(t.UnixNano())
+}
+
+func (e *encoder) suggestion(s models.Suggestion) {
+	e.string(s.Term)
+	e.varint(s.Frequency)
+	e.uint64(math.Float64bits(s.Score))
+	e.string(s.Category)
+	e.time(s.UpdatedAt)
+}
+
+// metadata writes a count followed by key/value pairs in key order, so equal
+// maps always encode the same way
+func (e *encoder) metadata(m map[string]string) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	n := binary.PutUvarint(e.buf[:], uint64(len(keys)))
+	e.bytes(e.buf[:n])
+	for _, key := range keys {
+		e.string(key)
+		e.string(m[key])
+	}
+}
+
+// decoder reads the primitives written by encoder, feeding every byte it
+// consumes into checksum when one is set
+type decoder struct {
+	r        *bufio.Reader
+	checksum hash.Hash32
+	err      error
+}
+
+func (d *decoder) ReadByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err == nil && d.checksum != nil {
+		d.checksum.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	if _, d.err = io.ReadFull(d.r, b); d.err == nil && d.checksum != nil {
+		d.checksum.Write(b)
+	}
+	return b
+}
+
+func (d *decoder) uint16() uint16 {
+	b := d.bytes(2)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.bytes(8)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) int64() int64 {
+	return int64(d.uint64())
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	var v int64
+	v, d.err = binary.ReadVarint(d)
+	return v
+}
+
+func (d *decoder) string() string {
+	if d.err != nil {
+		return ""
+	}
+	var n uint64
+	if n, d.err = binary.ReadUvarint(d); d.err != nil {
+		return ""
+	}
+	if n > maxStringBytes {
+		d.err = errStringTooLong
+		return ""
+	}
+	return string(d.bytes(int(n)))
+}
+
+func (d *decoder) time() time.Time {
+	nanos := d.varint()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+func (d *decoder) suggestion() models.Suggestion {
+	return models.Suggestion{
+		Term:      d.string(),
+		Frequency: d.varint(),
+		Score:     math.Float64frombits(d.uint64()),
+		Category:  d.string(),
+		UpdatedAt: d.time(),
+	}
+}
+
+// metadata reads what encoder.metadata wrote, returning nil for no entries
+func (d *decoder) metadata() map[string]string {
+	if d.err != nil {
+		return nil
+	}
+	var n uint64
+	if n, d.err = binary.ReadUvarint(d); d.err != nil || n == 0 {
+		return nil
+	}
+	if n > maxMetadataEntries {
+		d.err = errTooManyMetadata
+		return nil
+	}
+
+	m := make(map[string]string, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		key := d.string()
+		m[key] = d.string()
+	}
+	return m
+}
@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// frameHeaderSize is the length and CRC-32 that precede every entry
+	frameHeaderSize = 8
+	maxEntryBytes   = 4 << 20
+)
+
+// errTornFrame means a frame was cut short or fails its checksum
+var errTornFrame = errors.New("torn or corrupt frame")
+
+// frame prefixes a payload with its length and checksum:
+//
+//	length  uint32 (big endian, payload bytes)
+//	crc     uint32 (CRC-32 IEEE of the payload)
+func frame(payload []byte) []byte {
+	framed := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(framed[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(framed[4:], crc32.ChecksumIEEE(payload))
+	return append(framed, payload...)
+}
+
+// readFrame reads the next frame's payload. It returns io.EOF at a clean end
+// of input and errTornFrame when the input ends mid-frame or the frame is
+// damaged.
+func readFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errTornFrame
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > maxEntryBytes {
+		return nil, errTornFrame
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, errTornFrame
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errTornFrame
+	}
+	return payload, nil
+}
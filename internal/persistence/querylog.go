@@ -0,0 +1,473 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+const (
+	querySegmentPrefix = "query-"
+	offsetPrefix       = "consumer-"
+	offsetSuffix       = ".offset"
+)
+
+var (
+	ErrCorruptQueryLog = errors.New("corrupt query log")
+	ErrQueryLogClosed  = errors.New("query log is closed")
+)
+
+// QueryLogKind identifies what a query log entry records
+type QueryLogKind uint8
+
+const (
+	QueryLogSearch QueryLogKind = iota
+	QueryLogSelection
+)
+
+// QueryLogEntry is a search or a selection stored at an offset in the query
+// log
+type QueryLogEntry struct {
+	Offset    uint64
+	Kind      QueryLogKind
+	Log       models.SearchLog    // QueryLogSearch
+	Selection models.SelectionLog // QueryLogSelection
+}
+
+// QueryLogConfig holds query log configuration
+type QueryLogConfig struct {
+	Dir          string
+	SegmentBytes int64         // Size at which a new segment is started
+	Retention    time.Duration // How long consumed segments are kept for replay
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+}
+
+// QueryLog is a durable, append-only log of search logs and selections split
+// into segment files. Entries are numbered by offset, starting at 1.
+// Consumers record the offset they have fully processed so they can resume
+// after a restart, and segments are only deleted once every consumer is past
+// them and they are older than the retention period. Frames use the same
+// layout as the WAL.
+type QueryLog struct {
+	segmentLog // Numbered by offset
+
+	segmentBytes int64
+	retention    time.Duration
+	appended     chan struct{} // Closed and replaced on every append
+}
+
+// OpenQueryLog opens the log in config.Dir, creating it if needed. A torn
+// entry at the end of the newest segment is truncated.
+func OpenQueryLog(config QueryLogConfig, logger *logrus.Logger) (*QueryLog, error) {
+	if config.SegmentBytes <= 0 {
+		config.SegmentBytes = 64 << 20
+	}
+	if config.Retention <= 0 {
+		config.Retention = 7 * 24 * time.Hour
+	}
+	if config.SyncPolicy == "" {
+		config.SyncPolicy = SyncInterval
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = time.Second
+	}
+
+	l := &QueryLog{
+		segmentLog: segmentLog{
+			dir:        config.Dir,
+			prefix:     querySegmentPrefix,
+			name:       "query log",
+			errCorrupt: ErrCorruptQueryLog,
+			policy:     config.SyncPolicy,
+			logger:     logger,
+		},
+		segmentBytes: config.SegmentBytes,
+		retention:    config.Retention,
+		appended:     make(chan struct{}),
+	}
+	if err := l.open(config.SyncInterval); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Append writes a search log to the log and returns its offset
+func (l *QueryLog) Append(log models.SearchLog) (uint64, error) {
+	return l.append(QueryLogEntry{Kind: QueryLogSearch, Log: log})
+}
+
+// AppendSelection writes a picked suggestion to the log and returns its
+// offset
+func (l *QueryLog) AppendSelection(selection models.SelectionLog) (uint64, error) {
+	return l.append(QueryLogEntry{Kind: QueryLogSelection, Selection: selection})
+}
+
+// append writes an entry to the log, assigning it the next offset
+func (l *QueryLog) append(entry QueryLogEntry) (uint64, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.closed {
+		return 0, ErrQueryLogClosed
+	}
+
+	if l.segmentSize >= l.segmentBytes {
+		if err := l.rollLocked(); err != nil {
+			return 0, err
+		}
+	}
+
+	entry.Offset = l.last + 1
+	if err := l.appendLocked(encodeQueryLogEntry(entry)); err != nil {
+		return 0, err
+	}
+
+	close(l.appended)
+	l.appended = make(chan struct{})
+
+	return entry.Offset, nil
+}
+
+// LastOffset returns the offset of the most recent entry, 0 if the log has
+// never been written to
+func (l *QueryLog) LastOffset() uint64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.last
+}
+
+// Commit records that consumer has processed every entry up to offset
+func (l *QueryLog) Commit(consumer string, offset uint64) error {
+	path := l.offsetPath(consumer)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(offset, 10)), 0o644); err != nil {
+		return fmt.Errorf("failed to write consumer offset: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to install consumer offset: %w", err)
+	}
+	if err := syncDir(l.dir); err != nil {
+		return err
+	}
+
+	return l.cleanup(time.Now())
+}
+
+// Committed returns the last offset committed by consumer, 0 if none
+func (l *QueryLog) Committed(consumer string) (uint64, error) {
+	data, err := os.ReadFile(l.offsetPath(consumer))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read consumer offset: %w", err)
+	}
+
+	offset, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset for consumer %q: %w", consumer, err)
+	}
+	return offset, nil
+}
+
+// NewReader returns a reader positioned after the given offset. Pass 0 to
+// read from the oldest retained entry.
+func (l *QueryLog) NewReader(after uint64) *QueryLogReader {
+	return &QueryLogReader{log: l, after: after}
+}
+
+// Close flushes and closes the log
+func (l *QueryLog) Close() error {
+	l.mutex.Lock()
+	open, err := l.closeLocked()
+	if open {
+		close(l.appended) // Wake readers so they see the log is closed
+	}
+	l.mutex.Unlock()
+
+	if open {
+		l.stopSync()
+	}
+	return err
+}
+
+// cleanup deletes inactive segments that every consumer has processed and
+// that are older than the retention period
+func (l *QueryLog) cleanup(now time.Time) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	consumed, err := l.minCommittedLocked()
+	if err != nil {
+		return err
+	}
+
+	segments, err := l.segments()
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for i := 0; i < len(segments)-1; i++ {
+		// A segment ends right before the next one starts
+		if segments[i+1]-1 > consumed {
+			break
+		}
+		info, err := os.Stat(l.segmentPath(segments[i]))
+		if err != nil {
+			return fmt.Errorf("failed to stat query log segment: %w", err)
+		}
+		if now.Sub(info.ModTime()) < l.retention {
+			break
+		}
+		if err := os.Remove(l.segmentPath(segments[i])); err != nil {
+			return fmt.Errorf("failed to remove query log segment: %w", err)
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		l.logger.WithField("segments", removed).Debug("Removed expired query log segments")
+		return syncDir(l.dir)
+	}
+	return nil
+}
+
+// minCommittedLocked returns the lowest offset committed by any consumer
+func (l *QueryLog) minCommittedLocked() (uint64, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list consumer offsets: %w", err)
+	}
+
+	lowest := uint64(math.MaxUint64)
+	found := false
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, offsetPrefix) || !strings.HasSuffix(name, offsetSuffix) {
+			continue
+		}
+		offset, err := l.Committed(strings.TrimSuffix(strings.TrimPrefix(name, offsetPrefix), offsetSuffix))
+		if err != nil {
+			return 0, err
+		}
+		lowest = min(lowest, offset)
+		found = true
+	}
+
+	if !found {
+		return 0, nil
+	}
+	return lowest, nil
+}
+
+// offsetPath returns the file holding a consumer's committed offset
+func (l *QueryLog) offsetPath(consumer string) string {
+	return filepath.Join(l.dir, offsetPrefix+consumer+offsetSuffix)
+}
+
+// QueryLogReader reads a query log in order, following new appends
+type QueryLogReader struct {
+	log   *QueryLog
+	after uint64 // Offset of the last entry returned
+	start uint64 // Segment being read, 0 before the first read
+	file  *os.File
+	pos   int64
+}
+
+// Next returns the next entry without blocking. It returns false when the
+// reader has caught up with the log.
+func (r *QueryLogReader) Next() (QueryLogEntry, bool, error) {
+	for {
+		if r.file == nil {
+			ok, err := r.openNext()
+			if err != nil || !ok {
+				return QueryLogEntry{}, false, err
+			}
+		}
+
+		payload, err := readFrame(io.NewSectionReader(r.file, r.pos, math.MaxInt64-r.pos))
+		if err == nil {
+			entry, err := decodeQueryLogEntry(payload)
+			if err != nil {
+				return QueryLogEntry{}, false, ErrCorruptQueryLog
+			}
+			r.pos += int64(frameHeaderSize + len(payload))
+			if entry.Offset <= r.after {
+				continue
+			}
+			r.after = entry.Offset
+			return entry, true, nil
+		}
+
+		// The end of a segment, or an append still being written. Move on
+		// only once a later segment exists.
+		ok, err := r.openNext()
+		if err != nil || !ok {
+			return QueryLogEntry{}, false, err
+		}
+	}
+}
+
+// Wait blocks until the log has entries past the reader, the context is
+// done or the log is closed
+func (r *QueryLogReader) Wait(ctx context.Context) error {
+	r.log.mutex.Lock()
+	if r.log.closed {
+		r.log.mutex.Unlock()
+		return ErrQueryLogClosed
+	}
+	appended := r.log.appended
+	caughtUp := r.log.last <= r.after
+	r.log.mutex.Unlock()
+
+	if !caughtUp {
+		return nil
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-appended:
+		return nil
+	}
+}
+
+// Offset returns the offset of the last entry read
+func (r *QueryLogReader) Offset() uint64 {
+	return r.after
+}
+
+// Close releases the segment being read
+func (r *QueryLogReader) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// openNext opens the segment holding the entry after r.after, if it is not
+// the one already open. It returns false when there is nothing newer to
+// read.
+func (r *QueryLogReader) openNext() (bool, error) {
+	r.log.mutex.Lock()
+	segments, err := r.log.segments()
+	r.log.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+
+	// The last segment starting at or before the next offset holds it;
+	// earlier ones may have been removed, in which case reading resumes at
+	// the oldest retained entry
+	var next uint64
+	for _, start := range segments {
+		if start > r.after+1 && next != 0 {
+			break
+		}
+		next = start
+	}
+	if next == 0 || next == r.start {
+		return false, nil
+	}
+
+	file, err := os.Open(r.log.segmentPath(next))
+	if err != nil {
+		return false, fmt.Errorf("failed to open query log segment: %w", err)
+	}
+	r.Close()
+	r.file = file
+	r.start = next
+	r.pos = 0
+	return true, nil
+}
+
+// encodeQueryLogEntry serializes an entry as a frame. Every entry starts
+// with the fields of a search log; a selection fills in those it shares and
+// follows them with its kind and its own fields. Searches end after their
+// fields, as they did before selections were logged.
+func encodeQueryLogEntry(entry QueryLogEntry) []byte {
+	var payload bytes.Buffer
+	enc := &encoder{w: &payload}
+	enc.uint64(entry.Offset)
+
+	switch entry.Kind {
+	case QueryLogSelection:
+		enc.string(entry.Selection.Query)
+		enc.string(entry.Selection.UserID)
+		enc.string(entry.Selection.SessionID)
+		enc.time(entry.Selection.Timestamp)
+		enc.string("")
+		enc.bytes([]byte{byte(QueryLogSelection)})
+		enc.string(entry.Selection.Term)
+		enc.varint(int64(entry.Selection.Position))
+	default:
+		enc.string(entry.Log.Query)
+		enc.string(entry.Log.UserID)
+		enc.string(entry.Log.SessionID)
+		enc.time(entry.Log.Timestamp)
+		enc.string(entry.Log.IPAddress)
+	}
+	return frame(payload.Bytes())
+}
+
+// decodeQueryLogEntry parses an entry payload
+func decodeQueryLogEntry(payload []byte) (QueryLogEntry, error) {
+	dec := &decoder{r: bufio.NewReader(bytes.NewReader(payload))}
+	entry := QueryLogEntry{
+		Offset: dec.uint64(),
+		Kind:   QueryLogSearch,
+		Log: models.SearchLog{
+			Query:     dec.string(),
+			UserID:    dec.string(),
+			SessionID: dec.string(),
+			Timestamp: dec.time(),
+			IPAddress: dec.string(),
+		},
+	}
+	if dec.err != nil {
+		return entry, dec.err
+	}
+	if _, err := dec.r.Peek(1); err == io.EOF {
+		return entry, nil
+	}
+
+	kind := dec.bytes(1)
+	if dec.err != nil {
+		return entry, dec.err
+	}
+	switch QueryLogKind(kind[0]) {
+	case QueryLogSelection:
+		entry.Kind = QueryLogSelection
+		entry.Selection = models.SelectionLog{
+			Query:     entry.Log.Query,
+			Term:      dec.string(),
+			Position:  int(dec.varint()),
+			UserID:    entry.Log.UserID,
+			SessionID: entry.Log.SessionID,
+			Timestamp: entry.Log.Timestamp,
+		}
+		entry.Log = models.SearchLog{}
+	default:
+		return entry, fmt.Errorf("unknown query log entry kind %d", kind[0])
+	}
+	return entry, dec.err
+}
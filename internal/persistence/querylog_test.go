@@ -0,0 +1,200 @@
+package persistence
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+func openTestQueryLog(t *testing.T, dir string, segmentBytes int64) *QueryLog {
+	log, err := OpenQueryLog(QueryLogConfig{Dir: dir, SegmentBytes: segmentBytes, Retention: time.Hour, SyncPolicy: SyncAlways}, testLogger())
+	require.NoError(t, err)
+	return log
+}
+
+func readAll(t *testing.T, reader *QueryLogReader) []QueryLogEntry {
+	var entries []QueryLogEntry
+	for {
+		entry, ok, err := reader.Next()
+		require.NoError(t, err)
+		if !ok {
+			return entries
+		}
+		entries = append(entries, entry)
+	}
+}
+
+func TestQueryLog_AppendAndRead(t *testing.T) {
+	dir := t.TempDir()
+	log := openTestQueryLog(t, dir, 0)
+
+	at := time.Unix(0, time.Now().UnixNano())
+	offset, err := log.Append(models.SearchLog{Query: "apple", UserID: "alice", SessionID: "s-1", Timestamp: at, IPAddress: "10.0.0.1"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), offset)
+	_, err = log.Append(models.SearchLog{Query: "café", Timestamp: at})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	_, err = log.Append(models.SearchLog{Query: "banana"})
+	assert.ErrorIs(t, err, ErrQueryLogClosed)
+
+	// Reopening resumes numbering after the last entry
+	log = openTestQueryLog(t, dir, 0)
+	defer log.Close()
+	assert.Equal(t, uint64(2), log.LastOffset())
+
+	entries := readAll(t, log.NewReader(0))
+	require.Len(t, entries, 2)
+	assert.Equal(t, QueryLogEntry{Offset: 1, Log: models.SearchLog{Query: "apple", UserID: "alice", SessionID: "s-1", Timestamp: at, IPAddress: "10.0.0.1"}}, entries[0])
+	assert.Equal(t, "café", entries[1].Log.Query)
+
+	assert.Len(t, readAll(t, log.NewReader(1)), 1)
+}
+
+func TestQueryLog_Selections(t *testing.T) {
+	dir := t.TempDir()
+	log := openTestQueryLog(t, dir, 0)
+
+	at := time.Unix(0, time.Now().UnixNano())
+	selection := models.SelectionLog{Query: "app", Term: "Apple Pie", Position: 3, UserID: "alice", SessionID: "s-1", Timestamp: at}
+	_, err := log.Append(models.SearchLog{Query: "app", Timestamp: at})
+	require.NoError(t, err)
+	offset, err := log.AppendSelection(selection)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), offset, "searches and selections share offsets")
+	require.NoError(t, log.Close())
+
+	log = openTestQueryLog(t, dir, 0)
+	defer log.Close()
+
+	entries := readAll(t, log.NewReader(0))
+	require.Len(t, entries, 2)
+	assert.Equal(t, QueryLogSearch, entries[0].Kind)
+	assert.Equal(t, "app", entries[0].Log.Query)
+	assert.Equal(t, QueryLogEntry{Offset: 2, Kind: QueryLogSelection, Selection: selection}, entries[1])
+}
+
+func TestQueryLog_ReaderFollowsAppends(t *testing.T) {
+	log := openTestQueryLog(t, t.TempDir(), 64)
+	defer log.Close()
+
+	reader := log.NewReader(0)
+	defer reader.Close()
+	assert.Empty(t, readAll(t, reader))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, reader.Wait(ctx), context.DeadlineExceeded, "nothing to read yet")
+
+	// Small segments make the reader cross several of them
+	done := make(chan []QueryLogEntry)
+	go func() {
+		var entries []QueryLogEntry
+		for len(entries) < 10 {
+			if err := reader.Wait(context.Background()); err != nil {
+				break
+			}
+			for {
+				entry, ok, err := reader.Next()
+				if err != nil || !ok {
+					break
+				}
+				entries = append(entries, entry)
+			}
+		}
+		done <- entries
+	}()
+
+	for i := 0; i < 10; i++ {
+		_, err := log.Append(models.SearchLog{Query: "apple"})
+		require.NoError(t, err)
+	}
+
+	select {
+	case entries := <-done:
+		require.Len(t, entries, 10)
+		assert.Equal(t, uint64(10), entries[9].Offset)
+	case <-time.After(5 * time.Second):
+		t.Fatal("reader did not follow appends")
+	}
+
+	segments, err := log.segments()
+	require.NoError(t, err)
+	assert.Greater(t, len(segments), 1)
+}
+
+func TestQueryLog_CommitAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	log := openTestQueryLog(t, dir, 64)
+	defer log.Close()
+
+	for i := 0; i < 10; i++ {
+		_, err := log.Append(models.SearchLog{Query: "apple"})
+		require.NoError(t, err)
+	}
+	segments, err := log.segments()
+	require.NoError(t, err)
+	require.Greater(t, len(segments), 2)
+
+	offset, err := log.Committed("pipeline")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), offset)
+
+	// Segments newer than the retention period are kept for replay
+	require.NoError(t, log.Commit("pipeline", 10))
+	offset, err = log.Committed("pipeline")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(10), offset)
+	assert.Len(t, readAll(t, log.NewReader(0)), 10)
+
+	// Expired segments go once every consumer is past them
+	old := time.Now().Add(-2 * time.Hour)
+	for _, start := range segments {
+		require.NoError(t, os.Chtimes(log.segmentPath(start), old, old))
+	}
+	require.NoError(t, log.Commit("backfill", segments[1]-1))
+	require.NoError(t, log.cleanup(time.Now()))
+
+	remaining, err := log.segments()
+	require.NoError(t, err)
+	assert.Equal(t, segments[1:], remaining)
+
+	// Readers skip to the oldest retained entry
+	entries := readAll(t, log.NewReader(0))
+	require.NotEmpty(t, entries)
+	assert.Equal(t, segments[1], entries[0].Offset)
+}
+
+func TestQueryLog_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	log := openTestQueryLog(t, dir, 0)
+	for _, query := range []string{"a", "b"} {
+		_, err := log.Append(models.SearchLog{Query: query})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Close())
+
+	path := log.segmentPath(1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-2))
+
+	log = openTestQueryLog(t, dir, 0)
+	defer log.Close()
+	assert.Equal(t, uint64(1), log.LastOffset())
+
+	offset, err := log.Append(models.SearchLog{Query: "c"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), offset)
+
+	entries := readAll(t, log.NewReader(0))
+	require.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[1].Log.Query)
+}
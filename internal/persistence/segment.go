@@ -0,0 +1,258 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const segmentSuffix = ".log"
+
+// segmentLog is an append-only sequence of numbered frames split into segment
+// files, each named after the first number it may contain. The WAL and the
+// query log are both built on it. Every payload starts with its entry's
+// number as a big endian uint64, so the log can be scanned without decoding
+// the rest.
+type segmentLog struct {
+	dir         string
+	prefix      string // Segment file names are prefix, start number, suffix
+	name        string // Names the log in errors and log messages
+	errCorrupt  error  // Returned for a torn or damaged frame
+	policy      SyncPolicy
+	mutex       sync.Mutex
+	file        *os.File
+	segmentSize int64  // Bytes in the active segment
+	last        uint64 // Number of the most recent entry
+	dirty       bool   // Appends not yet synced
+	closed      bool
+	logger      *logrus.Logger
+	stopChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// open creates the log directory if needed and opens the newest segment for
+// appending. A torn entry at its end, left by a crash mid-append, is
+// truncated. The interval policy's sync loop runs until stopSync.
+func (s *segmentLog) open(interval time.Duration) error {
+	switch s.policy {
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return fmt.Errorf("unknown %s sync policy %q", s.name, s.policy)
+	}
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s directory: %w", s.name, err)
+	}
+	s.stopChan = make(chan struct{})
+
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+
+	if len(segments) == 0 {
+		if err := s.openSegment(1); err != nil {
+			return err
+		}
+	} else {
+		active := segments[len(segments)-1]
+		s.last = active - 1
+
+		// Earlier segments are only read back in full; the active one tells
+		// us where appends resume
+		last, validSize, err := s.scan(active, nil)
+		if err != nil && !errors.Is(err, s.errCorrupt) {
+			return err
+		}
+		if err != nil {
+			s.logger.WithField("segment", s.segmentPath(active)).Warnf("Truncating torn %s entry", s.name)
+			if err := os.Truncate(s.segmentPath(active), validSize); err != nil {
+				return fmt.Errorf("failed to truncate %s segment: %w", s.name, err)
+			}
+		}
+		if last > 0 {
+			s.last = last
+		}
+		if err := s.openSegment(active); err != nil {
+			return err
+		}
+		s.segmentSize = validSize
+	}
+
+	if s.policy == SyncInterval {
+		s.wg.Add(1)
+		go s.syncLoop(interval)
+	}
+	return nil
+}
+
+// appendLocked writes a framed entry numbered one after the last. Callers
+// must hold mutex and have checked the log isn't closed.
+func (s *segmentLog) appendLocked(framed []byte) error {
+	if _, err := s.file.Write(framed); err != nil {
+		return fmt.Errorf("failed to append to %s: %w", s.name, err)
+	}
+	s.segmentSize += int64(len(framed))
+	s.last++
+	s.dirty = true
+
+	if s.policy == SyncAlways {
+		return s.syncLocked()
+	}
+	return nil
+}
+
+// rollLocked closes the active segment and starts the next one
+func (s *segmentLog) rollLocked() error {
+	if err := s.syncLocked(); err != nil {
+		return err
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close %s segment: %w", s.name, err)
+	}
+	if err := s.openSegment(s.last + 1); err != nil {
+		return err
+	}
+	s.segmentSize = 0
+	return nil
+}
+
+// closeLocked flushes and closes the active segment. It reports whether the
+// log was open.
+func (s *segmentLog) closeLocked() (bool, error) {
+	if s.closed {
+		return false, nil
+	}
+	s.closed = true
+	err := s.syncLocked()
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	return true, err
+}
+
+// stopSync stops the sync loop. It must be called once, after closeLocked,
+// without holding mutex.
+func (s *segmentLog) stopSync() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+// syncLoop flushes appends periodically for the interval policy
+func (s *segmentLog) syncLoop(interval time.Duration) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.mutex.Lock()
+			if !s.closed {
+				if err := s.syncLocked(); err != nil {
+					s.logger.WithError(err).Errorf("Failed to sync %s", s.name)
+				}
+			}
+			s.mutex.Unlock()
+		}
+	}
+}
+
+// syncLocked fsyncs the active segment if it has unsynced appends
+func (s *segmentLog) syncLocked() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", s.name, err)
+	}
+	s.dirty = false
+	return nil
+}
+
+// openSegment opens (or creates) the segment starting at start for appending
+func (s *segmentLog) openSegment(start uint64) error {
+	file, err := os.OpenFile(s.segmentPath(start), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s segment: %w", s.name, err)
+	}
+	s.file = file
+	return syncDir(s.dir)
+}
+
+// segments returns the start numbers of the segment files in ascending order
+func (s *segmentLog) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s segments: %w", s.name, err)
+	}
+
+	var starts []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, s.prefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		start, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, s.prefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		starts = append(starts, start)
+	}
+
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts, nil
+}
+
+// segmentPath returns the file name of the segment starting at start
+func (s *segmentLog) segmentPath(start uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", s.prefix, start, segmentSuffix))
+}
+
+// scan reads every frame in the segment starting at start, calling fn with
+// each payload when set. It returns the number of the last entry read and
+// the size of the valid prefix of the file; errCorrupt means the file ends
+// in a torn or damaged frame.
+func (s *segmentLog) scan(start uint64, fn func(payload []byte) error) (uint64, int64, error) {
+	file, err := os.Open(s.segmentPath(start))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var last uint64
+	var size int64
+
+	for {
+		payload, err := readFrame(reader)
+		if err == io.EOF {
+			return last, size, nil
+		}
+		if err != nil || len(payload) < 8 {
+			return last, size, s.errCorrupt
+		}
+		if fn != nil {
+			if err := fn(payload); err != nil {
+				return last, size, err
+			}
+		}
+
+		last = binary.BigEndian.Uint64(payload[:8])
+		size += int64(frameHeaderSize + len(payload))
+	}
+}
@@ -0,0 +1,198 @@
+package persistence
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Snapshot file layout (all integers big endian unless noted):
+//
+//	magic      [4]byte "ACSN"
+//	version    uint16
+//	createdAt  int64 (unix nanoseconds)
+//	lsn        uint64 (last WAL entry included, version 2 and later)
+//	generation uint64 (index generation, version 4 and later)
+//	scoreEpoch int64 (unix nanoseconds scores are weighted from, version 5 and later)
+//	count      uint64
+//	records    count × record
+//	checksum   uint32 (CRC-32 IEEE of everything before it)
+//
+// Each record is:
+//
+//	term      uvarint length + UTF-8 bytes
+//	frequency varint
+//	score     uint64 (IEEE 754 bits)
+//	category  uvarint length + UTF-8 bytes
+//	updatedAt varint (unix nanoseconds, 0 for the zero time)
+//	metadata  uvarint count + count × (key, value) strings (version 3 and later)
+const (
+	snapshotMagic = "ACSN"
+
+	// SnapshotVersion is the format version written by WriteSnapshot
+	SnapshotVersion uint16 = 5
+
+	// minSnapshotVersion is the oldest format ReadSnapshot still understands
+	minSnapshotVersion uint16 = 1
+)
+
+var (
+	ErrInvalidSnapshot    = errors.New("invalid snapshot file")
+	ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+	ErrCorruptSnapshot    = errors.New("snapshot checksum mismatch")
+)
+
+// Snapshot is a point-in-time copy of the index
+type Snapshot struct {
+	Version     uint16
+	CreatedAt   time.Time
+	LSN         uint64    // Last write-ahead log entry reflected in the snapshot
+	Generation  uint64    // Index generation the suggestions belong to, 0 before version 4
+	ScoreEpoch  time.Time // Time scores are weighted from, CreatedAt before version 5
+	Suggestions []models.Suggestion
+}
+
+// WriteSnapshot atomically writes suggestions to path, recording lsn as the
+// last write-ahead log entry they include, the index generation they belong
+// to and the time their scores are weighted from. The data is written to a
+// temporary file in the same directory and renamed into place once synced,
+// so a crash never leaves a half-written snapshot behind.
+func WriteSnapshot(path string, lsn, generation uint64, scoreEpoch time.Time, suggestions []models.Suggestion) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // No-op once renamed
+
+	if err := encodeSnapshot(tmp, lsn, generation, scoreEpoch, suggestions); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install snapshot: %w", err)
+	}
+	return syncDir(dir)
+}
+
+// ReadSnapshot loads the snapshot stored at path
+func ReadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return decodeSnapshot(file)
+}
+
+// encodeSnapshot writes the snapshot format to w
+func encodeSnapshot(w io.Writer, lsn, generation uint64, scoreEpoch time.Time, suggestions []models.Suggestion) error {
+	buffered := bufio.NewWriter(w)
+	checksum := crc32.NewIEEE()
+	enc := &encoder{w: io.MultiWriter(buffered, checksum)}
+
+	enc.bytes([]byte(snapshotMagic))
+	enc.uint16(SnapshotVersion)
+	enc.int64(time.Now().UnixNano())
+	enc.uint64(lsn)
+	enc.uint64(generation)
+	enc.int64(scoreEpoch.UnixNano())
+	enc.uint64(uint64(len(suggestions)))
+	for _, suggestion := range suggestions {
+		enc.suggestion(suggestion)
+		enc.metadata(suggestion.Metadata)
+	}
+	if enc.err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", enc.err)
+	}
+
+	if err := binary.Write(buffered, binary.BigEndian, checksum.Sum32()); err != nil {
+		return fmt.Errorf("failed to write snapshot checksum: %w", err)
+	}
+	return buffered.Flush()
+}
+
+// decodeSnapshot reads the snapshot format from r
+func decodeSnapshot(r io.Reader) (*Snapshot, error) {
+	buffered := bufio.NewReader(r)
+	dec := &decoder{r: buffered, checksum: crc32.NewIEEE()}
+
+	magic := dec.bytes(len(snapshotMagic))
+	if dec.err != nil || string(magic) != snapshotMagic {
+		return nil, ErrInvalidSnapshot
+	}
+
+	snapshot := &Snapshot{Version: dec.uint16()}
+	if dec.err == nil && (snapshot.Version < minSnapshotVersion || snapshot.Version > SnapshotVersion) {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, snapshot.Version)
+	}
+	snapshot.CreatedAt = time.Unix(0, dec.int64())
+	if snapshot.Version >= 2 {
+		snapshot.LSN = dec.uint64()
+	}
+	if snapshot.Version >= 4 {
+		snapshot.Generation = dec.uint64()
+	}
+	snapshot.ScoreEpoch = snapshot.CreatedAt
+	if snapshot.Version >= 5 {
+		snapshot.ScoreEpoch = time.Unix(0, dec.int64())
+	}
+
+	count := dec.uint64()
+	for i := uint64(0); i < count && dec.err == nil; i++ {
+		suggestion := dec.suggestion()
+		if snapshot.Version >= 3 {
+			suggestion.Metadata = dec.metadata()
+		}
+		snapshot.Suggestions = append(snapshot.Suggestions, suggestion)
+	}
+	if dec.err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, dec.err)
+	}
+
+	// The trailer is read around the decoder so it isn't part of the checksum
+	var expected uint32
+	if err := binary.Read(buffered, binary.BigEndian, &expected); err != nil {
+		return nil, fmt.Errorf("%w: missing checksum", ErrInvalidSnapshot)
+	}
+	if expected != dec.checksum.Sum32() {
+		return nil, ErrCorruptSnapshot
+	}
+
+	return snapshot, nil
+}
+
+// syncDir flushes a directory entry so a rename survives a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return fmt.Errorf("failed to sync directory: %w", err)
+	}
+	return nil
+}
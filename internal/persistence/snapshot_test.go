@@ -0,0 +1,74 @@
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.snapshot")
+	updatedAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+	suggestions := []models.Suggestion{
+		{Term: "apple", Frequency: 1000, Score: 1234.5, Category: "fruit", UpdatedAt: updatedAt, Metadata: map[string]string{"brand": "acme", "locale": "en"}},
+		{Term: "東京", Frequency: 42, Score: 42},
+	}
+	scoreEpoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, WriteSnapshot(path, 7, 3, scoreEpoch, suggestions))
+
+	snapshot, err := ReadSnapshot(path)
+	require.NoError(t, err)
+	assert.Equal(t, SnapshotVersion, snapshot.Version)
+	assert.Equal(t, uint64(7), snapshot.LSN)
+	assert.Equal(t, uint64(3), snapshot.Generation)
+	assert.True(t, scoreEpoch.Equal(snapshot.ScoreEpoch))
+	assert.WithinDuration(t, time.Now(), snapshot.CreatedAt, time.Minute)
+	require.Len(t, snapshot.Suggestions, 2)
+	assert.Equal(t, "apple", snapshot.Suggestions[0].Term)
+	assert.Equal(t, 1234.5, snapshot.Suggestions[0].Score)
+	assert.True(t, updatedAt.Equal(snapshot.Suggestions[0].UpdatedAt))
+	assert.Equal(t, suggestions[0].Metadata, snapshot.Suggestions[0].Metadata)
+	assert.Equal(t, suggestions[1], snapshot.Suggestions[1])
+
+	// Nothing but the snapshot is left in the directory
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestSnapshot_DetectsCorruption(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.snapshot")
+	require.NoError(t, WriteSnapshot(path, 0, 1, time.Now(), []models.Suggestion{{Term: "apple", Frequency: 1, Score: 1}}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// Flip a byte inside the term
+	corrupt := append([]byte(nil), data...)
+	corrupt[len(corrupt)-20] ^= 0xff
+	require.NoError(t, os.WriteFile(path, corrupt, 0o644))
+	_, err = ReadSnapshot(path)
+	assert.Error(t, err)
+
+	// Truncated files are rejected
+	require.NoError(t, os.WriteFile(path, data[:len(data)-2], 0o644))
+	_, err = ReadSnapshot(path)
+	assert.ErrorIs(t, err, ErrInvalidSnapshot)
+
+	// Files from a newer format are rejected
+	newer := append([]byte(nil), data...)
+	newer[5] = 99
+	require.NoError(t, os.WriteFile(path, newer, 0o644))
+	_, err = ReadSnapshot(path)
+	assert.ErrorIs(t, err, ErrUnsupportedVersion)
+
+	_, err = ReadSnapshot(filepath.Join(t.TempDir(), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,106 @@
+package persistence
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+)
+
+// Source is anything that can persist its state as a snapshot
+type Source interface {
+	SaveSnapshot(path string) error
+}
+
+// Config holds snapshot configuration
+type Config struct {
+	Path     string
+	Interval time.Duration
+}
+
+// Snapshotter periodically writes snapshots of a Source
+type Snapshotter struct {
+	source   Source
+	path     string
+	interval time.Duration
+	logger   *logrus.Logger
+	metrics  *metrics.Metrics
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewSnapshotter creates a new snapshotter
+func NewSnapshotter(source Source, config Config, logger *logrus.Logger, metricsInstance *metrics.Metrics) *Snapshotter {
+	if config.Interval <= 0 {
+		config.Interval = 5 * time.Minute
+	}
+
+	return &Snapshotter{
+		source:   source,
+		path:     config.Path,
+		interval: config.Interval,
+		logger:   logger,
+		metrics:  metricsInstance,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Start begins taking periodic snapshots
+func (s *Snapshotter) Start(ctx context.Context) {
+	s.logger.WithFields(logrus.Fields{
+		"path":     s.path,
+		"interval": s.interval.String(),
+	}).Info("Starting index snapshotter")
+
+	s.wg.Add(1)
+	go s.run(ctx)
+}
+
+// Stop halts periodic snapshots and writes a final one
+func (s *Snapshotter) Stop() {
+	close(s.stopChan)
+	s.wg.Wait()
+
+	s.Snapshot()
+	s.logger.Info("Index snapshotter stopped")
+}
+
+// Snapshot writes a snapshot immediately
+func (s *Snapshotter) Snapshot() error {
+	start := time.Now()
+
+	if err := s.source.SaveSnapshot(s.path); err != nil {
+		s.logger.WithError(err).WithField("path", s.path).Error("Failed to write index snapshot")
+		s.metrics.RecordError("persistence", "snapshot_failed")
+		return err
+	}
+
+	s.metrics.RecordSnapshot(time.Since(start))
+	s.logger.WithFields(logrus.Fields{
+		"path":    s.path,
+		"latency": time.Since(start).String(),
+	}).Debug("Wrote index snapshot")
+	return nil
+}
+
+// run writes a snapshot on every tick until stopped
+func (s *Snapshotter) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stopChan:
+			return
+		case <-ticker.C:
+			s.Snapshot()
+		}
+	}
+}
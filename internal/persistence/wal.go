@@ -0,0 +1,303 @@
+package persistence
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Op identifies the index mutation recorded by a WAL entry
+type Op uint8
+
+const (
+	OpInsert Op = iota + 1
+	OpUpdateFrequency
+	OpDelete
+	OpDecay
+	OpAddFrequency
+)
+
+// Flags set on the op byte of a frame. Frames without them decode as before
+// the fields they announce existed.
+const (
+	opHasMetadata = 0x80 // OpInsert whose suggestion carries metadata
+	opHasScore    = 0x40 // OpUpdateFrequency or OpAddFrequency whose score isn't its frequency
+)
+
+// SyncPolicy controls when WAL appends are flushed to stable storage
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // fsync after every append
+	SyncInterval SyncPolicy = "interval" // fsync in the background every SyncInterval
+	SyncNever    SyncPolicy = "never"    // leave flushing to the operating system
+)
+
+const segmentPrefix = "wal-"
+
+var (
+	ErrCorruptWAL = errors.New("corrupt write-ahead log")
+	ErrWALClosed  = errors.New("write-ahead log is closed")
+)
+
+// Entry is a single logged index mutation
+type Entry struct {
+	LSN        uint64
+	Op         Op
+	Suggestion models.Suggestion // OpInsert
+	Term       string            // OpUpdateFrequency, OpAddFrequency, OpDelete
+	Frequency  int64             // OpUpdateFrequency, or the delta for OpAddFrequency
+	Score      float64           // OpUpdateFrequency, or the score delta for OpAddFrequency
+	Factor     float64           // OpDecay
+	Time       time.Time         // OpDecay, the score epoch from then on
+}
+
+// WALConfig holds write-ahead log configuration
+type WALConfig struct {
+	Dir          string
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+}
+
+// WAL is an append-only log of index mutations split into segment files.
+// Each segment is named after the first LSN it may contain, and each entry is
+// framed as:
+//
+//	length  uint32 (big endian, payload bytes)
+//	crc     uint32 (CRC-32 IEEE of the payload)
+//	payload LSN uint64 + op byte + op-specific fields
+type WAL struct {
+	segmentLog // Numbered by LSN
+}
+
+// OpenWAL opens the log in config.Dir, creating it if needed. A torn entry at
+// the end of the newest segment, left by a crash mid-append, is truncated.
+func OpenWAL(config WALConfig, logger *logrus.Logger) (*WAL, error) {
+	if config.SyncPolicy == "" {
+		config.SyncPolicy = SyncInterval
+	}
+	if config.SyncInterval <= 0 {
+		config.SyncInterval = time.Second
+	}
+
+	w := &WAL{segmentLog{
+		dir:        config.Dir,
+		prefix:     segmentPrefix,
+		name:       "write-ahead log",
+		errCorrupt: ErrCorruptWAL,
+		policy:     config.SyncPolicy,
+		logger:     logger,
+	}}
+	if err := w.open(config.SyncInterval); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append writes an entry to the log, assigning it the next LSN
+func (w *WAL) Append(entry Entry) (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, ErrWALClosed
+	}
+
+	entry.LSN = w.last + 1
+	if err := w.appendLocked(encodeFrame(entry)); err != nil {
+		return 0, err
+	}
+	return entry.LSN, nil
+}
+
+// LastLSN returns the LSN of the most recent entry
+func (w *WAL) LastLSN() uint64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.last
+}
+
+// AdvanceTo makes sure new entries are numbered after lsn. It is used when a
+// snapshot is newer than anything left in the log.
+func (w *WAL) AdvanceTo(lsn uint64) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if lsn > w.last {
+		w.last = lsn
+	}
+}
+
+// Replay calls fn for every entry with an LSN greater than after, in order
+func (w *WAL) Replay(after uint64, fn func(Entry) error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, start := range segments {
+		_, _, err := w.scan(start, func(payload []byte) error {
+			entry, err := decodeEntry(payload)
+			if err != nil {
+				return ErrCorruptWAL
+			}
+			if entry.LSN <= after {
+				return nil
+			}
+			return fn(entry)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to replay %s: %w", w.segmentPath(start), err)
+		}
+	}
+	return nil
+}
+
+// Rotate closes the active segment and starts a new one, returning the LSN of
+// the last entry in the closed segment. Nothing happens if the active segment
+// is empty.
+func (w *WAL) Rotate() (uint64, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return 0, ErrWALClosed
+	}
+	if w.segmentSize == 0 {
+		return w.last, nil
+	}
+	if err := w.rollLocked(); err != nil {
+		return 0, err
+	}
+	return w.last, nil
+}
+
+// Compact deletes every inactive segment whose entries are all at or below
+// lsn, i.e. already captured by a snapshot
+func (w *WAL) Compact(lsn uint64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	segments, err := w.segments()
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for i := 0; i < len(segments)-1; i++ {
+		// A segment ends right before the next one starts
+		if segments[i+1]-1 > lsn {
+			break
+		}
+		if err := os.Remove(w.segmentPath(segments[i])); err != nil {
+			return fmt.Errorf("failed to remove WAL segment: %w", err)
+		}
+		removed++
+	}
+
+	if removed > 0 {
+		w.logger.WithFields(logrus.Fields{
+			"segments": removed,
+			"lsn":      lsn,
+		}).Debug("Compacted write-ahead log")
+		return syncDir(w.dir)
+	}
+	return nil
+}
+
+// Close flushes and closes the log
+func (w *WAL) Close() error {
+	w.mutex.Lock()
+	open, err := w.closeLocked()
+	w.mutex.Unlock()
+
+	if open {
+		w.stopSync()
+	}
+	return err
+}
+
+// encodeFrame serializes an entry with its length and checksum header
+func encodeFrame(entry Entry) []byte {
+	var payload bytes.Buffer
+	enc := &encoder{w: &payload}
+	enc.uint64(entry.LSN)
+	op := byte(entry.Op)
+	if entry.Op == OpInsert && len(entry.Suggestion.Metadata) > 0 {
+		op |= opHasMetadata
+	}
+	if (entry.Op == OpUpdateFrequency || entry.Op == OpAddFrequency) && entry.Score != float64(entry.Frequency) {
+		op |= opHasScore
+	}
+	enc.bytes([]byte{op})
+
+	switch entry.Op {
+	case OpInsert:
+		enc.suggestion(entry.Suggestion)
+		if len(entry.Suggestion.Metadata) > 0 {
+			enc.metadata(entry.Suggestion.Metadata)
+		}
+	case OpUpdateFrequency, OpAddFrequency:
+		enc.string(entry.Term)
+		enc.varint(entry.Frequency)
+		if op&opHasScore != 0 {
+			enc.uint64(math.Float64bits(entry.Score))
+		}
+	case OpDelete:
+		enc.string(entry.Term)
+	case OpDecay:
+		enc.uint64(math.Float64bits(entry.Factor))
+		enc.time(entry.Time)
+	}
+
+	return frame(payload.Bytes())
+}
+
+// decodeEntry parses an entry payload
+func decodeEntry(payload []byte) (Entry, error) {
+	dec := &decoder{r: bufio.NewReader(bytes.NewReader(payload))}
+
+	entry := Entry{LSN: dec.uint64()}
+	op := dec.bytes(1)
+	if dec.err != nil {
+		return entry, dec.err
+	}
+	entry.Op = Op(op[0] &^ (opHasMetadata | opHasScore))
+
+	switch entry.Op {
+	case OpInsert:
+		entry.Suggestion = dec.suggestion()
+		if op[0]&opHasMetadata != 0 {
+			entry.Suggestion.Metadata = dec.metadata()
+		}
+	case OpUpdateFrequency, OpAddFrequency:
+		entry.Term = dec.string()
+		entry.Frequency = dec.varint()
+		entry.Score = float64(entry.Frequency)
+		if op[0]&opHasScore != 0 {
+			entry.Score = math.Float64frombits(dec.uint64())
+		}
+	case OpDelete:
+		entry.Term = dec.string()
+	case OpDecay:
+		entry.Factor = math.Float64frombits(dec.uint64())
+		entry.Time = dec.time()
+	default:
+		return entry, fmt.Errorf("unknown WAL op %d", entry.Op)
+	}
+
+	return entry, dec.err
+}
@@ -0,0 +1,158 @@
+package persistence
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func openTestWAL(t *testing.T, dir string) *WAL {
+	wal, err := OpenWAL(WALConfig{Dir: dir, SyncPolicy: SyncAlways}, testLogger())
+	require.NoError(t, err)
+	return wal
+}
+
+func replayAll(t *testing.T, wal *WAL, after uint64) []Entry {
+	var entries []Entry
+	require.NoError(t, wal.Replay(after, func(entry Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	return entries
+}
+
+func TestWAL_AppendAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestWAL(t, dir)
+
+	lsn, err := wal.Append(Entry{Op: OpInsert, Suggestion: models.Suggestion{Term: "apple", Frequency: 10, Score: 10, Category: "fruit"}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), lsn)
+	_, err = wal.Append(Entry{Op: OpUpdateFrequency, Term: "apple", Frequency: 20, Score: 40})
+	require.NoError(t, err)
+	_, err = wal.Append(Entry{Op: OpDelete, Term: "café"})
+	require.NoError(t, err)
+	decayedAt := time.Unix(0, time.Now().UnixNano())
+	_, err = wal.Append(Entry{Op: OpDecay, Factor: 0.75, Time: decayedAt})
+	require.NoError(t, err)
+	_, err = wal.Append(Entry{Op: OpAddFrequency, Term: "apple", Frequency: -2, Score: -2})
+	require.NoError(t, err)
+	_, err = wal.Append(Entry{Op: OpInsert, Suggestion: models.Suggestion{Term: "pear", Metadata: map[string]string{"brand": "acme"}}})
+	require.NoError(t, err)
+	_, err = wal.Append(Entry{Op: OpAddFrequency, Term: "pear", Frequency: 3, Score: 0.75})
+	require.NoError(t, err)
+	require.NoError(t, wal.Close())
+
+	_, err = wal.Append(Entry{Op: OpDelete, Term: "apple"})
+	assert.ErrorIs(t, err, ErrWALClosed)
+
+	// Reopening resumes numbering after the last entry
+	wal = openTestWAL(t, dir)
+	defer wal.Close()
+	assert.Equal(t, uint64(7), wal.LastLSN())
+
+	entries := replayAll(t, wal, 0)
+	require.Len(t, entries, 7)
+	assert.Nil(t, entries[0].Suggestion.Metadata)
+	assert.Equal(t, "fruit", entries[0].Suggestion.Category)
+	assert.Equal(t, Entry{LSN: 2, Op: OpUpdateFrequency, Term: "apple", Frequency: 20, Score: 40}, entries[1])
+	assert.Equal(t, Entry{LSN: 3, Op: OpDelete, Term: "café"}, entries[2])
+	assert.Equal(t, Entry{LSN: 4, Op: OpDecay, Factor: 0.75, Time: decayedAt}, entries[3])
+	assert.Equal(t, Entry{LSN: 5, Op: OpAddFrequency, Term: "apple", Frequency: -2, Score: -2}, entries[4])
+	assert.Equal(t, OpInsert, entries[5].Op)
+	assert.Equal(t, map[string]string{"brand": "acme"}, entries[5].Suggestion.Metadata)
+	assert.Equal(t, Entry{LSN: 7, Op: OpAddFrequency, Term: "pear", Frequency: 3, Score: 0.75}, entries[6])
+
+	assert.Len(t, replayAll(t, wal, 2), 5)
+}
+
+func TestWAL_RotateAndCompact(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestWAL(t, dir)
+	defer wal.Close()
+
+	for i := 0; i < 3; i++ {
+		_, err := wal.Append(Entry{Op: OpDelete, Term: "a"})
+		require.NoError(t, err)
+	}
+	lsn, err := wal.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), lsn)
+
+	// Rotating an empty segment is a no-op
+	lsn, err = wal.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), lsn)
+
+	_, err = wal.Append(Entry{Op: OpDelete, Term: "b"})
+	require.NoError(t, err)
+
+	segments, err := wal.segments()
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 4}, segments)
+
+	// A snapshot that doesn't cover the whole segment keeps it
+	require.NoError(t, wal.Compact(2))
+	assert.Len(t, replayAll(t, wal, 0), 4)
+
+	require.NoError(t, wal.Compact(3))
+	entries := replayAll(t, wal, 0)
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint64(4), entries[0].LSN)
+}
+
+func TestWAL_TruncatesTornTail(t *testing.T) {
+	dir := t.TempDir()
+	wal := openTestWAL(t, dir)
+	for _, term := range []string{"a", "b"} {
+		_, err := wal.Append(Entry{Op: OpDelete, Term: term})
+		require.NoError(t, err)
+	}
+	require.NoError(t, wal.Close())
+
+	// Simulate a crash part way through writing the second entry
+	path := wal.segmentPath(1)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-2))
+
+	wal = openTestWAL(t, dir)
+	defer wal.Close()
+	assert.Equal(t, uint64(1), wal.LastLSN())
+
+	lsn, err := wal.Append(Entry{Op: OpDelete, Term: "c"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), lsn)
+
+	entries := replayAll(t, wal, 0)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "c", entries[1].Term)
+}
+
+func TestWAL_AdvanceTo(t *testing.T) {
+	wal := openTestWAL(t, filepath.Join(t.TempDir(), "wal"))
+	defer wal.Close()
+
+	// A snapshot newer than the log pushes numbering forward
+	wal.AdvanceTo(41)
+	lsn, err := wal.Append(Entry{Op: OpDelete, Term: "a"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), lsn)
+
+	wal.AdvanceTo(10)
+	assert.Equal(t, uint64(42), wal.LastLSN())
+}
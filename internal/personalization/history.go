@@ -0,0 +1,288 @@
+package personalization
+
+import (
+	"container/list"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Weights given to each kind of event in a profile. Picking a suggestion says
+// more about what the user wants than typing a query does. They only weigh
+// events against each other within a profile; how much a selection adds to
+// a term's shared frequency is set by the pipeline.
+const (
+	SearchWeight    = 1.0
+	SelectionWeight = 3.0
+)
+
+// Config holds history configuration
+type Config struct {
+	MaxProfiles int           // Users and sessions tracked before the least recent is evicted
+	MaxTerms    int           // Terms (and categories) kept per profile
+	TTL         time.Duration // Idle time after which a profile is dropped
+	HalfLife    time.Duration // Age at which an event counts half as much
+}
+
+// Profile is a snapshot of what a user or session has been searching for.
+// Affinities are normalized so the strongest term or category is 1.
+type Profile struct {
+	Terms      map[string]float64
+	Categories map[string]float64
+}
+
+// History keeps a bounded, expiring record of recent searches and selections
+// per user and per session, or of the suggestions picked for each query
+type History struct {
+	config   Config
+	mutex    sync.Mutex
+	profiles map[string]*list.Element // Keyed by "user:<id>", "session:<id>" or "query:<query>"
+	recent   *list.List               // Most recently used profile at the front
+	now      func() time.Time
+}
+
+// profile accumulates decayed weights for one user, session or query
+type profile struct {
+	key        string
+	terms      map[string]*affinity
+	categories map[string]*affinity
+	lastSeen   time.Time
+}
+
+// affinity is a weight that decays from the time it was last updated
+type affinity struct {
+	weight  float64
+	updated time.Time
+}
+
+// NewHistory creates a new history store
+func NewHistory(config Config) *History {
+	if config.MaxProfiles <= 0 {
+		config.MaxProfiles = 10000
+	}
+	if config.MaxTerms <= 0 {
+		config.MaxTerms = 50
+	}
+	if config.TTL <= 0 {
+		config.TTL = 24 * time.Hour
+	}
+	if config.HalfLife <= 0 {
+		config.HalfLife = 6 * time.Hour
+	}
+
+	return &History{
+		config:   config,
+		profiles: make(map[string]*list.Element),
+		recent:   list.New(),
+		now:      time.Now,
+	}
+}
+
+// RecordSearch records a query typed by a user or session. category is the
+// category of the matching suggestion, if known.
+func (h *History) RecordSearch(userID, sessionID, query, category string) {
+	h.record(profileKeys(userID, sessionID), query, category, SearchWeight)
+}
+
+// RecordSelection records a suggestion picked by a user or session
+func (h *History) RecordSelection(userID, sessionID, term, category string) {
+	h.record(profileKeys(userID, sessionID), term, category, SelectionWeight)
+}
+
+// RecordQuerySelection records that term was picked from the suggestions
+// shown for query, whoever picked it
+func (h *History) RecordQuerySelection(query, term string, weight float64) {
+	if key := queryKey(query); key != "" {
+		h.record([]string{key}, term, "", weight)
+	}
+}
+
+// Profile merges the user's and the session's history. It returns nil when
+// there is nothing to personalize with.
+func (h *History) Profile(userID, sessionID string) *Profile {
+	return h.merge(profileKeys(userID, sessionID))
+}
+
+// QueryProfile returns the suggestions picked for query, or nil if none have
+// been
+func (h *History) QueryProfile(query string) *Profile {
+	key := queryKey(query)
+	if key == "" {
+		return nil
+	}
+	return h.merge([]string{key})
+}
+
+// merge adds up the given profiles as of now
+func (h *History) merge(keys []string) *Profile {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.now()
+	terms := make(map[string]float64)
+	categories := make(map[string]float64)
+
+	for _, key := range keys {
+		p := h.lookup(key, now)
+		if p == nil {
+			continue
+		}
+		for term, a := range p.terms {
+			terms[term] += h.decayed(a, now)
+		}
+		for category, a := range p.categories {
+			categories[category] += h.decayed(a, now)
+		}
+	}
+
+	if len(terms) == 0 && len(categories) == 0 {
+		return nil
+	}
+	return &Profile{Terms: normalize(terms), Categories: normalize(categories)}
+}
+
+// Len returns the number of profiles being tracked
+func (h *History) Len() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.recent.Len()
+}
+
+// record adds an event to the given profiles
+func (h *History) record(keys []string, term, category string, weight float64) {
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	now := h.now()
+	for _, key := range keys {
+		p := h.lookup(key, now)
+		if p == nil {
+			p = h.create(key)
+		}
+		p.lastSeen = now
+
+		h.add(p.terms, term, weight, now)
+		if category != "" {
+			h.add(p.categories, category, weight, now)
+		}
+	}
+}
+
+// lookup returns a live profile and marks it as recently used, dropping it
+// instead if it has expired. Callers must hold the mutex.
+func (h *History) lookup(key string, now time.Time) *profile {
+	element, ok := h.profiles[key]
+	if !ok {
+		return nil
+	}
+
+	p := element.Value.(*profile)
+	if now.Sub(p.lastSeen) > h.config.TTL {
+		h.recent.Remove(element)
+		delete(h.profiles, key)
+		return nil
+	}
+
+	h.recent.MoveToFront(element)
+	return p
+}
+
+// create adds an empty profile, evicting expired and then least recently
+// used profiles to stay within bounds. Callers must hold the mutex.
+func (h *History) create(key string) *profile {
+	now := h.now()
+	for h.recent.Len() > 0 {
+		oldest := h.recent.Back()
+		p := oldest.Value.(*profile)
+		if h.recent.Len() < h.config.MaxProfiles && now.Sub(p.lastSeen) <= h.config.TTL {
+			break
+		}
+		h.recent.Remove(oldest)
+		delete(h.profiles, p.key)
+	}
+
+	p := &profile{
+		key:        key,
+		terms:      make(map[string]*affinity),
+		categories: make(map[string]*affinity),
+	}
+	h.profiles[key] = h.recent.PushFront(p)
+	return p
+}
+
+// add bumps an affinity, dropping the weakest entries once the map is full.
+// Callers must hold the mutex.
+func (h *History) add(affinities map[string]*affinity, key string, weight float64, now time.Time) {
+	if a, ok := affinities[key]; ok {
+		a.weight = h.decayed(a, now) + weight
+		a.updated = now
+		return
+	}
+
+	if len(affinities) >= h.config.MaxTerms {
+		keys := make([]string, 0, len(affinities))
+		for k := range affinities {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return h.decayed(affinities[keys[i]], now) < h.decayed(affinities[keys[j]], now)
+		})
+		for _, k := range keys[:len(affinities)-h.config.MaxTerms+1] {
+			delete(affinities, k)
+		}
+	}
+
+	affinities[key] = &affinity{weight: weight, updated: now}
+}
+
+// decayed returns an affinity's weight as of now
+func (h *History) decayed(a *affinity, now time.Time) float64 {
+	age := now.Sub(a.updated)
+	if age <= 0 {
+		return a.weight
+	}
+	return a.weight * math.Pow(0.5, float64(age)/float64(h.config.HalfLife))
+}
+
+// profileKeys returns the profile keys for a request's user and session
+func profileKeys(userID, sessionID string) []string {
+	var keys []string
+	if userID != "" {
+		keys = append(keys, "user:"+userID)
+	}
+	if sessionID != "" {
+		keys = append(keys, "session:"+sessionID)
+	}
+	return keys
+}
+
+// queryKey returns the profile key for a query's selections
+func queryKey(query string) string {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return ""
+	}
+	return "query:" + query
+}
+
+// normalize scales weights so the largest is 1
+func normalize(weights map[string]float64) map[string]float64 {
+	highest := 0.0
+	for _, weight := range weights {
+		highest = max(highest, weight)
+	}
+	if highest > 0 {
+		for key := range weights {
+			weights[key] /= highest
+		}
+	}
+	return weights
+}
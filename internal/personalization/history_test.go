@@ -0,0 +1,93 @@
+package personalization
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHistory returns a history whose clock only moves when advanced
+func newTestHistory(config Config) (*History, func(time.Duration)) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	h := NewHistory(config)
+	h.now = func() time.Time { return now }
+	return h, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestHistory_Profile(t *testing.T) {
+	h, _ := newTestHistory(Config{})
+
+	assert.Nil(t, h.Profile("alice", ""), "no history yet")
+
+	h.RecordSearch("alice", "", "Python", "tech")
+	h.RecordSelection("alice", "", "python programming", "tech")
+	h.RecordSelection("", "s-1", "banana", "fruit")
+
+	profile := h.Profile("alice", "")
+	require.NotNil(t, profile)
+	assert.Equal(t, 1.0, profile.Terms["python programming"], "selections weigh the most")
+	assert.InDelta(t, SearchWeight/SelectionWeight, profile.Terms["python"], 1e-9)
+	assert.Equal(t, map[string]float64{"tech": 1}, profile.Categories)
+
+	// A request's user and session histories are merged
+	profile = h.Profile("alice", "s-1")
+	assert.Contains(t, profile.Terms, "banana")
+	assert.Contains(t, profile.Categories, "fruit")
+
+	assert.Nil(t, h.Profile("", ""))
+}
+
+func TestHistory_Decay(t *testing.T) {
+	h, advance := newTestHistory(Config{HalfLife: time.Hour, TTL: 24 * time.Hour})
+
+	h.RecordSelection("alice", "", "old", "")
+	advance(2 * time.Hour)
+	h.RecordSelection("alice", "", "new", "")
+
+	profile := h.Profile("alice", "")
+	assert.Equal(t, 1.0, profile.Terms["new"])
+	assert.InDelta(t, 0.25, profile.Terms["old"], 1e-9)
+}
+
+func TestHistory_Bounds(t *testing.T) {
+	h, advance := newTestHistory(Config{MaxProfiles: 2, MaxTerms: 3, TTL: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		h.RecordSearch("alice", "", fmt.Sprintf("term%d", i), "")
+		advance(time.Minute)
+	}
+	assert.Len(t, h.Profile("alice", "").Terms, 3)
+	assert.NotContains(t, h.Profile("alice", "").Terms, "term0", "weakest terms are dropped")
+
+	// Least recently used profiles are evicted
+	h.RecordSearch("bob", "", "x", "")
+	h.Profile("alice", "")
+	h.RecordSearch("carol", "", "y", "")
+	assert.Equal(t, 2, h.Len())
+	assert.Nil(t, h.Profile("bob", ""))
+	assert.NotNil(t, h.Profile("alice", ""))
+
+	// Idle profiles expire
+	advance(2 * time.Hour)
+	assert.Nil(t, h.Profile("alice", ""))
+	assert.Equal(t, 1, h.Len())
+}
+
+func TestHistory_QueryProfile(t *testing.T) {
+	h, _ := newTestHistory(Config{})
+
+	assert.Nil(t, h.QueryProfile("app"))
+
+	h.RecordQuerySelection("App ", "application", 2)
+	h.RecordQuerySelection("app", "apple", 1)
+	h.RecordSelection("alice", "", "amazon", "")
+
+	profile := h.QueryProfile("app")
+	require.NotNil(t, profile)
+	assert.Equal(t, map[string]float64{"application": 1, "apple": 0.5}, profile.Terms)
+	assert.Nil(t, h.QueryProfile("ap"), "selections are kept per query")
+	assert.NotContains(t, h.Profile("alice", "").Terms, "application")
+}
@@ -0,0 +1,394 @@
+package pipeline
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// accessLogTime is the timestamp layout of the common and combined access log
+// formats
+const accessLogTime = "02/Jan/2006:15:04:05 -0700"
+
+// maxBackfillLine bounds a single log line; a file is read up to the first
+// longer one
+const maxBackfillLine = 1 << 20
+
+var (
+	// errNotSearch marks a log line that parsed but isn't a search
+	errNotSearch = errors.New("not a search")
+	// errBackfillStopped is returned when the pipeline stops mid-backfill
+	errBackfillStopped = errors.New("pipeline stopped during backfill")
+)
+
+// BackfillConfig controls a historical log backfill
+type BackfillConfig struct {
+	Dir              string
+	Pattern          string        // Glob matched against file names, default "*"
+	Path             string        // Access logs: request path of searches, default "/api/v1/autocomplete"
+	QueryParam       string        // Access logs: query string parameter holding the search, default "q"
+	ProgressInterval time.Duration // How often progress is logged, default 10s
+}
+
+// BackfillProgress reports how far a backfill has got
+type BackfillProgress struct {
+	Files       int       `json:"files"`
+	FilesDone   int       `json:"files_done"`
+	FilesFailed int       `json:"files_failed"`
+	File        string    `json:"file,omitempty"` // File being read
+	Bytes       int64     `json:"bytes"`          // Bytes read from disk, before decompression
+	TotalBytes  int64     `json:"total_bytes"`
+	Lines       int64     `json:"lines"`
+	Queries     int64     `json:"queries"`
+	Skipped     int64     `json:"skipped"` // Lines that weren't searches or couldn't be parsed
+	Oldest      time.Time `json:"oldest"`
+	Newest      time.Time `json:"newest"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"` // Zero while running
+}
+
+// Backfill seeds the pipeline from historical search logs in a directory.
+// Files are read in name order, gzipped ones included, and each line may be
+// a JSON models.SearchLog or a common or combined format access log entry
+// for a search request. Searches are counted at the time they were made:
+// older ones add less to scores and only recent ones feed trending.
+//
+// Backfilled searches go straight to the frequency updates rather than
+// through the query log; the index's WAL and snapshots make them durable. It
+// returns once every file is read, updates are flushed, or ctx is done.
+func (p *DataPipeline) Backfill(ctx context.Context, config BackfillConfig) (BackfillProgress, error) {
+	if config.Pattern == "" {
+		config.Pattern = "*"
+	}
+	if config.Path == "" {
+		config.Path = "/api/v1/autocomplete"
+	}
+	if config.QueryParam == "" {
+		config.QueryParam = "q"
+	}
+	if config.ProgressInterval <= 0 {
+		config.ProgressInterval = 10 * time.Second
+	}
+
+	progress := BackfillProgress{StartedAt: time.Now()}
+
+	files, err := backfillFiles(config.Dir, config.Pattern)
+	if err != nil {
+		return progress, err
+	}
+	progress.Files = len(files)
+	for _, file := range files {
+		progress.TotalBytes += file.size
+	}
+	p.setBackfillProgress(progress)
+
+	p.logger.WithFields(logrus.Fields{
+		"dir":   config.Dir,
+		"files": progress.Files,
+		"bytes": progress.TotalBytes,
+	}).Info("Starting historical log backfill")
+
+	b := &backfill{
+		pipeline:     p,
+		config:       config,
+		progress:     &progress,
+		logs:         make([]models.SearchLog, 0, p.batchSize),
+		nextProgress: time.Now().Add(config.ProgressInterval),
+	}
+
+	for _, file := range files {
+		if err := b.stopped(ctx); err != nil {
+			return progress, err
+		}
+
+		progress.File = file.name
+		done := progress.Bytes
+		if err := b.readFile(ctx, file.path); err != nil {
+			if ctx.Err() != nil || errors.Is(err, errBackfillStopped) {
+				return progress, err
+			}
+			progress.FilesFailed++
+			p.logger.WithError(err).WithField("file", file.name).Warn("Failed to backfill log file")
+			p.metrics.RecordError("pipeline", "backfill")
+		}
+		progress.Bytes = done + file.size
+		progress.FilesDone++
+		b.flushBatch()
+		p.setBackfillProgress(progress)
+	}
+
+	progress.File = ""
+	b.flushBatch()
+	p.flushFrequencyUpdates()
+
+	progress.FinishedAt = time.Now()
+	p.setBackfillProgress(progress)
+	b.logProgress("Finished historical log backfill")
+
+	return progress, nil
+}
+
+// backfillFile is a log file waiting to be read
+type backfillFile struct {
+	name string
+	path string
+	size int64
+}
+
+// backfillFiles lists the regular files in dir matching pattern, by name
+func backfillFiles(dir, pattern string) ([]backfillFile, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid backfill pattern %q: %w", pattern, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []backfillFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, name); !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, backfillFile{name: name, path: filepath.Join(dir, name), size: info.Size()})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].name < files[j].name })
+	return files, nil
+}
+
+// backfill is the state of a running backfill
+type backfill struct {
+	pipeline     *DataPipeline
+	config       BackfillConfig
+	progress     *BackfillProgress
+	logs         []models.SearchLog
+	nextProgress time.Time
+}
+
+// readFile feeds every search in a log file to the pipeline
+func (b *backfill) readFile(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	counter := &countingReader{r: file}
+	var r io.Reader = bufio.NewReader(counter)
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	start := b.progress.Bytes
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBackfillLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		b.progress.Lines++
+
+		log, err := b.parseLine(line)
+		if err != nil {
+			b.progress.Skipped++
+			continue
+		}
+		b.add(log)
+
+		if len(b.logs) >= b.pipeline.batchSize {
+			b.flushBatch()
+			b.progress.Bytes = start + counter.n
+			b.pipeline.setBackfillProgress(*b.progress)
+
+			if err := b.stopped(ctx); err != nil {
+				return err
+			}
+			if now := time.Now(); now.After(b.nextProgress) {
+				b.nextProgress = now.Add(b.config.ProgressInterval)
+				b.logProgress("Backfilling historical logs")
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+// parseLine reads a search from a JSON or access log line
+func (b *backfill) parseLine(line string) (models.SearchLog, error) {
+	if strings.HasPrefix(line, "{") {
+		var log models.SearchLog
+		if err := json.Unmarshal([]byte(line), &log); err != nil {
+			return log, err
+		}
+		if strings.TrimSpace(log.Query) == "" {
+			return log, errNotSearch
+		}
+		return log, nil
+	}
+	return parseAccessLog(line, b.config.Path, b.config.QueryParam)
+}
+
+// add queues a search and tracks the time range covered
+func (b *backfill) add(log models.SearchLog) {
+	b.logs = append(b.logs, log)
+	b.progress.Queries++
+
+	if log.Timestamp.IsZero() {
+		return
+	}
+	if b.progress.Oldest.IsZero() || log.Timestamp.Before(b.progress.Oldest) {
+		b.progress.Oldest = log.Timestamp
+	}
+	if log.Timestamp.After(b.progress.Newest) {
+		b.progress.Newest = log.Timestamp
+	}
+}
+
+// flushBatch hands queued searches to the pipeline
+func (b *backfill) flushBatch() {
+	if len(b.logs) == 0 {
+		return
+	}
+	b.pipeline.processBatch(b.logs)
+	b.logs = b.logs[:0]
+}
+
+// stopped reports whether the backfill should stop
+func (b *backfill) stopped(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-b.pipeline.stopChan:
+		return errBackfillStopped
+	default:
+		return nil
+	}
+}
+
+// setBackfillProgress publishes progress for GetStats
+func (p *DataPipeline) setBackfillProgress(progress BackfillProgress) {
+	p.backfillProgress.Store(&progress)
+}
+
+// logProgress logs how far the backfill has got
+func (b *backfill) logProgress(message string) {
+	fields := logrus.Fields{
+		"files":       fmt.Sprintf("%d/%d", b.progress.FilesDone, b.progress.Files),
+		"queries":     b.progress.Queries,
+		"skipped":     b.progress.Skipped,
+		"elapsed":     time.Since(b.progress.StartedAt).Round(time.Second).String(),
+		"file":        b.progress.File,
+		"bytes":       b.progress.Bytes,
+		"total_bytes": b.progress.TotalBytes,
+	}
+	if b.progress.FilesFailed > 0 {
+		fields["files_failed"] = b.progress.FilesFailed
+	}
+	b.pipeline.logger.WithFields(fields).Info(message)
+}
+
+// parseAccessLog reads a search from a common or combined format access log
+// line, such as:
+//
+//	203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=app HTTP/1.1" 200 512 "-" "curl/8.0"
+//
+// Requests to other paths, and failed ones, aren't searches.
+func parseAccessLog(line, path, param string) (models.SearchLog, error) {
+	var log models.SearchLog
+
+	host, rest, ok := strings.Cut(line, " ")
+	if !ok {
+		return log, errors.New("malformed access log line")
+	}
+
+	open := strings.IndexByte(rest, '[')
+	end := strings.IndexByte(rest, ']')
+	if open < 0 || end < open {
+		return log, errors.New("missing access log timestamp")
+	}
+	timestamp, err := time.Parse(accessLogTime, rest[open+1:end])
+	if err != nil {
+		return log, err
+	}
+	rest = strings.TrimSpace(rest[end+1:])
+
+	// "METHOD target PROTOCOL" status ...
+	if !strings.HasPrefix(rest, `"`) {
+		return log, errors.New("missing access log request")
+	}
+	request, rest, ok := strings.Cut(rest[1:], `"`)
+	if !ok {
+		return log, errors.New("unterminated access log request")
+	}
+	fields := strings.Fields(request)
+	if len(fields) < 2 || (fields[0] != "GET" && fields[0] != "POST") {
+		return log, errNotSearch
+	}
+	if status, err := strconv.Atoi(firstField(rest)); err != nil || status >= 400 {
+		return log, errNotSearch
+	}
+
+	target, err := url.ParseRequestURI(fields[1])
+	if err != nil {
+		return log, err
+	}
+	query := strings.TrimSpace(target.Query().Get(param))
+	if target.Path != path || query == "" {
+		return log, errNotSearch
+	}
+
+	log.Query = query
+	log.Timestamp = timestamp
+	if host != "-" {
+		log.IPAddress = host
+	}
+	return log, nil
+}
+
+// firstField returns the first space separated field of s
+func firstField(s string) string {
+	field, _, _ := strings.Cut(strings.TrimSpace(s), " ")
+	return field
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
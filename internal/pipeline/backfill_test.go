@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAccessLog(t *testing.T) {
+	at := time.Date(2024, 10, 10, 13, 55, 36, 0, time.FixedZone("", -7*60*60))
+
+	tests := []struct {
+		name     string
+		line     string
+		query    string
+		ip       string
+		notQuery bool // Parsed, but not a search
+		invalid  bool // Couldn't be parsed
+	}{
+		{
+			name:  "combined format",
+			line:  `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=app&limit=5 HTTP/1.1" 200 512 "-" "curl/8.0"`,
+			query: "app",
+			ip:    "203.0.113.7",
+		},
+		{
+			name:  "common format with an escaped query and no host",
+			line:  `- - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=new%20york+pizza HTTP/1.1" 200 512`,
+			query: "new york pizza",
+		},
+		{
+			name:     "other path",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/health?q=app HTTP/1.1" 200 2`,
+			notQuery: true,
+		},
+		{
+			name:     "failed request",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=app HTTP/1.1" 500 0`,
+			notQuery: true,
+		},
+		{
+			name:     "missing query",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=%20 HTTP/1.1" 200 2`,
+			notQuery: true,
+		},
+		{
+			name:     "other method",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "DELETE /api/v1/autocomplete?q=app HTTP/1.1" 200 2`,
+			notQuery: true,
+		},
+		{
+			name:     "missing status",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=app HTTP/1.1"`,
+			notQuery: true,
+		},
+		{
+			name:     "request line without a target",
+			line:     `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "-" 408 0`,
+			notQuery: true,
+		},
+		{name: "single field", line: `203.0.113.7`, invalid: true},
+		{name: "missing timestamp", line: `203.0.113.7 - - "GET /api/v1/autocomplete?q=app HTTP/1.1" 200 512`, invalid: true},
+		{name: "bad timestamp", line: `203.0.113.7 - - [yesterday] "GET /api/v1/autocomplete?q=app HTTP/1.1" 200 512`, invalid: true},
+		{name: "cut off in the timestamp", line: `203.0.113.7 - - [10/Oct/2024:13:5`, invalid: true},
+		{name: "cut off after the timestamp", line: `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700]`, invalid: true},
+		{name: "cut off in the request", line: `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=ap`, invalid: true},
+		{name: "bad target", line: `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET %zz HTTP/1.1" 200 512`, invalid: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			log, err := parseAccessLog(tt.line, "/api/v1/autocomplete", "q")
+			switch {
+			case tt.notQuery:
+				assert.ErrorIs(t, err, errNotSearch)
+			case tt.invalid:
+				require.Error(t, err)
+				assert.NotErrorIs(t, err, errNotSearch)
+			default:
+				require.NoError(t, err)
+				assert.Equal(t, tt.query, log.Query)
+				assert.Equal(t, tt.ip, log.IPAddress)
+				assert.True(t, at.Equal(log.Timestamp), "got %s", log.Timestamp)
+			}
+		})
+	}
+}
+
+func TestBackfill_SkipsPartialLines(t *testing.T) {
+	dir := t.TempDir()
+	lines := `203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=kotlin HTTP/1.1" 200 512
+{"query": "kotlin", "timestamp": "2024-10-10T13:55:36Z"}
+{"query": "swi
+203.0.113.7 - - [10/Oct/2024:13:55:36 -0700] "GET /api/v1/autocomplete?q=sw`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "access.log"), []byte(lines), 0o644))
+
+	p, svc := newTestPipeline(Config{BatchSize: 10})
+	progress, err := p.Backfill(context.Background(), BackfillConfig{Dir: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), progress.Lines)
+	assert.Equal(t, int64(2), progress.Queries)
+	assert.Equal(t, int64(2), progress.Skipped, "lines cut off mid-write are skipped, not fatal")
+	assert.Zero(t, progress.FilesFailed)
+	assert.Equal(t, int64(2), frequency(svc, "kotlin"))
+	assert.Equal(t, 1, svc.SuggestionCount())
+}
@@ -2,30 +2,75 @@ package pipeline
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
 	"github.com/alexnthnz/search-autocomplete/internal/service"
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 )
 
+// selectionFrequency is how many searches a selection adds to the term's
+// frequency, which every user's results are ranked by. A pick is stronger
+// evidence of interest than a typed query, but it is kept lower than
+// personalization.SelectionWeight, which only shapes the picking user's own
+// results, so a few users can't push a term up for everyone.
+const selectionFrequency = 2
+
+// consumerName identifies the pipeline's committed offset in the query log
+const consumerName = "pipeline"
+
+// ErrBackpressure is returned by LogQuery when the query log consumer has
+// fallen too far behind to accept more logs
+var ErrBackpressure = errors.New("query log consumer is too far behind")
+
+// frequencyUpdate is a pending change to a suggestion. Each search adds one
+// to count but its service.ScoreWeight to score, which stays valid only
+// until the service's score epoch moves.
+type frequencyUpdate struct {
+	count int64
+	score float64
+}
+
+// add records n searches, each adding weight to the score
+func (u *frequencyUpdate) add(n int64, weight float64) {
+	u.count += n
+	u.score += float64(n) * weight
+}
+
 // DataPipeline processes search logs and updates suggestions
 type DataPipeline struct {
-	service       *service.AutocompleteService
-	logger        *logrus.Logger
-	logQueue      chan models.SearchLog
-	freqUpdates   map[string]int64
-	freqMutex     sync.RWMutex
-	batchSize     int
-	flushInterval time.Duration
-	stopChan      chan struct{}
-	wg            sync.WaitGroup
-	metrics       *metrics.Metrics
+	service        *service.AutocompleteService
+	logger         *logrus.Logger
+	logQueue       chan models.SearchLog
+	selectionQueue chan models.SelectionLog
+	freqUpdates    map[string]*frequencyUpdate
+	freqMutex      sync.RWMutex
+	epochMu        sync.RWMutex // Held for reading while scores are weighted and until they are applied
+	batchSize      int
+	flushInterval  time.Duration
+	trendInterval  time.Duration
+	stopChan       chan struct{}
+	wg             sync.WaitGroup
+	metrics        *metrics.Metrics
+
+	// Durable ingestion, when a query log is attached
+	queryLog            *persistence.QueryLog
+	readFrom            uint64        // Offset the consumer starts after
+	pendingOffset       uint64        // Last offset counted in freqUpdates, guarded by freqMutex
+	consumed            atomic.Uint64 // Last offset read by the consumer
+	committed           atomic.Uint64 // Last offset committed
+	maxLag              uint64
+	backpressureTimeout time.Duration
+
+	backfillProgress atomic.Pointer[BackfillProgress] // Latest backfill, nil if none ran
 }
 
 // Config holds pipeline configuration
@@ -33,6 +78,12 @@ type Config struct {
 	BatchSize     int
 	FlushInterval time.Duration
 	QueueSize     int
+	TrendInterval time.Duration // How often trending queries are re-scored
+
+	// Query log backpressure: LogQuery waits up to BackpressureTimeout while
+	// more than MaxLag logged queries are waiting to be read
+	MaxLag              int
+	BackpressureTimeout time.Duration
 }
 
 // NewDataPipeline creates a new data processing pipeline
@@ -46,17 +97,59 @@ func NewDataPipeline(service *service.AutocompleteService, config Config, logger
 	if config.QueueSize <= 0 {
 		config.QueueSize = 10000
 	}
+	if config.TrendInterval <= 0 {
+		config.TrendInterval = time.Minute
+	}
+	if config.MaxLag <= 0 {
+		config.MaxLag = 100000
+	}
+	if config.BackpressureTimeout <= 0 {
+		config.BackpressureTimeout = time.Second
+	}
 
 	return &DataPipeline{
-		service:       service,
-		logger:        logger,
-		logQueue:      make(chan models.SearchLog, config.QueueSize),
-		freqUpdates:   make(map[string]int64),
-		batchSize:     config.BatchSize,
-		flushInterval: config.FlushInterval,
-		stopChan:      make(chan struct{}),
-		metrics:       metricsInstance,
+		service:        service,
+		logger:         logger,
+		logQueue:       make(chan models.SearchLog, config.QueueSize),
+		selectionQueue: make(chan models.SelectionLog, config.QueueSize),
+		freqUpdates:    make(map[string]*frequencyUpdate),
+		batchSize:      config.BatchSize,
+		flushInterval:  config.FlushInterval,
+		trendInterval:  config.TrendInterval,
+		stopChan:       make(chan struct{}),
+		metrics:        metricsInstance,
+
+		maxLag:              uint64(config.MaxLag),
+		backpressureTimeout: config.BackpressureTimeout,
+	}
+}
+
+// AttachQueryLog makes search logs and selections durable: LogQuery and
+// LogSelection append them to log and the pipeline consumes them from there, committing its offset once their
+// frequencies are applied. Consumption resumes after the last committed
+// offset, or from the oldest retained entry when fromStart is set, which
+// rebuilds frequencies from history. It must be called before Start.
+func (p *DataPipeline) AttachQueryLog(log *persistence.QueryLog, fromStart bool) error {
+	committed, err := log.Committed(consumerName)
+	if err != nil {
+		return err
 	}
+
+	p.queryLog = log
+	p.committed.Store(committed)
+	if !fromStart {
+		p.readFrom = committed
+	}
+	p.pendingOffset = p.readFrom
+	p.consumed.Store(p.readFrom)
+
+	p.logger.WithFields(logrus.Fields{
+		"committed":   committed,
+		"last_offset": log.LastOffset(),
+		"from_start":  fromStart,
+	}).Info("Attached query log")
+
+	return nil
 }
 
 // Start begins processing search logs
@@ -74,6 +167,12 @@ func (p *DataPipeline) Start(ctx context.Context) {
 	// Start trending detector
 	p.wg.Add(1)
 	go p.detectTrending(ctx)
+
+	// Start query log consumer
+	if p.queryLog != nil {
+		p.wg.Add(1)
+		go p.consumeLog(ctx)
+	}
 }
 
 // Stop gracefully shuts down the pipeline
@@ -81,11 +180,24 @@ func (p *DataPipeline) Stop() {
 	p.logger.Info("Stopping data pipeline")
 	close(p.stopChan)
 	p.wg.Wait()
+
+	// The log processor may have queued updates after the last flush
+	p.flushFrequencyUpdates()
 	p.logger.Info("Data pipeline stopped")
 }
 
-// LogQuery adds a search query to the processing queue
+// LogQuery adds a search query to the processing queue. With a query log
+// attached the query is written to disk, waiting for the consumer to catch
+// up if it has fallen behind.
 func (p *DataPipeline) LogQuery(log models.SearchLog) error {
+	if p.queryLog != nil {
+		if err := p.appendLog(log); err != nil {
+			p.logger.WithError(err).Warn("Failed to log query")
+			return err
+		}
+		return nil
+	}
+
 	select {
 	case p.logQueue <- log:
 		// Update queue size metric
@@ -98,11 +210,91 @@ func (p *DataPipeline) LogQuery(log models.SearchLog) error {
 	}
 }
 
-// processLogs processes incoming search logs
+// appendLog writes a search log to the query log, applying backpressure
+func (p *DataPipeline) appendLog(log models.SearchLog) error {
+	if err := p.awaitConsumer(); err != nil {
+		return err
+	}
+
+	if _, err := p.queryLog.Append(log); err != nil {
+		p.metrics.RecordError("pipeline", "query_log")
+		return err
+	}
+
+	p.metrics.UpdatePipelineQueueSize(int(p.lag()))
+	return nil
+}
+
+// appendSelection writes a selection to the query log, applying
+// backpressure
+func (p *DataPipeline) appendSelection(selection models.SelectionLog) error {
+	if err := p.awaitConsumer(); err != nil {
+		return err
+	}
+
+	if _, err := p.queryLog.AppendSelection(selection); err != nil {
+		p.metrics.RecordError("pipeline", "query_log")
+		return err
+	}
+
+	p.metrics.UpdatePipelineQueueSize(int(p.lag()))
+	return nil
+}
+
+// awaitConsumer waits up to the backpressure timeout while the consumer is
+// too far behind to accept another entry
+func (p *DataPipeline) awaitConsumer() error {
+	deadline := time.Now().Add(p.backpressureTimeout)
+	for p.lag() >= p.maxLag {
+		if time.Now().After(deadline) {
+			p.metrics.RecordError("pipeline", "backpressure")
+			return ErrBackpressure
+		}
+		select {
+		case <-p.stopChan:
+			return ErrBackpressure
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// lag returns how many logged entries the consumer has yet to read
+func (p *DataPipeline) lag() uint64 {
+	last, consumed := p.queryLog.LastOffset(), p.consumed.Load()
+	if last <= consumed {
+		return 0
+	}
+	return last - consumed
+}
+
+// LogSelection adds a picked suggestion to the processing queue. With a
+// query log attached it is written to disk like a search.
+func (p *DataPipeline) LogSelection(selection models.SelectionLog) error {
+	if p.queryLog != nil {
+		if err := p.appendSelection(selection); err != nil {
+			p.logger.WithError(err).Warn("Failed to log selection")
+			return err
+		}
+		return nil
+	}
+
+	select {
+	case p.selectionQueue <- selection:
+		return nil
+	default:
+		p.logger.Warn("Selection queue is full, dropping selection")
+		p.metrics.RecordError("pipeline", "queue_full")
+		return fmt.Errorf("selection queue is full")
+	}
+}
+
+// processLogs processes incoming search logs and selections
 func (p *DataPipeline) processLogs(ctx context.Context) {
 	defer p.wg.Done()
 
 	logs := make([]models.SearchLog, 0, p.batchSize)
+	selections := make([]models.SelectionLog, 0, p.batchSize)
 	ticker := time.NewTicker(p.flushInterval)
 	defer ticker.Stop()
 
@@ -110,9 +302,11 @@ func (p *DataPipeline) processLogs(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			p.processBatch(logs)
+			p.processSelections(selections)
 			return
 		case <-p.stopChan:
 			p.processBatch(logs)
+			p.processSelections(selections)
 			return
 		case log := <-p.logQueue:
 			logs = append(logs, log)
@@ -120,11 +314,88 @@ func (p *DataPipeline) processLogs(ctx context.Context) {
 				p.processBatch(logs)
 				logs = logs[:0] // Clear slice
 			}
+		case selection := <-p.selectionQueue:
+			selections = append(selections, selection)
+			if len(selections) >= p.batchSize {
+				p.processSelections(selections)
+				selections = selections[:0]
+			}
 		case <-ticker.C:
 			if len(logs) > 0 {
 				p.processBatch(logs)
 				logs = logs[:0]
 			}
+			if len(selections) > 0 {
+				p.processSelections(selections)
+				selections = selections[:0]
+			}
+		}
+	}
+}
+
+// consumeLog reads search logs and selections from the query log in batches
+func (p *DataPipeline) consumeLog(ctx context.Context) {
+	defer p.wg.Done()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reader := p.queryLog.NewReader(p.readFrom)
+	defer reader.Close()
+
+	logs := make([]models.SearchLog, 0, p.batchSize)
+	selections := make([]models.SelectionLog, 0, p.batchSize)
+	for {
+		entry, ok, err := reader.Next()
+		if err != nil {
+			p.logger.WithError(err).Error("Failed to read query log")
+			p.metrics.RecordError("pipeline", "query_log")
+			ok = false
+		}
+		if ok {
+			if entry.Kind == persistence.QueryLogSelection {
+				selections = append(selections, entry.Selection)
+			} else {
+				logs = append(logs, entry.Log)
+			}
+			if len(logs)+len(selections) < p.batchSize {
+				continue
+			}
+		}
+
+		if len(logs)+len(selections) > 0 {
+			p.processBatch(logs)
+			p.processSelections(selections)
+			logs = logs[:0]
+			selections = selections[:0]
+
+			// Only once the counts are pending can the offset be committed
+			p.freqMutex.Lock()
+			p.pendingOffset = reader.Offset()
+			p.freqMutex.Unlock()
+			p.consumed.Store(reader.Offset())
+		}
+		if ok {
+			continue
+		}
+
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(p.flushInterval):
+			}
+			continue
+		}
+		if err := reader.Wait(ctx); err != nil {
+			return
 		}
 	}
 }
@@ -138,25 +409,24 @@ func (p *DataPipeline) processBatch(logs []models.SearchLog) {
 	start := time.Now()
 	p.logger.WithField("count", len(logs)).Debug("Processing log batch")
 
-	queryFreq := make(map[string]int64)
+	p.epochMu.RLock()
+	defer p.epochMu.RUnlock()
 
-	// Aggregate query frequencies
+	queryFreq := make(map[string]*frequencyUpdate)
+
+	// Aggregate query frequencies and feed the trend counters. Both go by
+	// when the search was made, so older logs count for less.
+	trends := p.service.Trending()
 	for _, log := range logs {
 		query := normalizeQuery(log.Query)
 		if query != "" {
-			queryFreq[query]++
+			update(queryFreq, query).add(1, p.service.ScoreWeight(log.Timestamp))
+			trends.Record(query, log.Timestamp)
 		}
 	}
 
 	// Update frequency tracking
-	p.freqMutex.Lock()
-	for query, count := range queryFreq {
-		p.freqUpdates[query] += count
-	}
-	p.freqMutex.Unlock()
-
-	// Extract and add new suggestions from queries
-	p.extractNewSuggestions(queryFreq)
+	p.queueUpdates(queryFreq)
 
 	// Record processing metrics
 	p.metrics.RecordPipelineProcessed("batch")
@@ -164,7 +434,62 @@ func (p *DataPipeline) processBatch(logs []models.SearchLog) {
 	p.metrics.UpdatePipelineQueueSize(len(p.logQueue))
 }
 
-// updateFrequencies periodically updates suggestion frequencies
+// processSelections processes a batch of picked suggestions. Each pick counts
+// towards the term's frequency and towards ranking it for the query it was
+// picked from.
+func (p *DataPipeline) processSelections(selections []models.SelectionLog) {
+	if len(selections) == 0 {
+		return
+	}
+
+	start := time.Now()
+	p.logger.WithField("count", len(selections)).Debug("Processing selection batch")
+
+	p.epochMu.RLock()
+	termFreq := make(map[string]*frequencyUpdate)
+	for _, selection := range selections {
+		term := strings.ToLower(strings.TrimSpace(selection.Term))
+		if term == "" {
+			continue
+		}
+		update(termFreq, term).add(selectionFrequency, p.service.ScoreWeight(selection.Timestamp))
+	}
+
+	p.queueUpdates(termFreq)
+	p.epochMu.RUnlock()
+
+	for _, selection := range selections {
+		p.service.RecordQuerySelection(selection.Query, selection.Term, selection.Position)
+	}
+
+	p.metrics.RecordPipelineProcessed("selection_batch")
+	p.metrics.RecordPipelineLatency("selection_batch", time.Since(start))
+}
+
+// update returns the pending update for term, adding one if needed
+func update(updates map[string]*frequencyUpdate, term string) *frequencyUpdate {
+	u, ok := updates[term]
+	if !ok {
+		u = &frequencyUpdate{}
+		updates[term] = u
+	}
+	return u
+}
+
+// queueUpdates merges a batch's updates into those waiting to be flushed
+func (p *DataPipeline) queueUpdates(updates map[string]*frequencyUpdate) {
+	p.freqMutex.Lock()
+	defer p.freqMutex.Unlock()
+
+	for term, u := range updates {
+		pending := update(p.freqUpdates, term)
+		pending.count += u.count
+		pending.score += u.score
+	}
+}
+
+// updateFrequencies periodically updates suggestion frequencies and decays
+// scores
 func (p *DataPipeline) updateFrequencies(ctx context.Context) {
 	defer p.wg.Done()
 
@@ -181,30 +506,64 @@ func (p *DataPipeline) updateFrequencies(ctx context.Context) {
 			return
 		case <-ticker.C:
 			p.flushFrequencyUpdates()
+			p.decayScores()
 		}
 	}
 }
 
 // flushFrequencyUpdates applies accumulated frequency updates
 func (p *DataPipeline) flushFrequencyUpdates() {
+	p.epochMu.RLock()
+	defer p.epochMu.RUnlock()
+
+	p.applyFrequencyUpdates()
+}
+
+// applyFrequencyUpdates applies accumulated frequency updates. Callers must
+// hold epochMu.
+func (p *DataPipeline) applyFrequencyUpdates() {
 	start := time.Now()
 
 	p.freqMutex.Lock()
-	updates := make(map[string]int64)
-	for query, count := range p.freqUpdates {
-		updates[query] = count
-	}
-	p.freqUpdates = make(map[string]int64) // Clear the map
+	updates := p.freqUpdates
+	p.freqUpdates = make(map[string]*frequencyUpdate) // Clear the map
+	offset := p.pendingOffset
 	p.freqMutex.Unlock()
 
 	if len(updates) == 0 {
+		p.commitOffset(offset)
 		return
 	}
 
 	p.logger.WithField("count", len(updates)).Debug("Flushing frequency updates")
 
-	for query, count := range updates {
-		p.service.UpdateFrequency(query, count)
+	// Counts are added to the stored frequencies. Queries that aren't
+	// suggestions yet may become new ones.
+	failed := make(map[string]*frequencyUpdate)
+	newQueries := make(map[string]*frequencyUpdate)
+	for query, u := range updates {
+		found, err := p.service.AddFrequency(query, u.count, u.score)
+		if err != nil {
+			p.logger.WithError(err).WithField("query", query).Error("Failed to update frequency")
+			failed[query] = u
+			continue
+		}
+		if !found {
+			newQueries[query] = u
+		}
+	}
+	for query, u := range p.extractNewSuggestions(newQueries) {
+		failed[query] = u
+	}
+
+	// Logs up to offset are reflected in the index once every update is
+	// applied, so a restart resumes after them. Failed updates are retried
+	// with the next flush, and the offset waits for them.
+	if len(failed) > 0 {
+		p.queueUpdates(failed)
+		p.metrics.RecordError("pipeline", "frequency_update_failed")
+	} else {
+		p.commitOffset(offset)
 	}
 
 	// Record flush metrics
@@ -212,38 +571,83 @@ func (p *DataPipeline) flushFrequencyUpdates() {
 	p.metrics.RecordPipelineLatency("frequency_flush", time.Since(start))
 }
 
-// extractNewSuggestions identifies potential new suggestions from search queries
-func (p *DataPipeline) extractNewSuggestions(queryFreq map[string]int64) {
-	for query, freq := range queryFreq {
+// commitOffset records that the query log has been processed up to offset
+func (p *DataPipeline) commitOffset(offset uint64) {
+	if p.queryLog == nil || offset <= p.committed.Load() {
+		return
+	}
+
+	if err := p.queryLog.Commit(consumerName, offset); err != nil {
+		p.logger.WithError(err).Error("Failed to commit query log offset")
+		p.metrics.RecordError("pipeline", "query_log")
+		return
+	}
+	p.committed.Store(offset)
+}
+
+// decayScores lets the service rescale scores to a newer epoch when they grow
+// too large. Pending scores are weighted from the current epoch, so they are
+// applied first and none are weighted while the epoch moves. If some failed
+// to apply, the rescale waits for a later tick.
+func (p *DataPipeline) decayScores() {
+	p.epochMu.Lock()
+	defer p.epochMu.Unlock()
+
+	p.applyFrequencyUpdates()
+
+	p.freqMutex.RLock()
+	pending := len(p.freqUpdates)
+	p.freqMutex.RUnlock()
+	if pending > 0 {
+		return
+	}
+
+	start := time.Now()
+	if err := p.service.DecayScores(start); err != nil {
+		p.logger.WithError(err).Error("Failed to decay scores")
+		return
+	}
+
+	p.metrics.RecordPipelineProcessed("score_decay")
+	p.metrics.RecordPipelineLatency("score_decay", time.Since(start))
+}
+
+// extractNewSuggestions identifies potential new suggestions from search
+// queries. It returns the updates for queries that failed to be added.
+func (p *DataPipeline) extractNewSuggestions(queryFreq map[string]*frequencyUpdate) map[string]*frequencyUpdate {
+	failed := make(map[string]*frequencyUpdate)
+	for query, u := range queryFreq {
 		// Skip very short or very long queries
 		if len(query) < 2 || len(query) > 50 {
 			continue
 		}
 
-		// Create suggestion with basic scoring
+		// Create suggestion with basic scoring. AddSuggestion weights the
+		// score as of now, so it is given the present-day one.
 		suggestion := models.Suggestion{
 			Term:      query,
-			Frequency: freq,
-			Score:     float64(freq),
+			Frequency: u.count,
+			Score:     u.score / p.service.ScoreWeight(time.Time{}),
 			Category:  p.categorizeQuery(query),
 			UpdatedAt: time.Now(),
 		}
 
 		// Add as potential suggestion
-		p.service.AddSuggestion(suggestion)
+		if err := p.service.AddSuggestion(suggestion); err != nil {
+			p.logger.WithError(err).WithField("query", query).Error("Failed to add suggestion")
+			failed[query] = u
+		}
 	}
+	return failed
 }
 
-// detectTrending identifies trending search terms
+// detectTrending periodically re-scores queries to find trending ones
 func (p *DataPipeline) detectTrending(ctx context.Context) {
 	defer p.wg.Done()
 
-	ticker := time.NewTicker(time.Hour) // Check for trends hourly
+	ticker := time.NewTicker(p.trendInterval)
 	defer ticker.Stop()
 
-	recentQueries := make(map[string][]time.Time)
-	var mutex sync.RWMutex
-
 	for {
 		select {
 		case <-ctx.Done():
@@ -251,67 +655,25 @@ func (p *DataPipeline) detectTrending(ctx context.Context) {
 		case <-p.stopChan:
 			return
 		case <-ticker.C:
-			p.analyzeTrends(recentQueries, &mutex)
+			p.updateTrends()
 		}
 	}
 }
 
-// analyzeTrends analyzes query patterns to identify trending terms
-func (p *DataPipeline) analyzeTrends(recentQueries map[string][]time.Time, mutex *sync.RWMutex) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	now := time.Now()
-	hourAgo := now.Add(-time.Hour)
-	dayAgo := now.Add(-24 * time.Hour)
-
-	trending := make(map[string]float64)
-
-	for query, timestamps := range recentQueries {
-		// Clean old timestamps
-		var recent []time.Time
-		for _, ts := range timestamps {
-			if ts.After(dayAgo) {
-				recent = append(recent, ts)
-			}
-		}
-		recentQueries[query] = recent
-
-		if len(recent) < 5 { // Need minimum queries to consider trending
-			continue
-		}
-
-		// Count queries in last hour vs last day
-		hourCount := 0
-		dayCount := len(recent)
-
-		for _, ts := range recent {
-			if ts.After(hourAgo) {
-				hourCount++
-			}
-		}
-
-		// Calculate trend score (recent activity vs historical)
-		if dayCount > hourCount {
-			trendScore := float64(hourCount) / float64(dayCount-hourCount)
-			if trendScore > 1.5 { // Trending threshold
-				trending[query] = trendScore
-			}
-		}
-	}
-
-	// Boost trending terms
-	for query, score := range trending {
-		currentFreq := int64(len(recentQueries[query]))
-		boostedFreq := int64(float64(currentFreq) * (1.0 + score))
-		p.service.UpdateFrequency(query, boostedFreq)
+// updateTrends refreshes trend scores and ranking boosts
+func (p *DataPipeline) updateTrends() {
+	start := time.Now()
 
+	for _, trend := range p.service.Trending().Update() {
 		p.logger.WithFields(logrus.Fields{
-			"query":       query,
-			"trend_score": score,
-			"frequency":   boostedFreq,
+			"query":       trend.Query,
+			"trend_score": trend.Score,
+			"count":       trend.Count,
 		}).Info("Detected trending query")
 	}
+
+	p.metrics.RecordPipelineProcessed("trending")
+	p.metrics.RecordPipelineLatency("trending", time.Since(start))
 }
 
 // categorizeQuery attempts to categorize a search query
@@ -362,12 +724,29 @@ func (p *DataPipeline) GetStats() map[string]interface{} {
 	pendingUpdates := len(p.freqUpdates)
 	p.freqMutex.RUnlock()
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"queue_length":    len(p.logQueue),
+		"selection_queue": len(p.selectionQueue),
 		"pending_updates": pendingUpdates,
 		"batch_size":      p.batchSize,
 		"flush_interval":  p.flushInterval.String(),
+		"trending":        len(p.service.Trending().Trending()),
+	}
+
+	if p.queryLog != nil {
+		stats["query_log"] = map[string]interface{}{
+			"last_offset":      p.queryLog.LastOffset(),
+			"consumed_offset":  p.consumed.Load(),
+			"committed_offset": p.committed.Load(),
+			"lag":              p.lag(),
+		}
 	}
+
+	if progress := p.backfillProgress.Load(); progress != nil {
+		stats["backfill"] = *progress
+	}
+
+	return stats
 }
 
 // LoadHistoricalData simulates loading historical search data
@@ -394,6 +773,14 @@ func (p *DataPipeline) LoadHistoricalData() {
 				IPAddress: fmt.Sprintf("192.168.1.%d", j%255),
 			}
 
+			if p.queryLog != nil {
+				if err := p.appendLog(log); err != nil {
+					p.logger.WithError(err).Warn("Stopped loading historical data")
+					return
+				}
+				continue
+			}
+
 			// Don't block if queue is full during historical load
 			select {
 			case p.logQueue <- log:
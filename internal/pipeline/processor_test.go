@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/internal/service"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// newTestPipeline returns a pipeline feeding an empty index
+func newTestPipeline(config Config) (*DataPipeline, *service.AutocompleteService) {
+	logger, m := testLogger(), metrics.NewMetrics()
+	svc := service.NewAutocompleteService(service.Config{}, nil, logger, m)
+	return NewDataPipeline(svc, config, logger, m), svc
+}
+
+func openTestQueryLog(t *testing.T, dir string) *persistence.QueryLog {
+	queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{Dir: dir, SyncPolicy: persistence.SyncAlways}, testLogger())
+	require.NoError(t, err)
+	return queryLog
+}
+
+// frequency returns the frequency stored for term, 0 if it isn't stored
+func frequency(svc *service.AutocompleteService, term string) int64 {
+	suggestion, _ := svc.GetSuggestion(term)
+	return suggestion.Frequency
+}
+
+func TestDataPipeline_ResumesFromCommittedOffset(t *testing.T) {
+	dir := t.TempDir()
+	queryLog := openTestQueryLog(t, dir)
+	for _, query := range []string{"kotlin", "kotlin", "swift"} {
+		_, err := queryLog.Append(models.SearchLog{Query: query, Timestamp: time.Now()})
+		require.NoError(t, err)
+	}
+	require.NoError(t, queryLog.Commit(consumerName, 2))
+
+	// consume attaches a new pipeline to the log and runs it until it has
+	// read every entry
+	consume := func(fromStart bool) *service.AutocompleteService {
+		p, svc := newTestPipeline(Config{BatchSize: 1, FlushInterval: 10 * time.Millisecond})
+		require.NoError(t, p.AttachQueryLog(queryLog, fromStart))
+		p.Start(context.Background())
+		require.Eventually(t, func() bool { return p.lag() == 0 }, time.Second, 5*time.Millisecond)
+		p.Stop()
+		return svc
+	}
+
+	svc := consume(false)
+	assert.Zero(t, frequency(svc, "kotlin"), "entries up to the committed offset are skipped")
+	assert.Equal(t, int64(1), frequency(svc, "swift"))
+
+	committed, err := queryLog.Committed(consumerName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), committed, "the offset moves on once the update is applied")
+
+	// Nothing is left after the new commit, however often the log is reopened
+	require.NoError(t, queryLog.Close())
+	queryLog = openTestQueryLog(t, dir)
+	defer queryLog.Close()
+	svc = consume(false)
+	assert.Zero(t, svc.SuggestionCount())
+
+	// Reading from the start ignores the committed offset
+	svc = consume(true)
+	assert.Equal(t, int64(2), frequency(svc, "kotlin"))
+	assert.Equal(t, int64(1), frequency(svc, "swift"))
+}
+
+func TestDataPipeline_Backpressure(t *testing.T) {
+	queryLog := openTestQueryLog(t, t.TempDir())
+	defer queryLog.Close()
+
+	p, _ := newTestPipeline(Config{MaxLag: 2, BackpressureTimeout: 20 * time.Millisecond})
+	require.NoError(t, p.AttachQueryLog(queryLog, false))
+
+	// Nothing consumes, so the lag reaches MaxLag after two entries
+	require.NoError(t, p.LogQuery(models.SearchLog{Query: "kotlin"}))
+	require.NoError(t, p.LogSelection(models.SelectionLog{Query: "ko", Term: "kotlin"}))
+	assert.Equal(t, uint64(2), p.lag())
+
+	start := time.Now()
+	assert.ErrorIs(t, p.LogQuery(models.SearchLog{Query: "kotlin"}), ErrBackpressure)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond, "callers wait for the consumer before giving up")
+	assert.ErrorIs(t, p.LogSelection(models.SelectionLog{Query: "ko", Term: "kotlin"}), ErrBackpressure)
+	assert.Equal(t, uint64(2), queryLog.LastOffset(), "rejected entries are not written")
+
+	// Once the consumer has read an entry, one more is accepted
+	p.consumed.Store(1)
+	assert.NoError(t, p.LogQuery(models.SearchLog{Query: "kotlin"}))
+	assert.ErrorIs(t, p.LogQuery(models.SearchLog{Query: "kotlin"}), ErrBackpressure)
+}
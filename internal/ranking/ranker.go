@@ -0,0 +1,190 @@
+package ranking
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/internal/personalization"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Stage names accepted in Config.Stages
+const (
+	StageFrequency       = "frequency"
+	StageFuzzy           = "fuzzy"
+	StageMatch           = "match"
+	StageLength          = "length"
+	StageRecency         = "recency"
+	StageTrending        = "trending"
+	StageCategory        = "category"
+	StageSelection       = "selection"
+	StagePersonalization = "personalization"
+)
+
+// DefaultStages is the stage order used when none is configured
+var DefaultStages = []string{StageFrequency, StageFuzzy, StageMatch, StageLength, StageRecency, StageTrending, StageCategory, StageSelection, StagePersonalization}
+
+// Query carries what the stages know about the request being ranked
+type Query struct {
+	Text          string                   // Normalized query
+	Profile       *personalization.Profile // Nil unless personalization is enabled and the user has history
+	Selections    *personalization.Profile // Suggestions picked for this query by anyone, nil if none
+	Trending      map[string]float64       // Boost strength of trending queries, from 0 to 1
+	EditDistances map[string]int           // Edits each fuzzy match needed, by term
+	Explain       bool                     // Attach a per-stage explanation to each result
+	Now           time.Time
+}
+
+// Stage adjusts a candidate's score. Stages run in order and each one sees
+// the score left by the stages before it.
+type Stage interface {
+	Name() string
+	Score(query Query, suggestion models.Suggestion, score float64) float64
+}
+
+// Ranker orders suggestions for a query. It never modifies the suggestions
+// it is given; the score it computes is returned separately.
+type Ranker interface {
+	Rank(query Query, suggestions []models.Suggestion) []models.RankedSuggestion
+}
+
+// Pipeline is a Ranker that runs its stages in order
+type Pipeline struct {
+	stages []Stage
+}
+
+// NewPipeline creates a ranker from the given stages
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Config holds ranking configuration
+type Config struct {
+	Stages          []string           // Stage names in order, DefaultStages when empty
+	CategoryWeights map[string]float64 // Multipliers for the category stage
+	FuzzyPenalty    float64            // Multiplier applied per edit of a fuzzy match
+	LeadingBoost    float64            // Multiplier for a match on the term's leading word
+	TermBoost       float64            // Personalization boost for the user's strongest term
+	CategoryBoost   float64            // Personalization boost for the user's strongest category
+	SelectionBoost  float64            // Boost for the suggestion picked most often for the query
+	RecencyBoost    float64            // Boost for a suggestion updated just now
+	RecencyHalfLife time.Duration      // Age at which the recency boost halves
+	TrendingBoost   float64            // Boost for a suggestion that is trending at full strength
+	LengthScale     float64            // Characters at which the length stage halves a score
+}
+
+// New builds the ranking pipeline described by config
+func New(config Config) (*Pipeline, error) {
+	names := config.Stages
+	if len(names) == 0 {
+		names = DefaultStages
+	}
+
+	stages := make([]Stage, 0, len(names))
+	for _, name := range names {
+		switch name {
+		case StageFrequency:
+			stages = append(stages, FrequencyStage{})
+		case StageFuzzy:
+			stages = append(stages, FuzzyStage{Penalty: config.FuzzyPenalty})
+		case StageMatch:
+			stages = append(stages, MatchStage{LeadingBoost: config.LeadingBoost})
+		case StageLength:
+			stages = append(stages, LengthStage{Scale: config.LengthScale})
+		case StageRecency:
+			stages = append(stages, RecencyStage{Boost: config.RecencyBoost, HalfLife: config.RecencyHalfLife})
+		case StageTrending:
+			stages = append(stages, TrendingStage{Boost: config.TrendingBoost})
+		case StageCategory:
+			stages = append(stages, CategoryStage{Weights: config.CategoryWeights})
+		case StageSelection:
+			stages = append(stages, SelectionStage{Boost: config.SelectionBoost})
+		case StagePersonalization:
+			stages = append(stages, PersonalizationStage{TermBoost: config.TermBoost, CategoryBoost: config.CategoryBoost})
+		default:
+			return nil, fmt.Errorf("unknown ranking stage %q", name)
+		}
+	}
+
+	return NewPipeline(stages...), nil
+}
+
+// Rank scores every suggestion and returns them best first
+func (p *Pipeline) Rank(query Query, suggestions []models.Suggestion) []models.RankedSuggestion {
+	if query.Now.IsZero() {
+		query.Now = time.Now()
+	}
+
+	ranked := make([]models.RankedSuggestion, len(suggestions))
+	for i, suggestion := range suggestions {
+		var explanation *models.Explanation
+		if query.Explain {
+			explanation = &models.Explanation{BaseScore: suggestion.Score}
+		}
+
+		score := 0.0
+		for _, stage := range p.stages {
+			before := score
+			score = stage.Score(query, suggestion, score)
+
+			if explanation != nil {
+				step := models.RankingStep{Stage: stage.Name(), Score: score}
+				if before != 0 {
+					step.Multiplier = score / before
+				}
+				explanation.Steps = append(explanation.Steps, step)
+			}
+		}
+		if explanation != nil {
+			explanation.EditDistance = query.EditDistances[suggestion.Term]
+		}
+
+		ranked[i] = models.RankedSuggestion{Suggestion: suggestion, FinalScore: score, Explanation: explanation}
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].FinalScore != ranked[j].FinalScore {
+			return ranked[i].FinalScore > ranked[j].FinalScore
+		}
+		return ranked[i].Term < ranked[j].Term
+	})
+
+	return ranked
+}
+
+// ParseStages parses a comma-separated list of stage names
+func ParseStages(value string) []string {
+	var stages []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			stages = append(stages, name)
+		}
+	}
+	return stages
+}
+
+// ParseWeights parses comma-separated category:weight pairs such as
+// "tech:1.2,sports:0.8"
+func ParseWeights(value string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		category, weightStr, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid category weight %q", pair)
+		}
+		weight, err := strconv.ParseFloat(strings.TrimSpace(weightStr), 64)
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight for category %q", category)
+		}
+		weights[strings.TrimSpace(category)] = weight
+	}
+	return weights, nil
+}
@@ -0,0 +1,154 @@
+package ranking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/alexnthnz/search-autocomplete/internal/personalization"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+func TestPipeline_DoesNotModifySuggestions(t *testing.T) {
+	ranker, err := New(Config{})
+	require.NoError(t, err)
+
+	now := time.Now()
+	suggestions := []models.Suggestion{
+		{Term: "python programming", Score: 100, UpdatedAt: now},
+		{Term: "pro", Score: 100, UpdatedAt: now},
+	}
+	original := append([]models.Suggestion(nil), suggestions...)
+
+	first := ranker.Rank(Query{Text: "pro", Now: now}, suggestions)
+	second := ranker.Rank(Query{Text: "pro", Now: now}, suggestions)
+
+	assert.Equal(t, original, suggestions, "stored scores are left alone")
+	assert.Equal(t, first, second, "ranking the same input twice gives the same scores")
+	assert.Equal(t, "pro", first[0].Term)
+	assert.Equal(t, 100.0, first[0].Score)
+	assert.NotEqual(t, first[0].Score, first[0].FinalScore)
+}
+
+func TestPipeline_Stages(t *testing.T) {
+	now := time.Now()
+	query := Query{Text: "ap", Now: now}
+	suggestion := models.Suggestion{Term: "apple", Score: 100, Category: "fruit"}
+
+	tests := []struct {
+		name   string
+		config Config
+		query  Query
+		want   float64
+	}{
+		{"frequency only", Config{Stages: []string{StageFrequency}}, query, 100},
+		{"leading match", Config{Stages: []string{StageFrequency, StageMatch}}, query, 200},
+		{"inner match", Config{Stages: []string{StageFrequency, StageMatch}}, Query{Text: "pie", Now: now}, 100},
+		{"leading boost", Config{Stages: []string{StageFrequency, StageMatch}, LeadingBoost: 3}, query, 300},
+		{"length", Config{Stages: []string{StageFrequency, StageLength}, LengthScale: 5}, query, 50},
+		{"category weight", Config{Stages: []string{StageFrequency, StageCategory}, CategoryWeights: map[string]float64{"fruit": 1.5}}, query, 150},
+		{"unweighted category", Config{Stages: []string{StageFrequency, StageCategory}, CategoryWeights: map[string]float64{"tech": 1.5}}, query, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranker, err := New(tt.config)
+			require.NoError(t, err)
+
+			ranked := ranker.Rank(tt.query, []models.Suggestion{suggestion})
+			require.Len(t, ranked, 1)
+			assert.InDelta(t, tt.want, ranked[0].FinalScore, 1e-9)
+		})
+	}
+}
+
+func TestPipeline_Explain(t *testing.T) {
+	ranker, err := New(Config{Stages: []string{StageFrequency, StageFuzzy, StageMatch, StageCategory}, CategoryWeights: map[string]float64{"fruit": 1.5}})
+	require.NoError(t, err)
+
+	suggestions := []models.Suggestion{{Term: "apple", Score: 100, Category: "fruit"}}
+	query := Query{Text: "aple", EditDistances: map[string]int{"apple": 1}}
+
+	assert.Nil(t, ranker.Rank(query, suggestions)[0].Explanation, "only explained on request")
+
+	query.Explain = true
+	ranked := ranker.Rank(query, suggestions)
+	explanation := ranked[0].Explanation
+	require.NotNil(t, explanation)
+	assert.Equal(t, 100.0, explanation.BaseScore)
+	assert.Equal(t, 1, explanation.EditDistance)
+
+	require.Len(t, explanation.Steps, 4)
+	assert.Equal(t, models.RankingStep{Stage: StageFrequency, Score: 100}, explanation.Steps[0])
+	assert.Equal(t, StageFuzzy, explanation.Steps[1].Stage)
+	assert.InDelta(t, 0.8, explanation.Steps[1].Multiplier, 1e-9)
+	assert.InDelta(t, 1.0, explanation.Steps[2].Multiplier, 1e-9, "inner or fuzzy matches get no leading boost")
+	assert.InDelta(t, 1.5, explanation.Steps[3].Multiplier, 1e-9)
+	assert.InDelta(t, ranked[0].FinalScore, explanation.Steps[3].Score, 1e-9)
+}
+
+func TestRecencyStage_Decays(t *testing.T) {
+	now := time.Now()
+	stage := RecencyStage{Boost: 0.5, HalfLife: time.Hour}
+
+	fresh := stage.Score(Query{Now: now}, models.Suggestion{UpdatedAt: now}, 100)
+	hourOld := stage.Score(Query{Now: now}, models.Suggestion{UpdatedAt: now.Add(-time.Hour)}, 100)
+	undated := stage.Score(Query{Now: now}, models.Suggestion{}, 100)
+
+	assert.InDelta(t, 150, fresh, 1e-9)
+	assert.InDelta(t, 125, hourOld, 1e-9)
+	assert.Equal(t, 100.0, undated)
+}
+
+func TestPersonalizationStage(t *testing.T) {
+	stage := PersonalizationStage{TermBoost: 0.5, CategoryBoost: 0.2}
+	profile := &personalization.Profile{
+		Terms:      map[string]float64{"python programming": 1},
+		Categories: map[string]float64{"tech": 0.5},
+	}
+	query := Query{Profile: profile}
+
+	assert.InDelta(t, 160, stage.Score(query, models.Suggestion{Term: "Python Programming", Category: "tech"}, 100), 1e-9)
+	assert.InDelta(t, 110, stage.Score(query, models.Suggestion{Term: "java", Category: "tech"}, 100), 1e-9)
+	assert.Equal(t, 100.0, stage.Score(query, models.Suggestion{Term: "banana", Category: "fruit"}, 100))
+	assert.Equal(t, 100.0, stage.Score(Query{}, models.Suggestion{Term: "python programming", Category: "tech"}, 100))
+}
+
+func TestTrendingStage(t *testing.T) {
+	stage := TrendingStage{Boost: 1}
+	query := Query{Trending: map[string]float64{"world cup": 0.5}}
+
+	assert.InDelta(t, 150, stage.Score(query, models.Suggestion{Term: "World Cup"}, 100), 1e-9)
+	assert.Equal(t, 100.0, stage.Score(query, models.Suggestion{Term: "world"}, 100))
+	assert.Equal(t, 100.0, stage.Score(Query{}, models.Suggestion{Term: "world cup"}, 100))
+}
+
+func TestSelectionStage(t *testing.T) {
+	stage := SelectionStage{Boost: 0.5}
+	query := Query{Selections: &personalization.Profile{Terms: map[string]float64{"application": 1, "apple": 0.5}}}
+
+	assert.InDelta(t, 150, stage.Score(query, models.Suggestion{Term: "Application"}, 100), 1e-9)
+	assert.InDelta(t, 125, stage.Score(query, models.Suggestion{Term: "apple"}, 100), 1e-9)
+	assert.Equal(t, 100.0, stage.Score(query, models.Suggestion{Term: "app"}, 100))
+	assert.Equal(t, 100.0, stage.Score(Query{}, models.Suggestion{Term: "application"}, 100))
+}
+
+func TestNew_RejectsUnknownStage(t *testing.T) {
+	_, err := New(Config{Stages: []string{StageFrequency, "popularity"}})
+	assert.Error(t, err)
+}
+
+func TestParseWeights(t *testing.T) {
+	weights, err := ParseWeights("tech:1.2, sports : 0.8,")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"tech": 1.2, "sports": 0.8}, weights)
+
+	_, err = ParseWeights("tech")
+	assert.Error(t, err)
+	_, err = ParseWeights("tech:-1")
+	assert.Error(t, err)
+
+	assert.Equal(t, []string{"frequency", "match"}, ParseStages(" frequency, ,match"))
+}
@@ -0,0 +1,187 @@
+package ranking
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alexnthnz/search-autocomplete/internal/trie"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// FrequencyStage starts from the suggestion's stored score, which defaults
+// to its frequency
+type FrequencyStage struct{}
+
+func (FrequencyStage) Name() string { return StageFrequency }
+
+func (FrequencyStage) Score(_ Query, suggestion models.Suggestion, score float64) float64 {
+	return score + suggestion.Score
+}
+
+// FuzzyStage penalizes fuzzy matches for every edit they needed
+type FuzzyStage struct {
+	Penalty float64 // Defaults to 0.8
+}
+
+func (FuzzyStage) Name() string { return StageFuzzy }
+
+func (s FuzzyStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	distance := query.EditDistances[suggestion.Term]
+	if distance == 0 {
+		return score
+	}
+
+	penalty := s.Penalty
+	if penalty <= 0 {
+		penalty = 0.8
+	}
+	return score * math.Pow(penalty, float64(distance))
+}
+
+// MatchStage prefers matches on the leading word over matches on inner words
+type MatchStage struct {
+	LeadingBoost float64 // Defaults to 2
+}
+
+func (MatchStage) Name() string { return StageMatch }
+
+func (s MatchStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	_, leading := trie.MatchTokens(suggestion.Term, query.Text)
+	if !leading && !strings.HasPrefix(strings.ToLower(suggestion.Term), query.Text) {
+		return score
+	}
+
+	boost := s.LeadingBoost
+	if boost <= 0 {
+		boost = 2.0
+	}
+	return score * boost
+}
+
+// LengthStage favors shorter terms, which are more likely to be what the
+// user wants
+type LengthStage struct {
+	Scale float64 // Defaults to 10
+}
+
+func (LengthStage) Name() string { return StageLength }
+
+func (s LengthStage) Score(_ Query, suggestion models.Suggestion, score float64) float64 {
+	scale := s.Scale
+	if scale <= 0 {
+		scale = 10
+	}
+	return score / (1.0 + float64(utf8.RuneCountInString(suggestion.Term))/scale)
+}
+
+// RecencyStage boosts recently updated suggestions, with the boost decaying
+// exponentially with age
+type RecencyStage struct {
+	Boost    float64       // Defaults to 0.1
+	HalfLife time.Duration // Defaults to a week
+}
+
+func (RecencyStage) Name() string { return StageRecency }
+
+func (s RecencyStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	if suggestion.UpdatedAt.IsZero() {
+		return score
+	}
+
+	boost, halfLife := s.Boost, s.HalfLife
+	if boost <= 0 {
+		boost = 0.1
+	}
+	if halfLife <= 0 {
+		halfLife = 7 * 24 * time.Hour
+	}
+
+	age := max(query.Now.Sub(suggestion.UpdatedAt), 0)
+	return score * (1.0 + boost*math.Pow(0.5, float64(age)/float64(halfLife)))
+}
+
+// TrendingStage boosts suggestions that are being searched for much more
+// often than usual. The boost fades out after the trend ends.
+type TrendingStage struct {
+	Boost float64 // Boost at full trend strength, defaults to 1
+}
+
+func (TrendingStage) Name() string { return StageTrending }
+
+func (s TrendingStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	strength, ok := query.Trending[strings.ToLower(suggestion.Term)]
+	if !ok {
+		return score
+	}
+
+	boost := s.Boost
+	if boost <= 0 {
+		boost = 1.0
+	}
+	return score * (1.0 + boost*strength)
+}
+
+// CategoryStage weights suggestions by category
+type CategoryStage struct {
+	Weights map[string]float64
+}
+
+func (CategoryStage) Name() string { return StageCategory }
+
+func (s CategoryStage) Score(_ Query, suggestion models.Suggestion, score float64) float64 {
+	if weight, ok := s.Weights[suggestion.Category]; ok {
+		return score * weight
+	}
+	return score
+}
+
+// SelectionStage boosts the suggestions users have picked most often after
+// typing the same query
+type SelectionStage struct {
+	Boost float64 // Boost for the most picked suggestion, defaults to 0.5
+}
+
+func (SelectionStage) Name() string { return StageSelection }
+
+func (s SelectionStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	if query.Selections == nil {
+		return score
+	}
+
+	boost := s.Boost
+	if boost <= 0 {
+		boost = 0.5
+	}
+	return score * (1.0 + boost*query.Selections.Terms[strings.ToLower(suggestion.Term)])
+}
+
+// PersonalizationStage boosts terms and categories the user has recently
+// searched for or picked
+type PersonalizationStage struct {
+	TermBoost     float64 // Boost for the user's strongest term, defaults to 0.5
+	CategoryBoost float64 // Boost for the user's strongest category, defaults to 0.2
+}
+
+func (PersonalizationStage) Name() string { return StagePersonalization }
+
+func (s PersonalizationStage) Score(query Query, suggestion models.Suggestion, score float64) float64 {
+	if query.Profile == nil {
+		return score
+	}
+
+	termBoost, categoryBoost := s.TermBoost, s.CategoryBoost
+	if termBoost <= 0 {
+		termBoost = 0.5
+	}
+	if categoryBoost <= 0 {
+		categoryBoost = 0.2
+	}
+
+	boost := 1.0 + termBoost*query.Profile.Terms[strings.ToLower(suggestion.Term)]
+	if suggestion.Category != "" {
+		boost += categoryBoost * query.Profile.Categories[suggestion.Category]
+	}
+	return score * boost
+}
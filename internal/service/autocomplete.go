@@ -2,14 +2,22 @@ package service
 
 import (
 	"context"
-	"sort"
+	"fmt"
+	"iter"
+	"math"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/alexnthnz/search-autocomplete/internal/cache"
 	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/internal/personalization"
+	"github.com/alexnthnz/search-autocomplete/internal/ranking"
+	"github.com/alexnthnz/search-autocomplete/internal/trending"
 	"github.com/alexnthnz/search-autocomplete/internal/trie"
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 	"github.com/alexnthnz/search-autocomplete/pkg/utils"
@@ -17,31 +25,100 @@ import (
 
 // AutocompleteService provides autocomplete functionality
 type AutocompleteService struct {
-	trie         *trie.Trie
+	active       atomic.Pointer[generation] // Term and token indexes, swapped whole by rebuilds
 	cache        cache.Cache
 	logger       *logrus.Logger
 	fuzzyMatcher *utils.FuzzyMatcher
 	metrics      *metrics.Metrics
+	ranker       ranking.Ranker
+	history      *personalization.History // Nil unless personalization is enabled
+	selections   *personalization.History // Suggestions picked for each query
+	trends       *trending.Tracker
+	config       Config
+
+	// writeMu orders index mutations with their WAL entries and snapshots,
+	// and guards the fields below it
+	writeMu        sync.Mutex
+	wal            *persistence.WAL
+	snapshotLSN    uint64
+	previous       *generation        // Replaced by the last swap, kept for rollback
+	lastGeneration uint64             // Id of the newest generation swapped in
+	announced      cache.Invalidation // Newest generation another instance swapped in
+	rebuilding     bool
+	pending        []persistence.Entry // Mutations made while a rebuild loads
+
+	// scoreEpoch is when stored scores are weighted from, in Unix
+	// nanoseconds. It only moves under writeMu, see DecayScores.
+	scoreEpoch atomic.Int64
+
+	snapshotMu sync.Mutex // Keeps snapshot writes in the order they were taken
+
+	bus        cache.InvalidationBus // Nil unless invalidations are shared with other instances
+	instanceID string
 }
 
 // Config holds service configuration
 type Config struct {
-	MaxSuggestions  int
-	EnableFuzzy     bool
+	MaxSuggestions  int  // Largest limit a request may ask for
+	EnableFuzzy     bool // Default for requests that don't set Fuzzy
 	FuzzyThreshold  int
 	CacheEnabled    bool
 	PersonalizedRec bool
+	IndexType       string        // "trie" (default) or "radix"
+	SnapshotPath    string        // Where rebuilds and rollbacks are snapshotted, empty to not
+	ScoreHalfLife   time.Duration // Age at which a search's contribution to a score halves, 0 to never decay
+	Ranking         ranking.Config
+	Personalization personalization.Config
+	Selections      personalization.Config // Bounds the per-query selection history
+	Trending        trending.Config
 }
 
+const (
+	// DefaultLimit is used when a request doesn't ask for a number of suggestions
+	DefaultLimit = 10
+
+	// DefaultMaxSuggestions caps request limits when Config.MaxSuggestions is unset
+	DefaultMaxSuggestions = 50
+
+	// exportPageSize is how many suggestions an export reads per index lock
+	exportPageSize = 1000
+)
+
 // NewAutocompleteService creates a new autocomplete service
 func NewAutocompleteService(config Config, cache cache.Cache, logger *logrus.Logger, metrics *metrics.Metrics) *AutocompleteService {
+	if _, err := trie.NewIndex(config.IndexType, nil); err != nil {
+		logger.WithError(err).Warn("Falling back to the default trie index")
+		config.IndexType = trie.IndexTypeTrie
+	}
+
+	ranker, err := ranking.New(config.Ranking)
+	if err != nil {
+		logger.WithError(err).Warn("Falling back to the default ranking stages")
+		ranker, _ = ranking.New(ranking.Config{})
+	}
+
+	if config.MaxSuggestions <= 0 {
+		config.MaxSuggestions = DefaultMaxSuggestions
+	}
+	if !config.CacheEnabled {
+		cache = nil
+	}
+
 	service := &AutocompleteService{
-		trie:         trie.NewWithMetrics(metrics),
 		cache:        cache,
 		logger:       logger,
 		fuzzyMatcher: utils.NewFuzzyMatcher(config.FuzzyThreshold),
 		metrics:      metrics,
+		ranker:       ranker,
+		selections:   personalization.NewHistory(config.Selections),
+		trends:       trending.NewTracker(config.Trending),
+		config:       config,
 	}
+	service.scoreEpoch.Store(time.Now().UnixNano())
+	if config.PersonalizedRec {
+		service.history = personalization.NewHistory(config.Personalization)
+	}
+	service.swap(service.newGeneration("startup"))
 
 	return service
 }
@@ -60,23 +137,29 @@ func (s *AutocompleteService) GetSuggestions(ctx context.Context, req models.Aut
 	if query == "" {
 		return &models.AutocompleteResponse{
 			Query:       req.Query,
-			Suggestions: []models.Suggestion{},
+			Suggestions: []models.RankedSuggestion{},
 			Latency:     time.Since(start).String(),
 			Source:      "empty",
 		}, nil
 	}
 
-	// Set default limit
-	if req.Limit <= 0 {
-		req.Limit = 10
-	}
+	req.Limit = s.ClampLimit(req.Limit)
 
 	var suggestions []models.Suggestion
 	var source string
+	var distances map[string]int // Edits needed for each fuzzy match
+
+	// The whole request reads one generation, even if a rebuild swaps in
+	// another meanwhile
+	gen := s.current()
+	filter := newResultFilter(req)
+	bucket := s.limitBucket(req.Limit)
+	cacheKey := gen.entryKey(bucket, filter, query)
+	cacheable := s.cache != nil && gen.trackFilter(filter)
 
 	// Try cache first
-	if s.cache != nil {
-		if cached, found := s.cache.Get(ctx, query); found {
+	if cacheable {
+		if cached, found := s.cache.Get(ctx, cacheKey); found {
 			suggestions = cached
 			source = "cache"
 			s.logger.WithField("query", query).Debug("Cache hit")
@@ -84,51 +167,136 @@ func (s *AutocompleteService) GetSuggestions(ctx context.Context, req models.Aut
 	}
 
 	// If not in cache, search the trie
+	tokensCached := tokensCacheable(query)
 	if len(suggestions) == 0 {
-		suggestions = s.trie.Search(query, req.Limit*2) // Get more for ranking
+		suggestions = s.searchTerms(gen, query, bucket*2, filter) // Get more for ranking
+		if tokensCached {
+			suggestions = mergeSuggestions(suggestions, s.searchTokens(gen, query, bucket*2, filter))
+		}
 		source = "trie"
 		s.logger.WithField("query", query).Debug("Trie search")
 
-		// If no exact matches and fuzzy is enabled, try fuzzy matching
-		if len(suggestions) == 0 && s.fuzzyMatcher != nil {
-			suggestions = s.performFuzzySearch(query, req.Limit*2)
-			if len(suggestions) > 0 {
-				source = "fuzzy"
-				s.metrics.RecordFuzzySearch()
-				s.logger.WithField("query", query).Debug("Fuzzy search")
-			}
+		// Cache the candidates. Fuzzy results aren't cached because they
+		// depend on the request's fuzzy setting.
+		if cacheable && len(suggestions) > 0 {
+			s.cacheAsync(cacheKey, suggestions)
 		}
+	}
+	if !tokensCached {
+		suggestions = mergeSuggestions(suggestions, s.searchTokens(gen, query, bucket*2, filter))
+	}
 
-		// Cache the results
-		if s.cache != nil && len(suggestions) > 0 {
-			go func() {
-				if err := s.cache.Set(context.Background(), query, suggestions); err != nil {
-					s.logger.WithError(err).Error("Failed to cache suggestions")
-					s.metrics.RecordError("service", "cache_set_failed")
-				}
-			}()
+	// If no exact matches and fuzzy is enabled, try fuzzy matching
+	if len(suggestions) == 0 && s.fuzzyEnabled(req) {
+		suggestions, distances = s.performFuzzySearch(gen, query, bucket*2, filter)
+		if len(suggestions) > 0 {
+			source = "fuzzy"
+			s.metrics.RecordFuzzySearch()
+			s.logger.WithField("query", query).Debug("Fuzzy search")
 		}
 	}
 
-	// Apply personalization if enabled
-	if req.UserID != "" || req.SessionID != "" {
-		suggestions = s.personalizeResults(suggestions, req.UserID, req.SessionID)
+	// Rank and limit. Final results aren't cached, since selections, trends,
+	// recency and the user's history move them between requests. The ranker
+	// scores copies, so cached candidates keep their stored scores.
+	rankQuery := ranking.Query{
+		Text:          query,
+		Selections:    s.selections.QueryProfile(query),
+		Trending:      s.trends.Boosts(),
+		EditDistances: distances,
+		Explain:       req.Explain,
+		Now:           time.Now(),
 	}
-
-	// Apply ranking and limit
-	suggestions = s.rankSuggestions(suggestions, query)
-	if len(suggestions) > req.Limit {
-		suggestions = suggestions[:req.Limit]
+	if s.history != nil {
+		rankQuery.Profile = s.history.Profile(req.UserID, req.SessionID)
+	}
+	ranked := s.ranker.Rank(rankQuery, suggestions)
+	if len(ranked) > req.Limit {
+		ranked = ranked[:req.Limit]
 	}
 
 	return &models.AutocompleteResponse{
 		Query:       req.Query,
-		Suggestions: suggestions,
+		Suggestions: ranked,
+		Limit:       req.Limit,
 		Latency:     time.Since(start).String(),
 		Source:      source,
 	}, nil
 }
 
+// cacheAsync caches suggestions without holding up the request
+func (s *AutocompleteService) cacheAsync(key string, suggestions []models.Suggestion) {
+	go func() {
+		if err := s.cache.Set(context.Background(), key, suggestions); err != nil {
+			s.logger.WithError(err).Error("Failed to cache suggestions")
+			s.metrics.RecordError("service", "cache_set_failed")
+		}
+	}()
+}
+
+// RecordSearch adds a query to the user's and session's history. It does
+// nothing unless personalization is enabled.
+func (s *AutocompleteService) RecordSearch(userID, sessionID, query string) {
+	if s.history == nil || (userID == "" && sessionID == "") {
+		return
+	}
+
+	// Queries that name a suggestion also count towards its category
+	suggestion, _ := s.current().index.Get(query)
+	s.history.RecordSearch(userID, sessionID, query, suggestion.Category)
+}
+
+// RecordSelection adds a picked suggestion to the user's and session's
+// history. It does nothing unless personalization is enabled.
+func (s *AutocompleteService) RecordSelection(userID, sessionID, term string) {
+	if s.history == nil || (userID == "" && sessionID == "") {
+		return
+	}
+
+	suggestion, _ := s.current().index.Get(term)
+	s.history.RecordSelection(userID, sessionID, term, suggestion.Category)
+}
+
+// RecordQuerySelection notes that term was picked from the suggestions for
+// query, so that it ranks higher the next time anyone types the same query.
+// Picks further down the list count for more, since the user passed over
+// the suggestions above them.
+func (s *AutocompleteService) RecordQuerySelection(query, term string, position int) {
+	weight := 1.0
+	if position > 1 {
+		weight += math.Log2(float64(position))
+	}
+	s.selections.RecordQuerySelection(query, term, weight)
+}
+
+// Trending returns the tracker that detects trending queries
+func (s *AutocompleteService) Trending() *trending.Tracker {
+	return s.trends
+}
+
+// MaxSuggestions returns the largest limit a request may ask for
+func (s *AutocompleteService) MaxSuggestions() int {
+	return s.config.MaxSuggestions
+}
+
+// ClampLimit applies the default limit and the configured maximum to a
+// requested number of suggestions
+func (s *AutocompleteService) ClampLimit(limit int) int {
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	return min(limit, s.config.MaxSuggestions)
+}
+
+// fuzzyEnabled reports whether fuzzy matching applies to a request. The
+// request's own setting wins over the configured default.
+func (s *AutocompleteService) fuzzyEnabled(req models.AutocompleteRequest) bool {
+	if req.Fuzzy != nil {
+		return *req.Fuzzy
+	}
+	return s.config.EnableFuzzy
+}
+
 // AddSuggestion adds a new suggestion to the system
 func (s *AutocompleteService) AddSuggestion(suggestion models.Suggestion) error {
 	if suggestion.Term == "" {
@@ -143,41 +311,220 @@ func (s *AutocompleteService) AddSuggestion(suggestion models.Suggestion) error
 		suggestion.Score = float64(suggestion.Frequency)
 	}
 
-	s.trie.Insert(suggestion)
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	suggestion.Score *= s.ScoreWeight(time.Time{})
+	if err := s.logMutation(persistence.Entry{Op: persistence.OpInsert, Suggestion: suggestion}); err != nil {
+		return err
+	}
+
+	s.insert(suggestion)
 	s.logger.WithField("term", suggestion.Term).Debug("Added suggestion")
 
 	return nil
 }
 
-// BatchAddSuggestions adds multiple suggestions efficiently
+// BatchAddSuggestions adds multiple suggestions efficiently. It stops at the
+// first suggestion that can't be logged, leaving the ones before it added.
 func (s *AutocompleteService) BatchAddSuggestions(suggestions []models.Suggestion) error {
 	for _, suggestion := range suggestions {
 		if err := s.AddSuggestion(suggestion); err != nil {
 			s.logger.WithError(err).WithField("term", suggestion.Term).Error("Failed to add suggestion")
+			return fmt.Errorf("failed to add suggestion %q: %w", suggestion.Term, err)
 		}
 	}
 	return nil
 }
 
-// UpdateFrequency updates the frequency of a suggestion
-func (s *AutocompleteService) UpdateFrequency(term string, frequency int64) {
-	s.trie.UpdateFrequency(term, frequency)
+// UpsertSuggestions stores suggestions, replacing whatever is stored for the
+// same terms, and returns how many were new and how many replaced existing
+// ones. The batch is applied under a single write lock.
+func (s *AutocompleteService) UpsertSuggestions(suggestions []models.Suggestion) (added, updated int, err error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	now := time.Now()
+	weight := s.ScoreWeight(now)
+	terms := make([]string, 0, len(suggestions))
+	for _, suggestion := range suggestions {
+		if suggestion.Term == "" {
+			continue
+		}
+		if suggestion.UpdatedAt.IsZero() {
+			suggestion.UpdatedAt = now
+		}
+		if suggestion.Score == 0 {
+			suggestion.Score = float64(suggestion.Frequency)
+		}
+		suggestion.Score *= weight
+
+		_, exists := s.current().index.Get(suggestion.Term)
+		if err := s.logMutation(persistence.Entry{Op: persistence.OpInsert, Suggestion: suggestion}); err != nil {
+			return added, updated, err
+		}
+		s.insert(suggestion)
+
+		if exists {
+			updated++
+		} else {
+			added++
+		}
+		terms = append(terms, suggestion.Term)
+	}
+
+	if s.cache != nil && len(terms) > 0 {
+		go s.invalidateCacheForTerms(terms)
+	}
+
+	return added, updated, nil
+}
+
+// RemoveSuggestionsExcept deletes every suggestion for which keep returns
+// false and returns how many were deleted. keep is called with each stored
+// term in its original case; only index keys are lower case.
+func (s *AutocompleteService) RemoveSuggestionsExcept(keep func(term string) bool) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var terms []string
+	s.current().index.Walk(func(suggestion models.Suggestion) bool {
+		if !keep(suggestion.Term) {
+			terms = append(terms, suggestion.Term)
+		}
+		return true
+	})
+
+	removed := 0
+	for _, term := range terms {
+		if err := s.logMutation(persistence.Entry{Op: persistence.OpDelete, Term: term}); err != nil {
+			return removed, err
+		}
+		if s.delete(term) {
+			removed++
+		}
+	}
+
+	if s.cache != nil && len(terms) > 0 {
+		go s.invalidateCacheForTerms(terms)
+	}
+
+	return removed, nil
+}
+
+// GetSuggestion returns the suggestion stored for exactly term
+func (s *AutocompleteService) GetSuggestion(term string) (models.Suggestion, bool) {
+	suggestion, ok := s.current().index.Get(term)
+	return s.presentScore(suggestion), ok
+}
+
+// ExportSuggestions iterates over every suggestion whose term starts with
+// prefix, in term order, keeping only those in category when it is set. The
+// index is read a page at a time and unlocked while the page is consumed, so
+// slow consumers don't hold up writes.
+func (s *AutocompleteService) ExportSuggestions(prefix, category string) iter.Seq[models.Suggestion] {
+	return func(yield func(models.Suggestion) bool) {
+		index := s.current().index
+		page := make([]models.Suggestion, 0, exportPageSize)
+		after, key := "", ""
+		for {
+			// A page ends between index keys, never between case variants
+			// stored under the same key, since the next page starts after it
+			page = page[:0]
+			more := false
+			for suggestion := range index.SuggestionsAfter(prefix, after) {
+				next := strings.ToLower(strings.TrimSpace(suggestion.Term))
+				if len(page) >= exportPageSize && next != key {
+					more = true
+					break
+				}
+				page, key = append(page, suggestion), next
+			}
+
+			for _, suggestion := range page {
+				if category != "" && !strings.EqualFold(suggestion.Category, category) {
+					continue
+				}
+				if !yield(s.presentScore(suggestion)) {
+					return
+				}
+			}
+
+			if !more {
+				return
+			}
+			after = key
+		}
+	}
+}
+
+// SuggestionCount returns the number of suggestions in the index
+func (s *AutocompleteService) SuggestionCount() int {
+	return s.current().index.GetSuggestionsCount()
+}
+
+// UpdateFrequency sets the frequency of a suggestion, and its score to match
+// as of now
+func (s *AutocompleteService) UpdateFrequency(term string, frequency int64) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	score := float64(frequency) * s.ScoreWeight(time.Time{})
+	if err := s.logMutation(persistence.Entry{Op: persistence.OpUpdateFrequency, Term: term, Frequency: frequency, Score: score}); err != nil {
+		return err
+	}
+
+	s.updateFrequency(term, frequency, score)
 
 	// Invalidate cache for all prefixes of this term
 	if s.cache != nil {
 		go s.invalidateCacheForTerm(term)
 	}
+
+	return nil
+}
+
+// AddFrequency adds delta to a suggestion's frequency and score to its
+// stored score, which is weighted as ScoreWeight describes. Unlike UpdateFrequency it never discards counts recorded earlier, so it is
+// safe to call from concurrent flushes. It returns false if the term doesn't
+// exist.
+func (s *AutocompleteService) AddFrequency(term string, delta int64, score float64) (bool, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, ok := s.current().index.Get(term); !ok {
+		return false, nil
+	}
+
+	if err := s.logMutation(persistence.Entry{Op: persistence.OpAddFrequency, Term: term, Frequency: delta, Score: score}); err != nil {
+		return false, err
+	}
+
+	s.addFrequency(term, delta, score)
+
+	if s.cache != nil {
+		go s.invalidateCacheForTerm(term)
+	}
+
+	return true, nil
 }
 
 // DeleteSuggestion removes a suggestion from the system
-func (s *AutocompleteService) DeleteSuggestion(term string) bool {
-	deleted := s.trie.Delete(term)
+func (s *AutocompleteService) DeleteSuggestion(term string) (bool, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if err := s.logMutation(persistence.Entry{Op: persistence.OpDelete, Term: term}); err != nil {
+		return false, err
+	}
+
+	deleted := s.delete(term)
 
 	if deleted && s.cache != nil {
 		go s.invalidateCacheForTerm(term)
 	}
 
-	return deleted
+	return deleted, nil
 }
 
 // GetStats returns service statistics
@@ -185,121 +532,190 @@ func (s *AutocompleteService) GetStats() *metrics.Metrics {
 	return s.metrics
 }
 
-// GetTrieStats returns trie-specific statistics
-func (s *AutocompleteService) GetTrieStats() map[string]interface{} {
-	return map[string]interface{}{
-		"suggestions_count": s.trie.GetSuggestionsCount(),
+// searchTerms returns the best terms starting with the query
+func (s *AutocompleteService) searchTerms(gen *generation, query string, limit int, filter resultFilter) []models.Suggestion {
+	if filter.empty() {
+		return s.presentScores(gen.index.Search(query, limit))
 	}
+
+	// The best matches overall may all fail the filter, so the index walks
+	// its matches best first until enough pass
+	return s.presentScores(gen.index.SearchFunc(query, limit, filter.match))
 }
 
-// performFuzzySearch performs fuzzy matching for queries with no exact matches
-func (s *AutocompleteService) performFuzzySearch(query string, limit int) []models.Suggestion {
-	// This is a simplified fuzzy search - in production, you'd want more sophisticated algorithms
-	var fuzzyResults []models.Suggestion
+// searchTokens returns the best terms with inner words matching the query.
+// Filtered requests keep those of the best the token index holds that pass.
+func (s *AutocompleteService) searchTokens(gen *generation, query string, limit int, filter resultFilter) []models.Suggestion {
+	return s.presentScores(filter.apply(gen.tokens.Search(query, limit)))
+}
 
-	// Try removing last character (typo correction)
-	if len(query) > 1 {
-		shortened := query[:len(query)-1]
-		results := s.trie.Search(shortened, limit)
-		if len(results) > 0 {
-			s.metrics.RecordFuzzyMatch()
+// mergeSuggestions appends the suggestions in more that aren't already in
+// suggestions. Ranking decides their final order. suggestions may be cached,
+// so it is never appended to in place.
+func mergeSuggestions(suggestions, more []models.Suggestion) []models.Suggestion {
+	seen := make(map[string]struct{}, len(suggestions))
+	for _, suggestion := range suggestions {
+		seen[suggestion.Term] = struct{}{}
+	}
+	suggestions = suggestions[:len(suggestions):len(suggestions)]
+	for _, suggestion := range more {
+		if _, ok := seen[suggestion.Term]; !ok {
+			suggestions = append(suggestions, suggestion)
 		}
-		fuzzyResults = append(fuzzyResults, results...)
 	}
+	return suggestions
+}
 
-	// Try common substitutions
-	commonSubs := map[string]string{
-		"ph": "f", "f": "ph", "c": "k", "k": "c",
-		"z": "s", "s": "z", "i": "y", "y": "i",
-	}
+// tokensCacheable reports whether a query's inner-word matches are cached
+// along with its whole-term matches. A query of a single word matches the
+// terms with a word starting with it, so invalidating every prefix of every
+// word of a changed term reaches it. A query of several words can match
+// any combination of word prefixes, too many to invalidate, so its
+// inner-word matches are searched on every request instead.
+func tokensCacheable(query string) bool {
+	tokens := trie.Tokenize(query)
+	return len(tokens) == 1 && tokens[0] == query
+}
 
-	for old, new := range commonSubs {
-		if strings.Contains(query, old) {
-			modified := strings.ReplaceAll(query, old, new)
-			results := s.trie.Search(modified, limit/2)
-			if len(results) > 0 {
-				s.metrics.RecordFuzzyMatch()
-			}
-			fuzzyResults = append(fuzzyResults, results...)
-		}
+// targets returns the generations mutations are applied to: the one kept
+// for rollback, so that rolling back loses nothing, and the live one last.
+// Callers must hold writeMu.
+func (s *AutocompleteService) targets() []*generation {
+	if s.previous == nil {
+		return []*generation{s.current()}
 	}
+	return []*generation{s.previous, s.current()}
+}
 
-	// Reduce scores for fuzzy matches
-	for i := range fuzzyResults {
-		fuzzyResults[i].Score *= 0.8 // Penalty for fuzzy matches
+// insert adds a suggestion to the term and token indexes
+func (s *AutocompleteService) insert(suggestion models.Suggestion) {
+	for _, g := range s.targets() {
+		g.insert(suggestion)
 	}
+}
 
-	return fuzzyResults
+// updateFrequency sets a term's frequency and score in the term and token
+// indexes
+func (s *AutocompleteService) updateFrequency(term string, frequency int64, score float64) {
+	for _, g := range s.targets() {
+		g.updateFrequency(term, frequency, score)
+	}
 }
 
-// personalizeResults applies personalization to suggestion results
-func (s *AutocompleteService) personalizeResults(suggestions []models.Suggestion, userID, sessionID string) []models.Suggestion {
-	// This is a simplified personalization - in production, you'd use ML models
-	// or user behavior analysis
+// addFrequency adds to a term's frequency and score in the term and token
+// indexes
+func (s *AutocompleteService) addFrequency(term string, delta int64, score float64) {
+	for _, g := range s.targets() {
+		g.addFrequency(term, delta, score)
+	}
+}
 
-	if userID == "" && sessionID == "" {
-		return suggestions
+// delete removes a term from the term and token indexes
+func (s *AutocompleteService) delete(term string) bool {
+	deleted := false
+	for _, g := range s.targets() {
+		deleted = g.delete(term)
 	}
+	return deleted
+}
 
-	// Boost suggestions based on user context (placeholder implementation)
-	for i := range suggestions {
-		// Boost tech-related terms for tech users (example logic)
-		if strings.Contains(suggestions[i].Category, "tech") {
-			suggestions[i].Score *= 1.2
-		}
+// decay scales every score in the indexes
+func (s *AutocompleteService) decay(factor float64) {
+	for _, g := range s.targets() {
+		g.decay(factor)
 	}
+}
 
-	return suggestions
+// GetTrieStats returns trie-specific statistics
+func (s *AutocompleteService) GetTrieStats() map[string]interface{} {
+	gen := s.current()
+	return map[string]interface{}{
+		"suggestions_count": gen.index.GetSuggestionsCount(),
+		"generation":        gen.id,
+	}
 }
 
-// rankSuggestions applies advanced ranking to suggestions
-func (s *AutocompleteService) rankSuggestions(suggestions []models.Suggestion, query string) []models.Suggestion {
-	if len(suggestions) == 0 {
-		return suggestions
+// performFuzzySearch finds terms within the fuzzy matcher's edit budget of
+// the query when there are no exact matches. It also returns how many edits
+// each match needed, which the ranker penalizes.
+func (s *AutocompleteService) performFuzzySearch(gen *generation, query string, limit int, filter resultFilter) ([]models.Suggestion, map[string]int) {
+	maxEdits := s.fuzzyMatcher.MaxEdits(query)
+	if maxEdits == 0 {
+		return nil, nil
 	}
 
-	// Calculate relevance scores
-	for i := range suggestions {
-		score := suggestions[i].Score
+	matches := gen.index.FuzzySearch(query, maxEdits, limit)
 
-		// Boost exact prefix matches
-		if strings.HasPrefix(strings.ToLower(suggestions[i].Term), query) {
-			score *= 2.0
+	var fuzzyResults []models.Suggestion
+	distances := make(map[string]int, len(matches))
+	for _, match := range matches {
+		if !filter.match(match.Suggestion) {
+			continue
 		}
+		fuzzyResults = append(fuzzyResults, s.presentScore(match.Suggestion))
+		distances[match.Suggestion.Term] = match.Distance
+	}
+	if len(fuzzyResults) > 0 {
+		s.metrics.RecordFuzzyMatch()
+	}
 
-		// Boost shorter terms (more likely to be what user wants)
-		lengthBoost := 1.0 / (1.0 + float64(len(suggestions[i].Term))/10.0)
-		score *= lengthBoost
+	return fuzzyResults, distances
+}
 
-		// Boost recent updates
-		daysSinceUpdate := time.Since(suggestions[i].UpdatedAt).Hours() / 24
-		if daysSinceUpdate < 7 {
-			score *= 1.1
-		}
+// invalidateCacheForTerm invalidates cache entries for every query that may
+// match a term, here and on every other instance
+func (s *AutocompleteService) invalidateCacheForTerm(term string) {
+	s.invalidateCacheForTerms([]string{term})
+}
 
-		suggestions[i].Score = score
-	}
+// invalidateCacheForTerms invalidates cache entries for every query that may
+// match several terms, here and on every other instance
+func (s *AutocompleteService) invalidateCacheForTerms(terms []string) {
+	prefixes := termPrefixes(terms)
+	s.invalidatePrefixes(prefixes)
+	s.broadcast(cache.Invalidation{Prefixes: prefixes})
+}
 
-	// Sort by final score
-	sort.Slice(suggestions, func(i, j int) bool {
-		return suggestions[i].Score > suggestions[j].Score
-	})
+// invalidatePrefixes drops the live generation's cached results for
+// queries, for every limit bucket and filter
+func (s *AutocompleteService) invalidatePrefixes(prefixes []string) {
+	ctx := context.Background()
+	gen := s.current()
 
-	return suggestions
+	for _, prefix := range prefixes {
+		for _, key := range s.prefixKeys(gen, prefix) {
+			if err := s.cache.Delete(ctx, key); err != nil {
+				s.logger.WithError(err).WithField("prefix", prefix).Error("Failed to invalidate cache")
+			}
+		}
+	}
 }
 
-// invalidateCacheForTerm invalidates cache entries for all prefixes of a term
-func (s *AutocompleteService) invalidateCacheForTerm(term string) {
-	ctx := context.Background()
-	term = strings.ToLower(term)
+// termPrefixes returns the cached queries that may match the terms: every
+// prefix of each lowercased term, which the term index matches, and every
+// prefix of each of its words, which the token index matches. Prefixes are
+// cut on rune boundaries.
+func termPrefixes(terms []string) []string {
+	seen := make(map[string]bool)
+	var prefixes []string
+	add := func(s string) {
+		runes := []rune(s)
+		for i := 1; i <= len(runes); i++ {
+			prefix := string(runes[:i])
+			if !seen[prefix] {
+				seen[prefix] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
 
-	// Invalidate all prefixes
-	for i := 1; i <= len(term); i++ {
-		prefix := term[:i]
-		if err := s.cache.Delete(ctx, prefix); err != nil {
-			s.logger.WithError(err).WithField("prefix", prefix).Error("Failed to invalidate cache")
+	for _, term := range terms {
+		add(strings.ToLower(term))
+		for _, token := range trie.Tokenize(term) {
+			add(token)
 		}
 	}
+	return prefixes
 }
 
 // LoadSampleData loads sample suggestions for testing
@@ -317,6 +733,9 @@ func (s *AutocompleteService) LoadSampleData() {
 		{Term: "coding", Frequency: 600, Score: 600, Category: "tech", UpdatedAt: time.Now()},
 	}
 
-	s.BatchAddSuggestions(sampleSuggestions)
+	if err := s.BatchAddSuggestions(sampleSuggestions); err != nil {
+		s.logger.WithError(err).Error("Failed to load sample data")
+		return
+	}
 	s.logger.Info("Loaded sample data for autocomplete")
 }
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// maxCachedFilters bounds the category and locale combinations cached per
+// index generation. Invalidating a prefix deletes its entries for each one,
+// so results for further combinations aren't cached.
+const maxCachedFilters = 32
+
+// resultFilter narrows results to a category and locale
+type resultFilter struct {
+	category string
+	locale   string
+}
+
+// newResultFilter normalizes a request's filters
+func newResultFilter(req models.AutocompleteRequest) resultFilter {
+	return resultFilter{
+		category: strings.ToLower(strings.TrimSpace(req.Category)),
+		locale:   normalizeLocale(req.Locale),
+	}
+}
+
+// normalizeLocale lowercases a locale and uses hyphens as separators, so that
+// "en_US" and "en-us" are the same
+func normalizeLocale(locale string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(locale)), "_", "-")
+}
+
+func (f resultFilter) empty() bool {
+	return f.category == "" && f.locale == ""
+}
+
+// match reports whether a suggestion passes the filter. Suggestions without
+// a "locale" metadata value suit every locale, and a language-only locale
+// such as "en" suits every region of it.
+func (f resultFilter) match(suggestion models.Suggestion) bool {
+	if f.category != "" && !strings.EqualFold(suggestion.Category, f.category) {
+		return false
+	}
+	if f.locale == "" {
+		return true
+	}
+
+	locale := normalizeLocale(suggestion.Metadata["locale"])
+	if locale == "" || locale == f.locale {
+		return true
+	}
+	language, _, _ := strings.Cut(f.locale, "-")
+	return locale == language
+}
+
+// key identifies the filter within a cache key
+func (f resultFilter) key() string {
+	if f.empty() {
+		return "-"
+	}
+	return url.QueryEscape(f.category) + "," + url.QueryEscape(f.locale)
+}
+
+// apply keeps the suggestions that pass the filter
+func (f resultFilter) apply(suggestions []models.Suggestion) []models.Suggestion {
+	if f.empty() {
+		return suggestions
+	}
+
+	filtered := suggestions[:0:0]
+	for _, suggestion := range suggestions {
+		if f.match(suggestion) {
+			filtered = append(filtered, suggestion)
+		}
+	}
+	return filtered
+}
+
+// limitBuckets returns the result counts cached for a query. A request is
+// served from the smallest bucket covering its limit, so entries cached for
+// a small limit never leave a larger one short.
+func (s *AutocompleteService) limitBuckets() []int {
+	if s.config.MaxSuggestions <= DefaultLimit {
+		return []int{s.config.MaxSuggestions}
+	}
+	return []int{DefaultLimit, s.config.MaxSuggestions}
+}
+
+// limitBucket returns the smallest bucket covering a clamped limit
+func (s *AutocompleteService) limitBucket(limit int) int {
+	buckets := s.limitBuckets()
+	for _, bucket := range buckets {
+		if limit <= bucket {
+			return bucket
+		}
+	}
+	return buckets[len(buckets)-1]
+}
+
+// entryKey is the cache key of the ranking candidates for a query, limit
+// bucket and filter in a generation, e.g. "3:10:-:app" or
+// "3:50:tech,en-us:app". Candidates are the index matches before ranking;
+// they don't depend on who asked, so every request ranks them afresh.
+func (g *generation) entryKey(bucket int, filter resultFilter, query string) string {
+	return g.cacheKey(strconv.Itoa(bucket) + ":" + filter.key() + ":" + query)
+}
+
+// trackFilter records that results for a filter may be cached in the
+// generation, so that invalidation finds them. It reports false once too
+// many filters are tracked.
+func (g *generation) trackFilter(filter resultFilter) bool {
+	if filter.empty() {
+		return true
+	}
+
+	g.filtersMu.Lock()
+	defer g.filtersMu.Unlock()
+
+	key := filter.key()
+	if _, ok := g.filters[key]; ok {
+		return true
+	}
+	if len(g.filters) >= maxCachedFilters {
+		return false
+	}
+	g.filters[key] = filter
+	return true
+}
+
+// prefixKeys returns every key a query's results may be cached under in the
+// generation
+func (s *AutocompleteService) prefixKeys(gen *generation, query string) []string {
+	filters := []resultFilter{{}}
+	gen.filtersMu.Lock()
+	for _, filter := range gen.filters {
+		filters = append(filters, filter)
+	}
+	gen.filtersMu.Unlock()
+
+	var keys []string
+	for _, filter := range filters {
+		for _, bucket := range s.limitBuckets() {
+			keys = append(keys, gen.entryKey(bucket, filter, query))
+		}
+	}
+	return keys
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// maxScoreExponent is how many half-lives the score epoch may fall behind
+// before DecayScores rescales the index. Weights then reach 2^256, far from
+// overflowing a float64 even when multiplied by large counts.
+const maxScoreExponent = 256
+
+// Scores are stored weighted from a fixed epoch instead of decayed in place:
+// a search made at t adds ScoreWeight(t) = 2^((t-epoch)/halfLife), so newer
+// searches add exponentially more and the stored scores rank the same as if
+// every score had been decayed to the present. Scores are divided by the
+// weight of the present before they leave the service, so callers only ever
+// see present-day scores.
+
+// ScoreWeight returns how much a search made at the given time adds to a
+// stored score. A zero time means now, and so does a future one, so that
+// clock skew can't inflate a score. Without ScoreHalfLife every search
+// counts in full.
+func (s *AutocompleteService) ScoreWeight(at time.Time) float64 {
+	halfLife := s.config.ScoreHalfLife
+	if halfLife <= 0 {
+		return 1
+	}
+	if now := time.Now(); at.IsZero() || at.After(now) {
+		at = now
+	}
+	return math.Exp2(float64(at.UnixNano()-s.scoreEpoch.Load()) / float64(halfLife))
+}
+
+// DecayScores moves the score epoch up to now when stored scores are about
+// to grow too large, scaling every score down to match. Scores rank and
+// read the same before and after, so it only needs to run rarely; it does
+// nothing until the epoch is maxScoreExponent half-lives old, and nothing
+// at all unless ScoreHalfLife is set.
+func (s *AutocompleteService) DecayScores(now time.Time) error {
+	halfLife := s.config.ScoreHalfLife
+	if halfLife <= 0 {
+		return nil
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	exponent := float64(now.UnixNano()-s.scoreEpoch.Load()) / float64(halfLife)
+	if exponent < maxScoreExponent {
+		return nil
+	}
+	factor := math.Exp2(-exponent)
+
+	if err := s.logMutation(persistence.Entry{Op: persistence.OpDecay, Factor: factor, Time: now}); err != nil {
+		return err
+	}
+
+	s.decay(factor)
+	s.scoreEpoch.Store(now.UnixNano())
+
+	s.logger.WithFields(logrus.Fields{
+		"factor": factor,
+		"epoch":  now,
+	}).Info("Rescaled scores to a new epoch")
+
+	return nil
+}
+
+// presentScores converts stored scores to present-day ones. It scales
+// suggestions in place, so it must only be given slices the index handed
+// out.
+func (s *AutocompleteService) presentScores(suggestions []models.Suggestion) []models.Suggestion {
+	if s.config.ScoreHalfLife <= 0 {
+		return suggestions
+	}
+
+	scale := 1 / s.ScoreWeight(time.Time{})
+	for i := range suggestions {
+		suggestions[i].Score *= scale
+	}
+	return suggestions
+}
+
+// presentScore converts a single stored score to a present-day one
+func (s *AutocompleteService) presentScore(suggestion models.Suggestion) models.Suggestion {
+	if s.config.ScoreHalfLife > 0 {
+		suggestion.Score /= s.ScoreWeight(time.Time{})
+	}
+	return suggestion
+}
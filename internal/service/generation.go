@@ -0,0 +1,436 @@
+package service
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/cache"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/internal/trie"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+var (
+	// ErrRebuildInProgress is returned when a rebuild is started while
+	// another is still loading
+	ErrRebuildInProgress = errors.New("an index rebuild is already in progress")
+	// ErrNoPreviousIndex is returned by Rollback when there is nothing to
+	// roll back to
+	ErrNoPreviousIndex = errors.New("no previous index to roll back to")
+)
+
+// generation is one complete build of the term and token indexes. Searches
+// use whichever generation is active when they start; a rebuild loads a new
+// one on the side and swaps it in whole.
+type generation struct {
+	id       uint64 // Assigned when the generation goes live, see swap
+	contents uint64 // Hash of the suggestions when it went live
+	index    trie.Index
+	tokens   *trie.TokenIndex
+	source   string
+	builtAt  time.Time
+
+	filtersMu sync.Mutex
+	filters   map[string]resultFilter // Filters results may be cached for, by key
+}
+
+// newGeneration creates an empty generation
+func (s *AutocompleteService) newGeneration(source string) *generation {
+	index, err := trie.NewIndex(s.config.IndexType, s.metrics)
+	if err != nil {
+		index = trie.NewWithMetrics(s.metrics)
+	}
+
+	return &generation{
+		index:   index,
+		tokens:  trie.NewTokenIndex(),
+		source:  source,
+		builtAt: time.Now(),
+		filters: make(map[string]resultFilter),
+	}
+}
+
+// cacheKey scopes a cached query to the generation, so that swapping
+// generations invalidates every cached result at once
+func (g *generation) cacheKey(query string) string {
+	return strconv.FormatUint(g.id, 10) + ":" + query
+}
+
+func (g *generation) insert(suggestion models.Suggestion) {
+	g.index.Insert(suggestion)
+	g.tokens.Insert(suggestion)
+}
+
+func (g *generation) updateFrequency(term string, frequency int64, score float64) {
+	g.index.UpdateFrequency(term, frequency, score)
+	g.tokens.UpdateFrequency(term, frequency, score)
+}
+
+func (g *generation) addFrequency(term string, delta int64, score float64) {
+	g.index.AddFrequency(term, delta, score)
+	g.tokens.AddFrequency(term, delta, score)
+}
+
+func (g *generation) delete(term string) bool {
+	g.tokens.Delete(term)
+	return g.index.Delete(term)
+}
+
+func (g *generation) decay(factor float64) {
+	g.index.Decay(factor)
+	g.tokens.Decay(factor)
+}
+
+// apply applies a logged mutation
+func (g *generation) apply(entry persistence.Entry) error {
+	switch entry.Op {
+	case persistence.OpInsert:
+		g.insert(entry.Suggestion)
+	case persistence.OpUpdateFrequency:
+		g.updateFrequency(entry.Term, entry.Frequency, entry.Score)
+	case persistence.OpAddFrequency:
+		g.addFrequency(entry.Term, entry.Frequency, entry.Score)
+	case persistence.OpDelete:
+		g.delete(entry.Term)
+	case persistence.OpDecay:
+		g.decay(entry.Factor)
+	default:
+		return fmt.Errorf("unknown WAL op %d at LSN %d", entry.Op, entry.LSN)
+	}
+	return nil
+}
+
+// info describes the generation
+func (g *generation) info() GenerationInfo {
+	return GenerationInfo{
+		Generation:  g.id,
+		Source:      g.source,
+		BuiltAt:     g.builtAt,
+		Suggestions: g.index.GetSuggestionsCount(),
+	}
+}
+
+// GenerationInfo describes a build of the index
+type GenerationInfo struct {
+	Generation  uint64    `json:"generation"`
+	Source      string    `json:"source"`
+	BuiltAt     time.Time `json:"built_at"`
+	Suggestions int       `json:"suggestions"`
+}
+
+// IndexStatus describes the live index and the one kept for rollback
+type IndexStatus struct {
+	Active     GenerationInfo  `json:"active"`
+	Previous   *GenerationInfo `json:"previous,omitempty"`
+	Rebuilding bool            `json:"rebuilding"`
+}
+
+// IndexBuilder loads suggestions into an index being rebuilt. It is not
+// live, so loading never blocks or shows through to searches. It satisfies
+// importer.Target, so an import file can be loaded into it directly.
+type IndexBuilder struct {
+	gen    *generation
+	weight float64 // Score weight of the time the rebuild started
+}
+
+// Add stores a suggestion, replacing any stored for the same term
+func (b *IndexBuilder) Add(suggestion models.Suggestion) {
+	if suggestion.Term == "" {
+		return
+	}
+	if suggestion.UpdatedAt.IsZero() {
+		suggestion.UpdatedAt = time.Now()
+	}
+	if suggestion.Score == 0 {
+		suggestion.Score = float64(suggestion.Frequency)
+	}
+	suggestion.Score *= b.weight
+	b.gen.insert(suggestion)
+}
+
+// UpsertSuggestions stores a batch of suggestions
+func (b *IndexBuilder) UpsertSuggestions(suggestions []models.Suggestion) (added, updated int, err error) {
+	for _, suggestion := range suggestions {
+		if _, exists := b.gen.index.Get(suggestion.Term); exists {
+			updated++
+		} else {
+			added++
+		}
+		b.Add(suggestion)
+	}
+	return added, updated, nil
+}
+
+// RemoveSuggestionsExcept deletes every suggestion for which keep returns false
+func (b *IndexBuilder) RemoveSuggestionsExcept(keep func(term string) bool) (int, error) {
+	var terms []string
+	b.gen.index.Walk(func(suggestion models.Suggestion) bool {
+		if !keep(suggestion.Term) {
+			terms = append(terms, suggestion.Term)
+		}
+		return true
+	})
+
+	for _, term := range terms {
+		b.gen.delete(term)
+	}
+	return len(terms), nil
+}
+
+// GetSuggestion returns the suggestion loaded for exactly term
+func (b *IndexBuilder) GetSuggestion(term string) (models.Suggestion, bool) {
+	suggestion, ok := b.gen.index.Get(term)
+	suggestion.Score /= b.weight
+	return suggestion, ok
+}
+
+// SuggestionCount returns the number of suggestions loaded so far
+func (b *IndexBuilder) SuggestionCount() int {
+	return b.gen.index.GetSuggestionsCount()
+}
+
+// current returns the live generation
+func (s *AutocompleteService) current() *generation {
+	return s.active.Load()
+}
+
+// IndexStatus describes the live index and the one kept for rollback
+func (s *AutocompleteService) IndexStatus() IndexStatus {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	status := IndexStatus{Active: s.current().info(), Rebuilding: s.rebuilding}
+	if s.previous != nil {
+		previous := s.previous.info()
+		status.Previous = &previous
+	}
+	return status
+}
+
+// Rebuild loads a new index with load and swaps it in for the live one in a
+// single step. Searches keep using the live index while load runs, and
+// mutations made meanwhile are applied to the new index before the swap, so
+// none are lost. The swap moves cached results to a new generation and keeps
+// the replaced index for Rollback. If SnapshotPath is set, the new index is
+// snapshotted before Rebuild returns, so a restart comes back to it.
+func (s *AutocompleteService) Rebuild(source string, load func(*IndexBuilder) error) (IndexStatus, error) {
+	s.writeMu.Lock()
+	if s.rebuilding {
+		s.writeMu.Unlock()
+		return IndexStatus{}, ErrRebuildInProgress
+	}
+	s.rebuilding = true
+	s.pending = nil
+	builder := &IndexBuilder{gen: s.newGeneration(source), weight: s.ScoreWeight(time.Now())}
+	s.writeMu.Unlock()
+
+	start := time.Now()
+	next := builder.gen
+	err := load(builder)
+
+	s.writeMu.Lock()
+	pending := s.pending
+	s.rebuilding = false
+	s.pending = nil
+	if err != nil {
+		s.writeMu.Unlock()
+		s.metrics.RecordError("service", "rebuild_failed")
+		return IndexStatus{}, err
+	}
+
+	for _, entry := range pending {
+		if err := next.apply(entry); err != nil {
+			s.writeMu.Unlock()
+			return IndexStatus{}, err
+		}
+	}
+	next.builtAt = time.Now()
+	s.swap(next)
+	s.writeMu.Unlock()
+
+	s.broadcast(cache.Invalidation{Generation: next.id, Contents: next.contents})
+
+	s.logger.WithFields(logrus.Fields{
+		"generation":  next.id,
+		"source":      source,
+		"suggestions": next.index.GetSuggestionsCount(),
+		"caught_up":   len(pending),
+		"duration":    time.Since(start).String(),
+	}).Info("Swapped in rebuilt index")
+
+	return s.IndexStatus(), s.snapshotSwap()
+}
+
+// Rollback swaps the index replaced by the last rebuild or rollback back in.
+// It has received every mutation since, so nothing is lost either way.
+func (s *AutocompleteService) Rollback() (IndexStatus, error) {
+	s.writeMu.Lock()
+	if s.previous == nil {
+		s.writeMu.Unlock()
+		return IndexStatus{}, ErrNoPreviousIndex
+	}
+	s.swap(s.previous)
+	active := s.current()
+	s.writeMu.Unlock()
+
+	s.broadcast(cache.Invalidation{Generation: active.id, Contents: active.contents})
+
+	s.logger.WithFields(logrus.Fields{
+		"generation":  active.id,
+		"source":      active.source,
+		"suggestions": active.index.GetSuggestionsCount(),
+	}).Info("Rolled back to previous index")
+
+	return s.IndexStatus(), s.snapshotSwap()
+}
+
+// swap makes next the live generation under a new id and keeps the one it
+// replaces for rollback. Cached results keyed by the old id are never read
+// again. If another instance last swapped in the same suggestions, next
+// takes its id, so replicas applying the same rebuild share cached results.
+// Otherwise the id is taken from the clock rather than counted from 1, so
+// neither a restart nor another instance reuses one for a different index.
+// Callers must hold writeMu.
+func (s *AutocompleteService) swap(next *generation) {
+	next.contents = next.hashContents()
+	if s.announced.Generation > s.lastGeneration && s.announced.Contents == next.contents {
+		s.lastGeneration = s.announced.Generation
+	} else {
+		s.lastGeneration = max(s.lastGeneration+1, uint64(time.Now().UnixNano()))
+	}
+	next.id = s.lastGeneration
+
+	s.previous = s.active.Swap(next)
+	s.metrics.UpdateTrieSize(next.index.GetSuggestionsCount())
+}
+
+// hashContents hashes the terms, frequencies, categories and metadata of
+// every suggestion. Scores and update times are left out, since they differ
+// with when each replica loaded and decayed the same suggestions.
+func (g *generation) hashContents() uint64 {
+	var sum uint64
+	g.index.Walk(func(suggestion models.Suggestion) bool {
+		h := fnv.New64a()
+		h.Write([]byte(suggestion.Term))
+		h.Write([]byte{0})
+		h.Write(binary.BigEndian.AppendUint64(nil, uint64(suggestion.Frequency)))
+		h.Write([]byte(suggestion.Category))
+		keys := slices.Sorted(maps.Keys(suggestion.Metadata))
+		for _, key := range keys {
+			h.Write([]byte{0})
+			h.Write([]byte(key))
+			h.Write([]byte{0})
+			h.Write([]byte(suggestion.Metadata[key]))
+		}
+
+		// Summed, so the order of the walk doesn't matter
+		sum += h.Sum64()
+		return true
+	})
+	return sum
+}
+
+// announce records a generation another instance swapped in, so that a
+// swap to the same suggestions here reuses its id
+func (s *AutocompleteService) announce(invalidation cache.Invalidation) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if invalidation.Generation > s.announced.Generation {
+		s.announced = invalidation
+	}
+}
+
+// snapshotSwap snapshots the index after a swap, if SnapshotPath is set
+func (s *AutocompleteService) snapshotSwap() error {
+	if s.config.SnapshotPath == "" {
+		return nil
+	}
+	if err := s.SaveSnapshot(s.config.SnapshotPath); err != nil {
+		s.logger.WithError(err).Error("Failed to snapshot swapped index")
+		return fmt.Errorf("index swapped but not snapshotted: %w", err)
+	}
+	return nil
+}
+
+// SnapshotPath returns where the index is snapshotted, or "" if it isn't
+func (s *AutocompleteService) SnapshotPath() string {
+	return s.config.SnapshotPath
+}
+
+// LoadSnapshotInto loads the snapshot at path into a rebuilt index, then
+// the WAL entries logged after it up to the start of the load. The rebuild
+// catches up on the mutations made since before the swap. The snapshot file
+// is only read; it is replaced once the rebuilt index is live.
+func (s *AutocompleteService) LoadSnapshotInto(b *IndexBuilder, path string) error {
+	// No snapshot may compact the WAL entries being replayed
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	snapshot, err := persistence.ReadSnapshot(path)
+	if err != nil {
+		return err
+	}
+
+	// Mutations logged from here on are caught up on from pending instead
+	s.writeMu.Lock()
+	wal := s.wal
+	epoch := s.scoreEpoch.Load()
+	var upTo uint64
+	if wal != nil {
+		upTo = wal.LastLSN()
+	}
+	if s.rebuilding {
+		s.pending = nil
+	}
+	s.writeMu.Unlock()
+
+	for _, suggestion := range snapshot.Suggestions {
+		b.gen.insert(suggestion)
+	}
+
+	// The snapshot's scores are weighted from its own epoch, and each logged
+	// rescale moves it on
+	loadedEpoch := epoch
+	if !snapshot.ScoreEpoch.IsZero() {
+		loadedEpoch = snapshot.ScoreEpoch.UnixNano()
+	}
+	if wal != nil && upTo > snapshot.LSN {
+		next := snapshot.LSN + 1
+		err = wal.Replay(snapshot.LSN, func(entry persistence.Entry) error {
+			if entry.LSN > upTo {
+				return nil
+			}
+			if entry.LSN != next {
+				return fmt.Errorf("write-ahead log skips from LSN %d to %d after the snapshot", next-1, entry.LSN)
+			}
+			next++
+			if entry.Op == persistence.OpDecay {
+				loadedEpoch = entry.Time.UnixNano()
+			}
+			return b.gen.apply(entry)
+		})
+		if err != nil {
+			return err
+		}
+		if next <= upTo {
+			return fmt.Errorf("write-ahead log ends at LSN %d, before LSN %d", next-1, upTo)
+		}
+	}
+
+	// Later rescales reach the rebuilt index through pending
+	if halfLife := s.config.ScoreHalfLife; halfLife > 0 && loadedEpoch != epoch {
+		b.gen.decay(math.Exp2(float64(loadedEpoch-epoch) / float64(halfLife)))
+	}
+	return nil
+}
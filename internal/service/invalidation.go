@@ -0,0 +1,63 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/cache"
+)
+
+// AttachInvalidationBus broadcasts this instance's cache invalidations on bus
+// and applies every other instance's to this instance's cache. It must be
+// called before the service is used.
+func (s *AutocompleteService) AttachInvalidationBus(bus cache.InvalidationBus) {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	s.bus = bus
+	s.instanceID = hex.EncodeToString(id)
+	bus.Subscribe(s.handleInvalidation)
+
+	s.logger.WithField("instance", s.instanceID).Info("Attached cache invalidation bus")
+}
+
+// handleInvalidation drops the cached results another instance invalidated.
+// A swapped in index generation changes results for any query, so every
+// entry that can be dropped at once is, and its id is kept for a swap here
+// to the same suggestions.
+func (s *AutocompleteService) handleInvalidation(invalidation cache.Invalidation) {
+	if invalidation.Origin == s.instanceID || s.cache == nil {
+		return
+	}
+
+	if invalidation.Generation > 0 {
+		s.announce(invalidation)
+		if purger, ok := s.cache.(cache.Purger); ok {
+			if err := purger.Purge(context.Background()); err != nil {
+				s.logger.WithError(err).Error("Failed to purge cache")
+			}
+		}
+		s.logger.WithFields(logrus.Fields{
+			"origin":     invalidation.Origin,
+			"generation": invalidation.Generation,
+		}).Info("Purged cache after another instance swapped its index")
+	}
+
+	s.invalidatePrefixes(invalidation.Prefixes)
+}
+
+// broadcast publishes an invalidation to the other instances, if a bus is
+// attached
+func (s *AutocompleteService) broadcast(invalidation cache.Invalidation) {
+	if s.bus == nil {
+		return
+	}
+
+	invalidation.Origin = s.instanceID
+	if err := s.bus.Publish(context.Background(), invalidation); err != nil {
+		s.logger.WithError(err).Warn("Failed to broadcast cache invalidation")
+	}
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// SaveSnapshot writes every suggestion in the live index to a snapshot file.
+// When a WAL is attached it is rotated at the same point, and the segments the
+// snapshot covers are removed once it is safely on disk.
+func (s *AutocompleteService) SaveSnapshot(path string) error {
+	// A snapshot taken later must not be overwritten by an earlier one whose
+	// write was slower, since the WAL is compacted up to the later one
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+
+	s.writeMu.Lock()
+	gen := s.current()
+	var suggestions []models.Suggestion
+	gen.index.Walk(func(suggestion models.Suggestion) bool {
+		suggestions = append(suggestions, suggestion)
+		return true
+	})
+
+	epoch := time.Unix(0, s.scoreEpoch.Load())
+	var lsn uint64
+	if s.wal != nil {
+		var err error
+		if lsn, err = s.wal.Rotate(); err != nil {
+			s.writeMu.Unlock()
+			return err
+		}
+	}
+	s.writeMu.Unlock()
+
+	if err := persistence.WriteSnapshot(path, lsn, gen.id, epoch, suggestions); err != nil {
+		return err
+	}
+
+	if s.wal != nil {
+		return s.wal.Compact(lsn)
+	}
+	return nil
+}
+
+// LoadSnapshot restores suggestions from a snapshot file and returns how many
+// were loaded
+func (s *AutocompleteService) LoadSnapshot(path string) (int, error) {
+	snapshot, err := persistence.ReadSnapshot(path)
+	if err != nil {
+		return 0, err
+	}
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	for _, suggestion := range snapshot.Suggestions {
+		s.insert(suggestion)
+	}
+	s.snapshotLSN = snapshot.LSN
+
+	// Cached results stay valid for the generation the snapshot was taken of
+	if snapshot.Generation > 0 {
+		gen := s.current()
+		gen.id = snapshot.Generation
+		gen.source = "snapshot"
+		s.lastGeneration = max(s.lastGeneration, snapshot.Generation)
+	}
+
+	// Scores in the snapshot are weighted from its epoch
+	if !snapshot.ScoreEpoch.IsZero() {
+		s.scoreEpoch.Store(snapshot.ScoreEpoch.UnixNano())
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"path":        path,
+		"suggestions": len(snapshot.Suggestions),
+		"lsn":         snapshot.LSN,
+		"generation":  snapshot.Generation,
+		"created_at":  snapshot.CreatedAt,
+		"score_epoch": snapshot.ScoreEpoch,
+	}).Info("Restored index from snapshot")
+
+	return len(snapshot.Suggestions), nil
+}
+
+// AttachWAL replays the log entries newer than the loaded snapshot and then
+// records every later mutation in wal. It returns the number of entries
+// replayed.
+func (s *AutocompleteService) AttachWAL(wal *persistence.WAL) (int, error) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	wal.AdvanceTo(s.snapshotLSN)
+
+	replayed := 0
+	err := wal.Replay(s.snapshotLSN, func(entry persistence.Entry) error {
+		if err := s.applyEntry(entry); err != nil {
+			return err
+		}
+		replayed++
+		return nil
+	})
+	if err != nil {
+		return replayed, err
+	}
+
+	s.wal = wal
+	if replayed > 0 {
+		s.logger.WithField("entries", replayed).Info("Replayed write-ahead log")
+	}
+
+	return replayed, nil
+}
+
+// logMutation appends a mutation to the WAL, if one is attached, and keeps
+// it for a rebuild in progress to catch up on. Callers must hold writeMu.
+func (s *AutocompleteService) logMutation(entry persistence.Entry) error {
+	if s.wal != nil {
+		if _, err := s.wal.Append(entry); err != nil {
+			s.logger.WithError(err).Error("Failed to write to write-ahead log")
+			s.metrics.RecordError("service", "wal_append_failed")
+			return err
+		}
+	}
+
+	if s.rebuilding {
+		s.pending = append(s.pending, entry)
+	}
+	return nil
+}
+
+// applyEntry applies a replayed WAL entry to the index
+func (s *AutocompleteService) applyEntry(entry persistence.Entry) error {
+	for _, g := range s.targets() {
+		if err := g.apply(entry); err != nil {
+			return err
+		}
+	}
+	if entry.Op == persistence.OpDecay {
+		s.scoreEpoch.Store(entry.Time.UnixNano())
+	}
+	return nil
+}
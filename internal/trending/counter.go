@@ -0,0 +1,87 @@
+package trending
+
+import "container/heap"
+
+// queryCounts counts searches per query within a bucket, tracking at most
+// capacity queries with the space-saving algorithm: once full, a new query
+// takes the place of the least counted one and inherits its count, recorded
+// as the new query's error. Every count is then at most error over the true
+// count, and any query searched more than 1/capacity of the bucket's searches
+// is always tracked.
+type queryCounts struct {
+	capacity int
+	byQuery  map[string]*queryCount
+	heap     countHeap // Least counted first
+}
+
+// queryCount is a tracked query's count, of which up to error may belong to
+// the queries it replaced
+type queryCount struct {
+	query string
+	count int64
+	error int64
+	index int // Position in the heap
+}
+
+func newQueryCounts(capacity int) *queryCounts {
+	return &queryCounts{
+		capacity: capacity,
+		byQuery:  make(map[string]*queryCount),
+	}
+}
+
+// add counts a search for query
+func (c *queryCounts) add(query string) {
+	if qc, ok := c.byQuery[query]; ok {
+		qc.count++
+		heap.Fix(&c.heap, qc.index)
+		return
+	}
+
+	if len(c.heap) < c.capacity {
+		qc := &queryCount{query: query, count: 1}
+		c.byQuery[query] = qc
+		heap.Push(&c.heap, qc)
+		return
+	}
+
+	// Replace the least counted query, keeping its count as the error
+	least := c.heap[0]
+	delete(c.byQuery, least.query)
+	least.query = query
+	least.error = least.count
+	least.count++
+	c.byQuery[query] = least
+	heap.Fix(&c.heap, 0)
+}
+
+// len returns the number of queries tracked
+func (c *queryCounts) len() int {
+	return len(c.heap)
+}
+
+// countHeap is a min-heap of counts
+type countHeap []*queryCount
+
+func (h countHeap) Len() int { return len(h) }
+
+func (h countHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h countHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *countHeap) Push(x any) {
+	qc := x.(*queryCount)
+	qc.index = len(*h)
+	*h = append(*h, qc)
+}
+
+func (h *countHeap) Pop() any {
+	old := *h
+	qc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return qc
+}
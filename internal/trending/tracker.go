@@ -0,0 +1,253 @@
+package trending
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// bucketsPerWindow is how finely the recent window is divided. Counts slide
+// forward one bucket at a time.
+const bucketsPerWindow = 12
+
+// minBoost is the strength below which a faded trend is forgotten
+const minBoost = 0.01
+
+// defaultMaxQueries is how many queries each bucket counts when
+// Config.MaxQueries is unset
+const defaultMaxQueries = 1000
+
+// Config holds trend detection configuration
+type Config struct {
+	Window    time.Duration // Recent activity that is compared against the baseline
+	Baseline  time.Duration // History used to work out a query's usual rate
+	MinCount  int64         // Searches needed within the window to trend
+	Threshold float64       // How many times its usual rate a query must reach
+	HalfLife  time.Duration // Time for a trend's boost to halve once it ends
+
+	// MaxQueries caps the queries counted in each of a window's
+	// bucketsPerWindow buckets. Rarer queries share approximate counts,
+	// which is enough to tell that they aren't trending.
+	MaxQueries int
+}
+
+// Tracker counts queries over a sliding window and flags those searched for
+// much more often than usual. Trending queries get a ranking boost that
+// fades out once the trend ends. Memory is bounded by Config.MaxQueries per
+// bucket, however many distinct queries are searched.
+type Tracker struct {
+	config  Config
+	mutex   sync.RWMutex
+	buckets map[int64]*queryCounts // Query counts by bucket number
+	trends  map[string]*trend
+	boosts  map[string]float64 // Replaced, never modified, on every update
+	now     func() time.Time
+}
+
+// trend is a query that is, or recently was, trending
+type trend struct {
+	score      float64
+	count      int64
+	since      time.Time
+	lastActive time.Time
+	active     bool
+}
+
+// NewTracker creates a new trend tracker
+func NewTracker(config Config) *Tracker {
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+	if config.Baseline <= config.Window {
+		config.Baseline = max(24*time.Hour, 2*config.Window)
+	}
+	if config.MinCount <= 0 {
+		config.MinCount = 5
+	}
+	if config.Threshold <= 1 {
+		config.Threshold = 1.5
+	}
+	if config.HalfLife <= 0 {
+		config.HalfLife = time.Hour
+	}
+	if config.MaxQueries <= 0 {
+		config.MaxQueries = defaultMaxQueries
+	}
+
+	return &Tracker{
+		config:  config,
+		buckets: make(map[int64]*queryCounts),
+		trends:  make(map[string]*trend),
+		boosts:  make(map[string]float64),
+		now:     time.Now,
+	}
+}
+
+// Record counts a search for query made at the given time. Searches older
+// than the baseline are ignored.
+func (t *Tracker) Record(query string, at time.Time) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	if at.After(now) {
+		at = now
+	}
+	if now.Sub(at) >= t.config.Baseline {
+		return
+	}
+
+	bucket := t.bucket(at)
+	counts, ok := t.buckets[bucket]
+	if !ok {
+		counts = newQueryCounts(t.config.MaxQueries)
+		t.buckets[bucket] = counts
+	}
+	counts.add(query)
+}
+
+// Update re-scores every query against its baseline and refreshes the
+// ranking boosts. It returns the queries that started trending.
+func (t *Tracker) Update() []models.TrendingQuery {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := t.now()
+	current := t.bucket(now)
+	oldest := t.bucket(now.Add(-t.config.Baseline)) + 1
+	recentStart := current - bucketsPerWindow + 1
+
+	// Split each query's count between the window and the baseline before
+	// it. Approximate counts err towards not trending: recent searches are
+	// counted without the error, the baseline with it.
+	recent := make(map[string]int64)
+	baseline := make(map[string]int64)
+	for bucket, counts := range t.buckets {
+		if bucket < oldest {
+			delete(t.buckets, bucket)
+			continue
+		}
+		for query, qc := range counts.byQuery {
+			if bucket >= recentStart {
+				recent[query] += qc.count - qc.error
+			} else {
+				baseline[query] += qc.count
+			}
+		}
+	}
+
+	for _, tr := range t.trends {
+		tr.active = false
+	}
+
+	var started []models.TrendingQuery
+	baselineWindows := float64(t.config.Baseline-t.config.Window) / float64(t.config.Window)
+	for query, count := range recent {
+		if count < t.config.MinCount {
+			continue
+		}
+
+		// A query never seen before is compared against one search per window
+		expected := float64(baseline[query]) / baselineWindows
+		score := float64(count) / max(expected, 1)
+		if score < t.config.Threshold {
+			continue
+		}
+
+		// A trend that comes back before it has faded keeps its start time
+		tr, ok := t.trends[query]
+		isNew := !ok || t.boost(tr, now) < minBoost
+		if isNew {
+			tr = &trend{since: now}
+			t.trends[query] = tr
+		}
+		tr.score = score
+		tr.count = count
+		tr.lastActive = now
+		tr.active = true
+
+		if isNew {
+			started = append(started, t.snapshot(query, tr, now))
+		}
+	}
+
+	boosts := make(map[string]float64, len(t.trends))
+	for query, tr := range t.trends {
+		boost := t.boost(tr, now)
+		if boost < minBoost {
+			delete(t.trends, query)
+			continue
+		}
+		boosts[query] = boost
+	}
+	t.boosts = boosts
+
+	return started
+}
+
+// Trending returns the queries trending as of the last update, highest
+// score first
+func (t *Tracker) Trending() []models.TrendingQuery {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	now := t.now()
+	trending := make([]models.TrendingQuery, 0, len(t.trends))
+	for query, tr := range t.trends {
+		if tr.active {
+			trending = append(trending, t.snapshot(query, tr, now))
+		}
+	}
+
+	sort.Slice(trending, func(i, j int) bool {
+		if trending[i].Score != trending[j].Score {
+			return trending[i].Score > trending[j].Score
+		}
+		return trending[i].Query < trending[j].Query
+	})
+	return trending
+}
+
+// Boosts returns the ranking boost of every trending or fading query, from
+// 0 to 1. The map must not be modified.
+func (t *Tracker) Boosts() map[string]float64 {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	return t.boosts
+}
+
+// boost turns a trend score into a strength between 0 and 1 that halves
+// every half-life after the trend ends. Callers must hold the mutex.
+func (t *Tracker) boost(tr *trend, now time.Time) float64 {
+	strength := 1 - 1/tr.score
+	if tr.active {
+		return strength
+	}
+	return strength * math.Pow(0.5, float64(now.Sub(tr.lastActive))/float64(t.config.HalfLife))
+}
+
+// snapshot describes a trend for the API. Callers must hold the mutex.
+func (t *Tracker) snapshot(query string, tr *trend, now time.Time) models.TrendingQuery {
+	return models.TrendingQuery{
+		Query: query,
+		Score: tr.score,
+		Count: tr.count,
+		Boost: t.boost(tr, now),
+		Since: tr.since,
+	}
+}
+
+// bucket returns the number of the bucket a time falls in
+func (t *Tracker) bucket(at time.Time) int64 {
+	return at.UnixNano() / int64(t.config.Window/bucketsPerWindow)
+}
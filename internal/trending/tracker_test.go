@@ -0,0 +1,103 @@
+package trending
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTracker returns a tracker whose clock only moves when advanced
+func newTestTracker(config Config) (*Tracker, func(time.Duration)) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	t := NewTracker(config)
+	t.now = func() time.Time { return now }
+	return t, func(d time.Duration) { now = now.Add(d) }
+}
+
+// record counts n searches for query made at the tracker's current time
+func record(t *Tracker, query string, n int) {
+	for i := 0; i < n; i++ {
+		t.Record(query, t.now())
+	}
+}
+
+func TestTracker_DetectsSpikes(t *testing.T) {
+	tracker, advance := newTestTracker(Config{Window: time.Hour, Baseline: 11 * time.Hour})
+
+	// "weather" is searched steadily, ten times an hour
+	for i := 0; i < 10; i++ {
+		record(tracker, "weather", 10)
+		advance(time.Hour)
+	}
+	record(tracker, "weather", 10)
+	record(tracker, "World Cup ", 20)
+	record(tracker, "rare", 2)
+
+	started := tracker.Update()
+	require.Len(t, started, 1)
+	assert.Equal(t, "world cup", started[0].Query)
+	assert.Equal(t, int64(20), started[0].Count)
+	assert.Equal(t, 20.0, started[0].Score, "never searched before, so compared against one search per window")
+	assert.InDelta(t, 0.95, started[0].Boost, 1e-9)
+
+	trending := tracker.Trending()
+	require.Len(t, trending, 1)
+	assert.Equal(t, "world cup", trending[0].Query)
+	assert.NotContains(t, tracker.Boosts(), "weather", "steady queries don't trend")
+	assert.NotContains(t, tracker.Boosts(), "rare", "too few searches to trend")
+}
+
+func TestTracker_BoostFadesAfterTrendEnds(t *testing.T) {
+	tracker, advance := newTestTracker(Config{Window: time.Hour, HalfLife: time.Hour})
+
+	record(tracker, "world cup", 20)
+	tracker.Update()
+	assert.InDelta(t, 0.95, tracker.Boosts()["world cup"], 1e-9)
+
+	// The searches slide out of the window
+	advance(2 * time.Hour)
+	assert.Empty(t, tracker.Update())
+	assert.Empty(t, tracker.Trending())
+	assert.InDelta(t, 0.95/4, tracker.Boosts()["world cup"], 1e-9, "two half-lives since the trend was last seen")
+
+	advance(10 * time.Hour)
+	tracker.Update()
+	assert.NotContains(t, tracker.Boosts(), "world cup", "faded trends are forgotten")
+}
+
+func TestTracker_IgnoresOldSearches(t *testing.T) {
+	tracker, _ := newTestTracker(Config{})
+
+	for i := 0; i < 20; i++ {
+		tracker.Record("archive", tracker.now().Add(-30*24*time.Hour))
+	}
+	assert.Empty(t, tracker.Update())
+	assert.Empty(t, tracker.buckets)
+}
+
+func TestTracker_BoundsQueriesPerBucket(t *testing.T) {
+	tracker, _ := newTestTracker(Config{Window: time.Hour, MaxQueries: 10})
+
+	// A long tail of one-off queries around a spike of a sixth of all
+	// searches, well over the tenth a bucket of ten always keeps
+	for i := 0; i < 2000; i++ {
+		record(tracker, fmt.Sprintf("one-off %d", i), 1)
+		if i%5 == 0 {
+			record(tracker, "world cup", 1)
+		}
+	}
+
+	require.Len(t, tracker.buckets, 1)
+	for _, counts := range tracker.buckets {
+		assert.Equal(t, 10, counts.len())
+		assert.Len(t, counts.byQuery, 10)
+	}
+
+	started := tracker.Update()
+	require.Len(t, started, 1, "the tail shares approximate counts, so none of it trends")
+	assert.Equal(t, "world cup", started[0].Query)
+	assert.LessOrEqual(t, started[0].Count, int64(400), "counts never exceed the true count once the error is taken off")
+}
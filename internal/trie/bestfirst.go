@@ -0,0 +1,76 @@
+package trie
+
+import (
+	"container/heap"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// expandFunc reports a node's own suggestions to term and its non-empty
+// children, each with the best suggestion below it, to child
+type expandFunc[N any] func(node N, term func(models.Suggestion), child func(N, models.Suggestion))
+
+// bestFirst returns the best limit suggestions below root that match
+// accepts, in ranking order. Nodes are expanded in order of the best
+// suggestion below them, which their top-K lists hold first, so the walk
+// ends as soon as limit suggestions are accepted and never enters a subtree
+// whose best can't make the cut.
+func bestFirst[N any](root N, best models.Suggestion, limit int, match func(models.Suggestion) bool, expand expandFunc[N]) []models.Suggestion {
+	var suggestions []models.Suggestion
+	queue := &bestQueue[N]{{node: root, expand: true, best: best}}
+
+	term := func(suggestion models.Suggestion) {
+		heap.Push(queue, bestEntry[N]{best: suggestion})
+	}
+	child := func(node N, best models.Suggestion) {
+		heap.Push(queue, bestEntry[N]{node: node, expand: true, best: best})
+	}
+
+	for queue.Len() > 0 && len(suggestions) < limit {
+		entry := heap.Pop(queue).(bestEntry[N])
+		if !entry.expand {
+			if match(entry.best) {
+				suggestions = append(suggestions, entry.best)
+			}
+			continue
+		}
+		expand(entry.node, term, child)
+	}
+	return suggestions
+}
+
+// bestEntry is a node still to be expanded, or a term still to be matched
+// when expand is false. best is the term, or the best suggestion below the
+// node.
+type bestEntry[N any] struct {
+	node   N
+	expand bool
+	best   models.Suggestion
+}
+
+// bestQueue is a heap of entries in ranking order. A node sorts before a
+// term that ranks the same, since that term may be the node's best.
+type bestQueue[N any] []bestEntry[N]
+
+func (q bestQueue[N]) Len() int { return len(q) }
+
+func (q bestQueue[N]) Less(i, j int) bool {
+	if lessSuggestion(q[i].best, q[j].best) {
+		return true
+	}
+	if lessSuggestion(q[j].best, q[i].best) {
+		return false
+	}
+	return q[i].expand && !q[j].expand
+}
+
+func (q bestQueue[N]) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *bestQueue[N]) Push(x any) { *q = append(*q, x.(bestEntry[N])) }
+
+func (q *bestQueue[N]) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
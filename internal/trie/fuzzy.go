@@ -0,0 +1,115 @@
+package trie
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// FuzzyMatch is a suggestion whose term starts within Distance edits of the
+// searched prefix
+type FuzzyMatch struct {
+	Suggestion models.Suggestion
+	Distance   int
+}
+
+// fuzzyQuery computes a bounded Damerau-Levenshtein (optimal string
+// alignment) distance between a query and a path through an index, one rune
+// at a time. Each row holds the distance from the path so far to every
+// prefix of the query, so the last cell is the distance to the whole query.
+type fuzzyQuery struct {
+	query    []rune
+	maxEdits int
+}
+
+func newFuzzyQuery(prefix string, maxEdits int) *fuzzyQuery {
+	return &fuzzyQuery{
+		query:    []rune(strings.ToLower(strings.TrimSpace(prefix))),
+		maxEdits: maxEdits,
+	}
+}
+
+// firstRow is the row for the empty path
+func (q *fuzzyQuery) firstRow() []int {
+	row := make([]int, len(q.query)+1)
+	for i := range row {
+		row[i] = i
+	}
+	return row
+}
+
+// next returns the row after char is appended to the path. prev2 and
+// prevChar describe the step before prev and are used to spot
+// transpositions; prev2 is nil for the first rune.
+func (q *fuzzyQuery) next(prev2, prev []int, prevChar, char rune) []int {
+	row := make([]int, len(prev))
+	row[0] = prev[0] + 1
+	for j := 1; j < len(row); j++ {
+		cost := 1
+		if q.query[j-1] == char {
+			cost = 0
+		}
+		row[j] = min(prev[j]+1, row[j-1]+1, prev[j-1]+cost)
+
+		if prev2 != nil && j > 1 && q.query[j-1] == prevChar && q.query[j-2] == char {
+			row[j] = min(row[j], prev2[j-2]+1)
+		}
+	}
+	return row
+}
+
+// distance is the edit distance between the path and the whole query
+func (q *fuzzyQuery) distance(row []int) int {
+	return row[len(row)-1]
+}
+
+// visit reports whether the path described by row matches, and whether it
+// is worth descending further. Extending a path never lowers the minimum of
+// its row, so once that minimum passes the budget, or reaches the distance
+// already matched, nothing below can do better.
+func (q *fuzzyQuery) visit(row []int) (matched, descend bool) {
+	lowest := row[0]
+	for _, d := range row[1:] {
+		lowest = min(lowest, d)
+	}
+
+	distance := q.distance(row)
+	if distance <= q.maxEdits {
+		return true, lowest < distance
+	}
+	return false, lowest <= q.maxEdits
+}
+
+// fuzzyCollector keeps the closest distance seen for each term
+type fuzzyCollector map[string]FuzzyMatch
+
+// add records suggestions found at distance
+func (c fuzzyCollector) add(suggestions []models.Suggestion, distance int) {
+	for _, suggestion := range suggestions {
+		if existing, ok := c[suggestion.Term]; ok && existing.Distance <= distance {
+			continue
+		}
+		c[suggestion.Term] = FuzzyMatch{Suggestion: suggestion, Distance: distance}
+	}
+}
+
+// results returns the best matches, closest first and then by score
+func (c fuzzyCollector) results(limit int) []FuzzyMatch {
+	matches := make([]FuzzyMatch, 0, len(c))
+	for _, match := range c {
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return lessSuggestion(matches[i].Suggestion, matches[j].Suggestion)
+	})
+
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
@@ -0,0 +1,63 @@
+package trie
+
+import (
+	"fmt"
+	"iter"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// Supported index implementations
+const (
+	IndexTypeTrie  = "trie"
+	IndexTypeRadix = "radix"
+)
+
+// Index is the contract shared by the suggestion index implementations
+type Index interface {
+	Insert(suggestion models.Suggestion)
+	Search(prefix string, limit int) []models.Suggestion
+	// SearchFunc is Search keeping only the suggestions match accepts. It
+	// stops as soon as limit are found rather than visiting every term
+	// under prefix.
+	SearchFunc(prefix string, limit int, match func(models.Suggestion) bool) []models.Suggestion
+	// FuzzySearch finds terms starting within maxEdits edits of prefix,
+	// closest first
+	FuzzySearch(prefix string, maxEdits, limit int) []FuzzyMatch
+	Delete(term string) bool
+	// Get returns the suggestion stored for exactly term
+	Get(term string) (models.Suggestion, bool)
+	// UpdateFrequency sets a term's frequency and score
+	UpdateFrequency(term string, frequency int64, score float64)
+	// AddFrequency adds delta to a term's frequency and score to its score
+	// atomically. It returns the updated suggestion and false if the term
+	// doesn't exist.
+	AddFrequency(term string, delta int64, score float64) (models.Suggestion, bool)
+	// Decay multiplies every score by factor. Scaling all scores alike keeps
+	// their order, so no top-K list needs rebuilding.
+	Decay(factor float64)
+	GetSuggestionsCount() int
+	// Walk calls fn for every suggestion until fn returns false. fn must not
+	// call back into the index.
+	Walk(fn func(models.Suggestion) bool)
+	// Suggestions iterates over every suggestion whose term starts with
+	// prefix, in term order. The index stays read-locked until the loop
+	// ends, so the loop body must not call back into it.
+	Suggestions(prefix string) iter.Seq[models.Suggestion]
+	// SuggestionsAfter is Suggestions starting after the term after, so a
+	// long iteration can be taken a page at a time
+	SuggestionsAfter(prefix, after string) iter.Seq[models.Suggestion]
+}
+
+// NewIndex creates an index of the given type
+func NewIndex(indexType string, metrics *metrics.Metrics) (Index, error) {
+	switch indexType {
+	case "", IndexTypeTrie:
+		return NewWithMetrics(metrics), nil
+	case IndexTypeRadix:
+		return NewRadixWithMetrics(metrics), nil
+	default:
+		return nil, fmt.Errorf("unknown index type %q", indexType)
+	}
+}
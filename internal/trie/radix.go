@@ -0,0 +1,595 @@
+package trie
+
+import (
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// RadixTree is a path-compressed trie. Chains of single-child nodes are
+// collapsed into one edge label, so it needs far fewer nodes than Trie for
+// large corpora while exposing the same operations.
+type RadixTree struct {
+	root    *radixNode
+	mutex   sync.RWMutex
+	metrics *metrics.Metrics
+	size    int // Track number of suggestions
+	topK    int // Number of suggestions precomputed per node
+}
+
+// radixNode is a node in the radix tree. Labels always split on rune
+// boundaries so every label is valid UTF-8.
+type radixNode struct {
+	label       string
+	children    []*radixNode // Sorted by the first rune of their label
+	isEnd       bool
+	suggestions []models.Suggestion
+	topK        []models.Suggestion
+}
+
+// NewRadix creates a new RadixTree instance
+func NewRadix() *RadixTree {
+	return NewRadixWithMetrics(nil)
+}
+
+// NewRadixWithMetrics creates a new RadixTree instance with provided metrics
+func NewRadixWithMetrics(metrics *metrics.Metrics) *RadixTree {
+	return &RadixTree{
+		root:    &radixNode{},
+		metrics: metrics,
+		topK:    DefaultTopK,
+	}
+}
+
+// NewRadixWithTopK creates a new RadixTree instance that precomputes k suggestions per node
+func NewRadixWithTopK(k int, metrics *metrics.Metrics) *RadixTree {
+	r := NewRadixWithMetrics(metrics)
+	if k > 0 {
+		r.topK = k
+	}
+	return r
+}
+
+// Insert adds a suggestion to the tree
+func (r *RadixTree) Insert(suggestion models.Suggestion) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	term := strings.ToLower(strings.TrimSpace(suggestion.Term))
+	if term == "" {
+		return
+	}
+
+	node := r.root
+	path := []*radixNode{node}
+	rest := term
+	for rest != "" {
+		idx, child := node.child(rest)
+		if child == nil {
+			leaf := &radixNode{label: rest}
+			node.addChild(leaf)
+			path = append(path, leaf)
+			node = leaf
+			break
+		}
+
+		common := commonPrefixLength(rest, child.label)
+		if common < len(child.label) {
+			// Split the edge so the new term can branch off it
+			mid := &radixNode{
+				label:    child.label[:common],
+				children: []*radixNode{child},
+				topK:     append([]models.Suggestion(nil), child.topK...),
+			}
+			child.label = child.label[common:]
+			node.children[idx] = mid
+			child = mid
+		}
+
+		path = append(path, child)
+		node = child
+		rest = rest[common:]
+	}
+
+	isNewSuggestion := !node.isEnd
+	node.isEnd = true
+
+	// Add or update suggestion in the node
+	found := false
+	for i := range node.suggestions {
+		if node.suggestions[i].Term == suggestion.Term {
+			node.suggestions[i] = suggestion
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		node.suggestions = append(node.suggestions, suggestion)
+		if isNewSuggestion {
+			r.size++
+		}
+	}
+
+	sortSuggestions(node.suggestions)
+	r.promotePath(path, suggestion)
+
+	// Record metrics
+	if r.metrics != nil {
+		r.metrics.RecordTrieInsert()
+		r.metrics.UpdateTrieSize(r.size)
+	}
+}
+
+// Search finds suggestions for a given prefix
+func (r *RadixTree) Search(prefix string, limit int) []models.Suggestion {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return []models.Suggestion{}
+	}
+
+	node := r.findPrefix(prefix)
+	if node == nil {
+		if r.metrics != nil {
+			r.metrics.RecordTrieSearch(0)
+		}
+		return []models.Suggestion{}
+	}
+
+	suggestions := r.best(node, limit)
+
+	if r.metrics != nil {
+		r.metrics.RecordTrieSearch(len(suggestions))
+	}
+
+	return suggestions
+}
+
+// SearchFunc finds the best suggestions for a prefix that match accepts
+func (r *RadixTree) SearchFunc(prefix string, limit int, match func(models.Suggestion) bool) []models.Suggestion {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || limit <= 0 {
+		return []models.Suggestion{}
+	}
+
+	node := r.findPrefix(prefix)
+	if node == nil || len(node.topK) == 0 {
+		return []models.Suggestion{}
+	}
+
+	return bestFirst(node, node.topK[0], limit, match, func(node *radixNode, term func(models.Suggestion), child func(*radixNode, models.Suggestion)) {
+		if node.isEnd {
+			for _, suggestion := range node.suggestions {
+				term(suggestion)
+			}
+		}
+		for _, c := range node.children {
+			if len(c.topK) > 0 {
+				child(c, c.topK[0])
+			}
+		}
+	})
+}
+
+// best returns the top suggestions in the subtree under node
+func (r *RadixTree) best(node *radixNode, limit int) []models.Suggestion {
+	if limit <= r.topK {
+		n := min(limit, len(node.topK))
+		suggestions := make([]models.Suggestion, n)
+		copy(suggestions, node.topK[:n])
+		return suggestions
+	}
+
+	var suggestions []models.Suggestion
+	node.collect(&suggestions)
+	sortSuggestions(suggestions)
+
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
+
+// FuzzySearch finds suggestions whose terms start within maxEdits edits
+// (insertions, deletions, substitutions or adjacent transpositions) of prefix
+func (r *RadixTree) FuzzySearch(prefix string, maxEdits, limit int) []FuzzyMatch {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	q := newFuzzyQuery(prefix, maxEdits)
+	if len(q.query) == 0 || limit <= 0 {
+		return []FuzzyMatch{}
+	}
+
+	matches := make(fuzzyCollector)
+	for _, child := range r.root.children {
+		r.fuzzyWalk(child, q, nil, q.firstRow(), 0, matches, limit)
+	}
+
+	return matches.results(limit)
+}
+
+// fuzzyWalk extends the edit distance rows one rune at a time along the
+// node's label. A match part way along the label covers the node's subtree.
+func (r *RadixTree) fuzzyWalk(node *radixNode, q *fuzzyQuery, prev2, prev []int, prevChar rune, matches fuzzyCollector, limit int) {
+	for _, char := range node.label {
+		row := q.next(prev2, prev, prevChar, char)
+		prev2, prev, prevChar = prev, row, char
+
+		matched, descend := q.visit(row)
+		if matched {
+			matches.add(r.best(node, limit), q.distance(row))
+		}
+		if !descend {
+			return
+		}
+	}
+
+	for _, child := range node.children {
+		r.fuzzyWalk(child, q, prev2, prev, prevChar, matches, limit)
+	}
+}
+
+// GetSuggestionsCount returns the total number of unique suggestions in the tree
+func (r *RadixTree) GetSuggestionsCount() int {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.root.count()
+}
+
+// Walk calls fn for every suggestion in the tree until fn returns false
+func (r *RadixTree) Walk(fn func(models.Suggestion) bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	r.root.walk(fn)
+}
+
+// Suggestions iterates over every suggestion whose term starts with prefix,
+// in term order. Children are kept sorted, so a plain walk is ordered.
+func (r *RadixTree) Suggestions(prefix string) iter.Seq[models.Suggestion] {
+	return func(yield func(models.Suggestion) bool) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		if node := r.findPrefix(strings.ToLower(strings.TrimSpace(prefix))); node != nil {
+			node.walk(yield)
+		}
+	}
+}
+
+// SuggestionsAfter iterates over every suggestion whose term starts with
+// prefix and sorts after the term after, in term order
+func (r *RadixTree) SuggestionsAfter(prefix, after string) iter.Seq[models.Suggestion] {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	after = strings.ToLower(strings.TrimSpace(after))
+
+	return func(yield func(models.Suggestion) bool) {
+		r.mutex.RLock()
+		defer r.mutex.RUnlock()
+
+		r.root.walkAfter("", prefix, after, yield)
+	}
+}
+
+// Get returns the suggestion stored for exactly term
+func (r *RadixTree) Get(term string) (models.Suggestion, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	path := r.findPath(strings.ToLower(strings.TrimSpace(term)))
+	if path == nil {
+		return models.Suggestion{}, false
+	}
+
+	node := path[len(path)-1]
+	if len(node.suggestions) == 0 {
+		return models.Suggestion{}, false
+	}
+	return node.suggestions[0], true
+}
+
+// Delete removes a suggestion from the tree
+func (r *RadixTree) Delete(term string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return false
+	}
+
+	deleted := r.deleteHelper(r.root, term)
+	if deleted {
+		r.refreshTopK(r.root)
+		r.size--
+		if r.metrics != nil {
+			r.metrics.RecordTrieDelete()
+			r.metrics.UpdateTrieSize(r.size)
+		}
+	}
+
+	return deleted
+}
+
+// deleteHelper removes the term below node and repairs the edges it leaves
+// behind, merging nodes that end up with a single child
+func (r *RadixTree) deleteHelper(node *radixNode, rest string) bool {
+	if rest == "" {
+		if !node.isEnd {
+			return false
+		}
+		node.isEnd = false
+		node.suggestions = nil
+		return true
+	}
+
+	idx, child := node.child(rest)
+	if child == nil || !strings.HasPrefix(rest, child.label) {
+		return false
+	}
+
+	if !r.deleteHelper(child, rest[len(child.label):]) {
+		return false
+	}
+
+	switch {
+	case !child.isEnd && len(child.children) == 0:
+		node.children = append(node.children[:idx], node.children[idx+1:]...)
+	case !child.isEnd && len(child.children) == 1:
+		// The grandchild's subtree is unchanged, so its top-K is still valid
+		grandchild := child.children[0]
+		grandchild.label = child.label + grandchild.label
+		node.children[idx] = grandchild
+	default:
+		r.refreshTopK(child)
+	}
+
+	return true
+}
+
+// UpdateFrequency updates the frequency of a term in the tree and sets its score
+func (r *RadixTree) UpdateFrequency(term string, frequency int64, score float64) {
+	r.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency = frequency
+		suggestion.Score = score
+	})
+}
+
+// AddFrequency adds delta to a term's frequency and score to its score in a
+// single step. It returns the updated suggestion and false if the term doesn't
+// exist.
+func (r *RadixTree) AddFrequency(term string, delta int64, score float64) (models.Suggestion, bool) {
+	return r.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency += delta
+		suggestion.Score += score
+	})
+}
+
+// rescore applies update to a stored suggestion and re-ranks it
+func (r *RadixTree) rescore(term string, update func(*models.Suggestion)) (models.Suggestion, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	if term == "" {
+		return models.Suggestion{}, false
+	}
+
+	path := r.findPath(term)
+	if path == nil {
+		return models.Suggestion{}, false // Term doesn't exist
+	}
+
+	node := path[len(path)-1]
+	for i := range node.suggestions {
+		if strings.ToLower(node.suggestions[i].Term) != term {
+			continue
+		}
+		update(&node.suggestions[i])
+		updated := node.suggestions[i]
+		r.promotePath(path, updated)
+		sortSuggestions(node.suggestions)
+		return updated, true
+	}
+	return models.Suggestion{}, false
+}
+
+// Decay multiplies every score in the tree by factor
+func (r *RadixTree) Decay(factor float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.root.decay(factor)
+}
+
+// decay scales the scores stored at and below n
+func (n *radixNode) decay(factor float64) {
+	scaleScores(n.suggestions, factor)
+	scaleScores(n.topK, factor)
+	for _, child := range n.children {
+		child.decay(factor)
+	}
+}
+
+// findPrefix returns the node whose subtree holds every term starting with prefix
+func (r *RadixTree) findPrefix(prefix string) *radixNode {
+	node := r.root
+	rest := prefix
+	for rest != "" {
+		_, child := node.child(rest)
+		switch {
+		case child == nil:
+			return nil
+		case strings.HasPrefix(rest, child.label):
+			rest = rest[len(child.label):]
+		case strings.HasPrefix(child.label, rest):
+			// The prefix ends part way along this edge
+			rest = ""
+		default:
+			return nil
+		}
+		node = child
+	}
+	return node
+}
+
+// findPath returns the nodes from the root to the node that ends exactly at term
+func (r *RadixTree) findPath(term string) []*radixNode {
+	node := r.root
+	path := []*radixNode{node}
+	rest := term
+	for rest != "" {
+		_, child := node.child(rest)
+		if child == nil || !strings.HasPrefix(rest, child.label) {
+			return nil
+		}
+		rest = rest[len(child.label):]
+		node = child
+		path = append(path, node)
+	}
+	if !node.isEnd {
+		return nil
+	}
+	return path
+}
+
+// promotePath applies an inserted or rescored suggestion to the top-K lists
+// from the deepest node up to the root
+func (r *RadixTree) promotePath(path []*radixNode, suggestion models.Suggestion) {
+	for i := len(path) - 1; i >= 0; i-- {
+		list, ok := mergeTopK(path[i].topK, suggestion, r.topK)
+		if !ok {
+			r.refreshTopK(path[i])
+			continue
+		}
+		path[i].topK = list
+	}
+}
+
+// refreshTopK rebuilds a node's top-K list from its own suggestions and the
+// top-K lists of its children, which must already be up to date
+func (r *RadixTree) refreshTopK(node *radixNode) {
+	var candidates []models.Suggestion
+	if node.isEnd {
+		candidates = append(candidates, node.suggestions...)
+	}
+	for _, child := range node.children {
+		candidates = append(candidates, child.topK...)
+	}
+	node.topK = selectTopK(candidates, r.topK)
+}
+
+// child returns the child whose label starts with the first rune of key
+func (n *radixNode) child(key string) (int, *radixNode) {
+	first, _ := utf8.DecodeRuneInString(key)
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return firstRune(n.children[i].label) >= first
+	})
+	if idx < len(n.children) && firstRune(n.children[idx].label) == first {
+		return idx, n.children[idx]
+	}
+	return idx, nil
+}
+
+// addChild inserts a child keeping the children sorted
+func (n *radixNode) addChild(child *radixNode) {
+	first := firstRune(child.label)
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return firstRune(n.children[i].label) >= first
+	})
+	n.children = append(n.children, nil)
+	copy(n.children[idx+1:], n.children[idx:])
+	n.children[idx] = child
+}
+
+// collect gathers every suggestion in the node's subtree
+func (n *radixNode) collect(suggestions *[]models.Suggestion) {
+	if n.isEnd {
+		*suggestions = append(*suggestions, n.suggestions...)
+	}
+	for _, child := range n.children {
+		child.collect(suggestions)
+	}
+}
+
+// walk visits the suggestions in the node's subtree and reports whether to continue
+func (n *radixNode) walk(fn func(models.Suggestion) bool) bool {
+	if n.isEnd {
+		for _, suggestion := range n.suggestions {
+			if !fn(suggestion) {
+				return false
+			}
+		}
+	}
+	for _, child := range n.children {
+		if !child.walk(fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkAfter is walk limited to the terms starting with prefix that sort
+// after the term after. key is the term the node spells.
+func (n *radixNode) walkAfter(key, prefix, after string, fn func(models.Suggestion) bool) bool {
+	inPrefix := strings.HasPrefix(key, prefix)
+	switch {
+	case !inPrefix && !strings.HasPrefix(prefix, key):
+		return true // No term below starts with prefix
+	case inPrefix && key > after:
+		return n.walk(fn)
+	case key <= after && !strings.HasPrefix(after, key):
+		return true // Every term below sorts before after
+	}
+
+	for _, child := range n.children {
+		if !child.walkAfter(key+child.label, prefix, after, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of suggestions in the node's subtree
+func (n *radixNode) count() int {
+	total := 0
+	if n.isEnd {
+		total += len(n.suggestions)
+	}
+	for _, child := range n.children {
+		total += child.count()
+	}
+	return total
+}
+
+// firstRune returns the first rune of a label
+func firstRune(s string) rune {
+	r, _ := utf8.DecodeRuneInString(s)
+	return r
+}
+
+// commonPrefixLength returns the byte length of the longest common prefix of
+// a and b, rounded down to a rune boundary
+func commonPrefixLength(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	for n > 0 && n < len(a) && !utf8.RuneStart(a[n]) {
+		n--
+	}
+	return n
+}
@@ -0,0 +1,388 @@
+package trie
+
+import (
+	"container/heap"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// maxTokenCandidates bounds how many terms a search checks against the query,
+// so a rare combination of common words can't walk a whole subtree
+const maxTokenCandidates = 10000
+
+// TokenIndex indexes every word of a suggestion so queries can match inside
+// multi-word terms: "pro" finds "python programming" and "mach lea" finds
+// "machine learning". It complements an Index, which only matches from the
+// start of the whole term.
+type TokenIndex struct {
+	root  *tokenNode
+	terms map[string]models.Suggestion // Keyed by normalized term
+	mutex sync.RWMutex
+	topK  int // Number of suggestions precomputed per node
+}
+
+// tokenNode is a rune-per-node trie over tokens
+type tokenNode struct {
+	children map[rune]*tokenNode
+	terms    map[string]struct{} // Normalized terms containing this exact token
+	topK     []models.Suggestion
+}
+
+// NewTokenIndex creates a new TokenIndex instance
+func NewTokenIndex() *TokenIndex {
+	return NewTokenIndexWithTopK(DefaultTopK)
+}
+
+// NewTokenIndexWithTopK creates a new TokenIndex instance that precomputes k suggestions per node
+func NewTokenIndexWithTopK(k int) *TokenIndex {
+	if k <= 0 {
+		k = DefaultTopK
+	}
+	return &TokenIndex{
+		root:  newTokenNode(),
+		terms: make(map[string]models.Suggestion),
+		topK:  k,
+	}
+}
+
+func newTokenNode() *tokenNode {
+	return &tokenNode{
+		children: make(map[rune]*tokenNode),
+		terms:    make(map[string]struct{}),
+	}
+}
+
+// Tokenize lowercases s and splits it into words on anything that is not a
+// letter or digit
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// MatchTokens reports whether every query token is a prefix of a term token,
+// in order, and whether the first query token matched the term's first token
+func MatchTokens(term, query string) (matched, leading bool) {
+	return matchTokens(Tokenize(term), Tokenize(query))
+}
+
+// matchTokens matches query tokens against term tokens greedily, which finds
+// the earliest in-order match if there is one
+func matchTokens(termTokens, queryTokens []string) (matched, leading bool) {
+	if len(queryTokens) == 0 {
+		return false, false
+	}
+
+	next := 0
+	for i, queryToken := range queryTokens {
+		for next < len(termTokens) && !strings.HasPrefix(termTokens[next], queryToken) {
+			next++
+		}
+		if next == len(termTokens) {
+			return false, false
+		}
+		if i == 0 {
+			leading = next == 0
+		}
+		next++
+	}
+	return true, leading
+}
+
+// Insert adds or replaces a suggestion
+func (t *TokenIndex) Insert(suggestion models.Suggestion) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(suggestion.Term))
+	if key == "" {
+		return
+	}
+
+	// A differently cased variant would leave its old spelling in the top-K lists
+	if existing, ok := t.terms[key]; ok && existing.Term != suggestion.Term {
+		t.remove(key)
+	}
+	t.terms[key] = suggestion
+
+	for _, token := range uniqueTokens(key) {
+		path := t.path(token, true)
+		path[len(path)-1].terms[key] = struct{}{}
+		t.promotePath(path, suggestion)
+	}
+}
+
+// Search returns the best suggestions whose words match the query tokens in order
+func (t *TokenIndex) Search(query string, limit int) []models.Suggestion {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	queryTokens := Tokenize(query)
+	if len(queryTokens) == 0 || limit <= 0 {
+		return []models.Suggestion{}
+	}
+
+	// The longest token is usually the most selective place to start
+	longest := queryTokens[0]
+	for _, token := range queryTokens[1:] {
+		if len(token) > len(longest) {
+			longest = token
+		}
+	}
+
+	path := t.path(longest, false)
+	if path == nil {
+		return []models.Suggestion{}
+	}
+	node := path[len(path)-1]
+
+	if len(queryTokens) == 1 && limit <= t.topK {
+		n := min(limit, len(node.topK))
+		suggestions := make([]models.Suggestion, n)
+		copy(suggestions, node.topK[:n])
+		return suggestions
+	}
+
+	// Walk the subtree best first: a node's top-K list starts with the best
+	// score below it, so terms come off the queue in ranking order and the
+	// walk stops as soon as enough of them match
+	suggestions := make([]models.Suggestion, 0, min(limit, t.topK))
+	if len(node.topK) == 0 {
+		return suggestions
+	}
+	queue := &searchQueue{{node: node, best: node.topK[0]}}
+	seen := make(map[string]struct{})
+
+	for queue.Len() > 0 && len(suggestions) < limit {
+		entry := heap.Pop(queue).(searchEntry)
+		if entry.node == nil {
+			if matched, _ := matchTokens(Tokenize(entry.best.Term), queryTokens); matched {
+				suggestions = append(suggestions, entry.best)
+			}
+			continue
+		}
+		if len(seen) >= maxTokenCandidates {
+			continue
+		}
+
+		for key := range entry.node.terms {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			heap.Push(queue, searchEntry{best: t.terms[key]})
+		}
+		for _, child := range entry.node.children {
+			if len(child.topK) > 0 {
+				heap.Push(queue, searchEntry{node: child, best: child.topK[0]})
+			}
+		}
+	}
+	return suggestions
+}
+
+// searchEntry is a node still to be expanded, or a term still to be matched
+// when node is nil. best is the term, or the best suggestion below the node.
+type searchEntry struct {
+	node *tokenNode
+	best models.Suggestion
+}
+
+// searchQueue is a heap of entries in ranking order. A node sorts before a
+// term with the same score, since it may hold a term that ranks first.
+type searchQueue []searchEntry
+
+func (q searchQueue) Len() int { return len(q) }
+
+func (q searchQueue) Less(i, j int) bool {
+	if q[i].best.Score != q[j].best.Score {
+		return q[i].best.Score > q[j].best.Score
+	}
+	if (q[i].node == nil) != (q[j].node == nil) {
+		return q[i].node != nil
+	}
+	return q[i].best.Term < q[j].best.Term
+}
+
+func (q searchQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *searchQueue) Push(x any) { *q = append(*q, x.(searchEntry)) }
+
+func (q *searchQueue) Pop() any {
+	old := *q
+	entry := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// Delete removes a suggestion and reports whether it was present
+func (t *TokenIndex) Delete(term string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(term))
+	if _, ok := t.terms[key]; !ok {
+		return false
+	}
+
+	t.remove(key)
+	return true
+}
+
+// UpdateFrequency updates the frequency and score of a suggestion
+func (t *TokenIndex) UpdateFrequency(term string, frequency int64, score float64) {
+	t.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency = frequency
+		suggestion.Score = score
+	})
+}
+
+// AddFrequency adds delta to a suggestion's frequency and score to its score
+func (t *TokenIndex) AddFrequency(term string, delta int64, score float64) {
+	t.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency += delta
+		suggestion.Score += score
+	})
+}
+
+// rescore applies update to a stored suggestion and re-ranks it under every
+// token it contains
+func (t *TokenIndex) rescore(term string, update func(*models.Suggestion)) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := strings.ToLower(strings.TrimSpace(term))
+	suggestion, ok := t.terms[key]
+	if !ok {
+		return
+	}
+
+	update(&suggestion)
+	t.terms[key] = suggestion
+
+	for _, token := range uniqueTokens(key) {
+		t.promotePath(t.path(token, false), suggestion)
+	}
+}
+
+// Decay multiplies every score in the index by factor
+func (t *TokenIndex) Decay(factor float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for key, suggestion := range t.terms {
+		suggestion.Score *= factor
+		t.terms[key] = suggestion
+	}
+	t.root.decay(factor)
+}
+
+// decay scales the top-K scores at and below n
+func (n *tokenNode) decay(factor float64) {
+	scaleScores(n.topK, factor)
+	for _, child := range n.children {
+		child.decay(factor)
+	}
+}
+
+// remove drops a term from every token it was indexed under, pruning empty
+// nodes and rebuilding the top-K lists bottom up
+func (t *TokenIndex) remove(key string) {
+	delete(t.terms, key)
+
+	for _, token := range uniqueTokens(key) {
+		path := t.path(token, false)
+		if path == nil {
+			continue
+		}
+		delete(path[len(path)-1].terms, key)
+
+		runes := []rune(token)
+		for i := len(path) - 1; i > 0; i-- {
+			node := path[i]
+			if len(node.terms) == 0 && len(node.children) == 0 {
+				delete(path[i-1].children, runes[i-1])
+				continue
+			}
+			t.refreshTopK(node)
+		}
+		t.refreshTopK(t.root)
+	}
+}
+
+// path returns the nodes from the root to token, creating them if asked.
+// Without create it returns nil when token isn't in the index.
+func (t *TokenIndex) path(token string, create bool) []*tokenNode {
+	node := t.root
+	path := []*tokenNode{node}
+	for _, char := range token {
+		child := node.children[char]
+		if child == nil {
+			if !create {
+				return nil
+			}
+			child = newTokenNode()
+			node.children[char] = child
+		}
+		node = child
+		path = append(path, node)
+	}
+	return path
+}
+
+// promotePath applies an inserted or rescored suggestion to the top-K lists
+// from the deepest node up to the root
+func (t *TokenIndex) promotePath(path []*tokenNode, suggestion models.Suggestion) {
+	for i := len(path) - 1; i >= 0; i-- {
+		list, ok := mergeTopK(path[i].topK, suggestion, t.topK)
+		if !ok {
+			t.refreshTopK(path[i])
+			continue
+		}
+		path[i].topK = list
+	}
+}
+
+// refreshTopK rebuilds a node's top-K list from its own terms and the top-K
+// lists of its children. A term with several matching tokens can show up in
+// more than one child, so candidates are deduplicated first.
+func (t *TokenIndex) refreshTopK(node *tokenNode) {
+	seen := make(map[string]struct{})
+	var candidates []models.Suggestion
+	add := func(suggestion models.Suggestion) {
+		if _, ok := seen[suggestion.Term]; ok {
+			return
+		}
+		seen[suggestion.Term] = struct{}{}
+		candidates = append(candidates, suggestion)
+	}
+
+	for key := range node.terms {
+		add(t.terms[key])
+	}
+	for _, child := range node.children {
+		for _, suggestion := range child.topK {
+			add(suggestion)
+		}
+	}
+
+	node.topK = selectTopK(candidates, t.topK)
+}
+
+// uniqueTokens returns the distinct tokens of a term
+func uniqueTokens(term string) []string {
+	tokens := Tokenize(term)
+	seen := make(map[string]struct{}, len(tokens))
+	unique := tokens[:0]
+	for _, token := range tokens {
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+		unique = append(unique, token)
+	}
+	return unique
+}
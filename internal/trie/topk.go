@@ -0,0 +1,71 @@
+package trie
+
+import (
+	"sort"
+
+	"github.com/alexnthnz/search-autocomplete/pkg/models"
+)
+
+// mergeTopK merges an inserted or rescored suggestion into a top-K list in
+// place. It returns false when the list has to be rebuilt instead, which
+// happens when a full list loses score and a suggestion outside the list may
+// now outrank it.
+func mergeTopK(list []models.Suggestion, suggestion models.Suggestion, k int) ([]models.Suggestion, bool) {
+	for i := range list {
+		if list[i].Term != suggestion.Term {
+			continue
+		}
+		if suggestion.Score < list[i].Score && len(list) == k {
+			return list, false
+		}
+		list = append(list[:i], list[i+1:]...)
+		break
+	}
+
+	pos := sort.Search(len(list), func(i int) bool {
+		return lessSuggestion(suggestion, list[i])
+	})
+	if pos >= k {
+		return list, true
+	}
+
+	list = append(list, models.Suggestion{})
+	copy(list[pos+1:], list[pos:])
+	list[pos] = suggestion
+	if len(list) > k {
+		list = list[:k]
+	}
+	return list, true
+}
+
+// selectTopK sorts candidates and keeps the best k of them
+func selectTopK(candidates []models.Suggestion, k int) []models.Suggestion {
+	sortSuggestions(candidates)
+	if len(candidates) > k {
+		// Copy so the node doesn't pin the larger candidate array
+		candidates = append([]models.Suggestion(nil), candidates[:k]...)
+	}
+	return candidates
+}
+
+// sortSuggestions orders suggestions by score (descending), breaking ties by term
+func sortSuggestions(suggestions []models.Suggestion) {
+	sort.Slice(suggestions, func(i, j int) bool {
+		return lessSuggestion(suggestions[i], suggestions[j])
+	})
+}
+
+// lessSuggestion reports whether a ranks before b
+func lessSuggestion(a, b models.Suggestion) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+	return a.Term < b.Term
+}
+
+// scaleScores multiplies the score of every suggestion in a list by factor
+func scaleScores(list []models.Suggestion, factor float64) {
+	for i := range list {
+		list[i].Score *= factor
+	}
+}
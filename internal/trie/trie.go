@@ -1,7 +1,8 @@
 package trie
 
 import (
-	"sort"
+	"iter"
+	"slices"
 	"strings"
 	"sync"
 
@@ -9,12 +10,16 @@ import (
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 )
 
+// DefaultTopK is the number of best suggestions cached on every node
+const DefaultTopK = 20
+
 // Trie represents the Trie data structure for autocomplete
 type Trie struct {
 	root    *models.TrieNode
 	mutex   sync.RWMutex
 	metrics *metrics.Metrics
 	size    int // Track number of suggestions
+	topK    int // Number of suggestions precomputed per node
 }
 
 // New creates a new Trie instance
@@ -25,6 +30,7 @@ func New() *Trie {
 		},
 		metrics: nil, // No metrics for backward compatibility
 		size:    0,
+		topK:    DefaultTopK,
 	}
 }
 
@@ -36,9 +42,19 @@ func NewWithMetrics(metrics *metrics.Metrics) *Trie {
 		},
 		metrics: metrics,
 		size:    0,
+		topK:    DefaultTopK,
 	}
 }
 
+// NewWithTopK creates a new Trie instance that precomputes k suggestions per node
+func NewWithTopK(k int, metrics *metrics.Metrics) *Trie {
+	t := NewWithMetrics(metrics)
+	if k > 0 {
+		t.topK = k
+	}
+	return t
+}
+
 // Insert adds a suggestion to the Trie
 func (t *Trie) Insert(suggestion models.Suggestion) {
 	t.mutex.Lock()
@@ -50,6 +66,7 @@ func (t *Trie) Insert(suggestion models.Suggestion) {
 	}
 
 	node := t.root
+	path := []*models.TrieNode{node}
 	for _, char := range term {
 		if node.Children[char] == nil {
 			node.Children[char] = &models.TrieNode{
@@ -58,6 +75,7 @@ func (t *Trie) Insert(suggestion models.Suggestion) {
 		}
 		node = node.Children[char]
 		node.Frequency++
+		path = append(path, node)
 	}
 
 	// Check if this is a new suggestion
@@ -83,9 +101,10 @@ func (t *Trie) Insert(suggestion models.Suggestion) {
 	}
 
 	// Sort suggestions by score (descending)
-	sort.Slice(node.Suggestions, func(i, j int) bool {
-		return node.Suggestions[i].Score > node.Suggestions[j].Score
-	})
+	sortSuggestions(node.Suggestions)
+
+	// Propagate the change to the top-K lists along the path
+	t.promotePath(path, suggestion)
 
 	// Record metrics
 	if t.metrics != nil {
@@ -117,25 +136,106 @@ func (t *Trie) Search(prefix string, limit int) []models.Suggestion {
 		node = node.Children[char]
 	}
 
-	// Collect suggestions from this node and its descendants
-	var suggestions []models.Suggestion
-	t.collectSuggestions(node, prefix, &suggestions)
+	suggestions := t.best(node, prefix, limit)
+
+	// Record search metrics with result count
+	if t.metrics != nil {
+		t.metrics.RecordTrieSearch(len(suggestions))
+	}
+
+	return suggestions
+}
 
-	// Sort by score (descending) and limit results
-	sort.Slice(suggestions, func(i, j int) bool {
-		return suggestions[i].Score > suggestions[j].Score
+// SearchFunc finds the best suggestions for a prefix that match accepts
+func (t *Trie) SearchFunc(prefix string, limit int, match func(models.Suggestion) bool) []models.Suggestion {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" || limit <= 0 {
+		return []models.Suggestion{}
+	}
+
+	node := t.root
+	for _, char := range prefix {
+		if node = node.Children[char]; node == nil {
+			return []models.Suggestion{}
+		}
+	}
+	if len(node.TopK) == 0 {
+		return []models.Suggestion{}
+	}
+
+	return bestFirst(node, node.TopK[0], limit, match, func(node *models.TrieNode, term func(models.Suggestion), child func(*models.TrieNode, models.Suggestion)) {
+		if node.IsEndOfWord {
+			for _, suggestion := range node.Suggestions {
+				term(suggestion)
+			}
+		}
+		for _, c := range node.Children {
+			if len(c.TopK) > 0 {
+				child(c, c.TopK[0])
+			}
+		}
 	})
+}
+
+// best returns the top suggestions in the subtree under node
+func (t *Trie) best(node *models.TrieNode, prefix string, limit int) []models.Suggestion {
+	if limit <= t.topK {
+		// Served straight from the precomputed list
+		n := min(limit, len(node.TopK))
+		suggestions := make([]models.Suggestion, n)
+		copy(suggestions, node.TopK[:n])
+		return suggestions
+	}
+
+	// Larger limits than we precompute need a full subtree walk
+	var suggestions []models.Suggestion
+	t.collectSuggestions(node, prefix, &suggestions)
+	sortSuggestions(suggestions)
 
 	if len(suggestions) > limit {
 		suggestions = suggestions[:limit]
 	}
+	return suggestions
+}
 
-	// Record search metrics with result count
-	if t.metrics != nil {
-		t.metrics.RecordTrieSearch(len(suggestions))
+// FuzzySearch finds suggestions whose terms start within maxEdits edits
+// (insertions, deletions, substitutions or adjacent transpositions) of prefix
+func (t *Trie) FuzzySearch(prefix string, maxEdits, limit int) []FuzzyMatch {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	q := newFuzzyQuery(prefix, maxEdits)
+	if len(q.query) == 0 || limit <= 0 {
+		return []FuzzyMatch{}
 	}
 
-	return suggestions
+	matches := make(fuzzyCollector)
+	first := q.firstRow()
+	for char, child := range t.root.Children {
+		t.fuzzyWalk(child, string(char), q, nil, first, 0, char, matches, limit)
+	}
+
+	return matches.results(limit)
+}
+
+// fuzzyWalk extends the edit distance rows by one rune per node
+func (t *Trie) fuzzyWalk(node *models.TrieNode, word string, q *fuzzyQuery, prev2, prev []int, prevChar, char rune, matches fuzzyCollector, limit int) {
+	row := q.next(prev2, prev, prevChar, char)
+
+	matched, descend := q.visit(row)
+	if matched {
+		matches.add(t.best(node, word, limit), q.distance(row))
+	}
+	if !descend {
+		return
+	}
+
+	for next, child := range node.Children {
+		t.fuzzyWalk(child, word+string(next), q, prev, row, char, next, matches, limit)
+	}
 }
 
 // collectSuggestions recursively collects all suggestions from a node and its descendants
@@ -170,6 +270,126 @@ func (t *Trie) countSuggestions(node *models.TrieNode, count *int) {
 	}
 }
 
+// Walk calls fn for every suggestion in the Trie until fn returns false
+func (t *Trie) Walk(fn func(models.Suggestion) bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	walkNode(t.root, fn)
+}
+
+// walkNode visits the suggestions below node and reports whether to continue
+func walkNode(node *models.TrieNode, fn func(models.Suggestion) bool) bool {
+	if node.IsEndOfWord {
+		for _, suggestion := range node.Suggestions {
+			if !fn(suggestion) {
+				return false
+			}
+		}
+	}
+
+	for _, child := range node.Children {
+		if !walkNode(child, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Suggestions iterates over every suggestion whose term starts with prefix,
+// in term order
+func (t *Trie) Suggestions(prefix string) iter.Seq[models.Suggestion] {
+	return t.SuggestionsAfter(prefix, "")
+}
+
+// SuggestionsAfter iterates over every suggestion whose term starts with
+// prefix and sorts after the term after, in term order
+func (t *Trie) SuggestionsAfter(prefix, after string) iter.Seq[models.Suggestion] {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	after = strings.ToLower(strings.TrimSpace(after))
+
+	return func(yield func(models.Suggestion) bool) {
+		t.mutex.RLock()
+		defer t.mutex.RUnlock()
+
+		node := t.root
+		for _, char := range prefix {
+			if node = node.Children[char]; node == nil {
+				return
+			}
+		}
+		walkNodeAfter(node, prefix, after, yield)
+	}
+}
+
+// walkNodeAfter is walkNodeOrdered skipping the terms up to after. key is
+// the term node spells.
+func walkNodeAfter(node *models.TrieNode, key, after string, fn func(models.Suggestion) bool) bool {
+	if key > after {
+		return walkNodeOrdered(node, fn)
+	}
+	if !strings.HasPrefix(after, key) {
+		return true // Every term below sorts before after
+	}
+
+	chars := make([]rune, 0, len(node.Children))
+	for char := range node.Children {
+		chars = append(chars, char)
+	}
+	slices.Sort(chars)
+
+	for _, char := range chars {
+		if !walkNodeAfter(node.Children[char], key+string(char), after, fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// walkNodeOrdered is walkNode visiting children in rune order, which is
+// also the byte order of the terms they spell
+func walkNodeOrdered(node *models.TrieNode, fn func(models.Suggestion) bool) bool {
+	if node.IsEndOfWord {
+		for _, suggestion := range node.Suggestions {
+			if !fn(suggestion) {
+				return false
+			}
+		}
+	}
+
+	chars := make([]rune, 0, len(node.Children))
+	for char := range node.Children {
+		chars = append(chars, char)
+	}
+	slices.Sort(chars)
+
+	for _, char := range chars {
+		if !walkNodeOrdered(node.Children[char], fn) {
+			return false
+		}
+	}
+	return true
+}
+
+// Get returns the suggestion stored for exactly term
+func (t *Trie) Get(term string) (models.Suggestion, bool) {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+
+	term = strings.ToLower(strings.TrimSpace(term))
+	node := t.root
+	for _, char := range term {
+		if node = node.Children[char]; node == nil {
+			return models.Suggestion{}, false
+		}
+	}
+
+	if !node.IsEndOfWord || len(node.Suggestions) == 0 {
+		return models.Suggestion{}, false
+	}
+	return node.Suggestions[0], true
+}
+
 // Delete removes a suggestion from the Trie
 func (t *Trie) Delete(term string) bool {
 	t.mutex.Lock()
@@ -180,7 +400,8 @@ func (t *Trie) Delete(term string) bool {
 		return false
 	}
 
-	deleted := t.deleteHelper(t.root, term, 0)
+	// Walk by rune, matching how Insert builds the path
+	deleted, _ := t.deleteHelper(t.root, []rune(term), 0)
 
 	if deleted {
 		t.size--
@@ -193,68 +414,136 @@ func (t *Trie) Delete(term string) bool {
 	return deleted
 }
 
-// deleteHelper is a recursive helper for deletion
-func (t *Trie) deleteHelper(node *models.TrieNode, term string, index int) bool {
+// deleteHelper is a recursive helper for deletion. It reports whether the
+// term was removed and whether the node itself can be pruned.
+func (t *Trie) deleteHelper(node *models.TrieNode, term []rune, index int) (bool, bool) {
 	if index == len(term) {
 		if !node.IsEndOfWord {
-			return false
+			return false, false
 		}
 
 		node.IsEndOfWord = false
 		node.Suggestions = []models.Suggestion{}
+		t.refreshTopK(node)
 
 		// If node has no children, it can be deleted
-		return len(node.Children) == 0
+		return true, len(node.Children) == 0
 	}
 
-	char := rune(term[index])
+	char := term[index]
 	child, exists := node.Children[char]
 	if !exists {
-		return false
+		return false, false
 	}
 
-	shouldDeleteChild := t.deleteHelper(child, term, index+1)
+	deleted, shouldDeleteChild := t.deleteHelper(child, term, index+1)
+	if !deleted {
+		return false, false
+	}
 
 	if shouldDeleteChild {
 		delete(node.Children, char)
-		// Return true if current node has no children and is not end of another word
-		return len(node.Children) == 0 && !node.IsEndOfWord
 	}
+	t.refreshTopK(node)
 
-	return false
+	// Prune current node if it has no children and is not end of another word
+	return true, len(node.Children) == 0 && !node.IsEndOfWord
 }
 
-// UpdateFrequency updates the frequency of a term in the trie
-func (t *Trie) UpdateFrequency(term string, frequency int64) {
+// UpdateFrequency updates the frequency of a term in the trie and sets its score
+func (t *Trie) UpdateFrequency(term string, frequency int64, score float64) {
+	t.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency = frequency
+		suggestion.Score = score
+	})
+}
+
+// AddFrequency adds delta to a term's frequency and score to its score in a
+// single step, so concurrent increments are never lost. It returns the updated
+// suggestion and false if the term doesn't exist.
+func (t *Trie) AddFrequency(term string, delta int64, score float64) (models.Suggestion, bool) {
+	return t.rescore(term, func(suggestion *models.Suggestion) {
+		suggestion.Frequency += delta
+		suggestion.Score += score
+	})
+}
+
+// rescore applies update to a stored suggestion and re-ranks it
+func (t *Trie) rescore(term string, update func(*models.Suggestion)) (models.Suggestion, bool) {
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
 	term = strings.ToLower(strings.TrimSpace(term))
 	if term == "" {
-		return
+		return models.Suggestion{}, false
 	}
 
 	node := t.root
+	path := []*models.TrieNode{node}
 	for _, char := range term {
 		if node.Children[char] == nil {
-			return // Term doesn't exist
+			return models.Suggestion{}, false // Term doesn't exist
 		}
 		node = node.Children[char]
+		path = append(path, node)
+	}
+	if !node.IsEndOfWord {
+		return models.Suggestion{}, false
 	}
 
-	if node.IsEndOfWord {
-		for i := range node.Suggestions {
-			if strings.ToLower(node.Suggestions[i].Term) == term {
-				node.Suggestions[i].Frequency = frequency
-				// Recalculate score based on frequency
-				node.Suggestions[i].Score = float64(frequency) * 1.0 // Simple scoring
-				break
-			}
+	for i := range node.Suggestions {
+		if strings.ToLower(node.Suggestions[i].Term) != term {
+			continue
 		}
+		update(&node.Suggestions[i])
+		updated := node.Suggestions[i]
+		t.promotePath(path, updated)
+		sortSuggestions(node.Suggestions)
+		return updated, true
+	}
+	return models.Suggestion{}, false
+}
+
+// Decay multiplies every score in the trie by factor
+func (t *Trie) Decay(factor float64) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
 
-		// Re-sort suggestions
-		sort.Slice(node.Suggestions, func(i, j int) bool {
-			return node.Suggestions[i].Score > node.Suggestions[j].Score
-		})
+	decayNode(t.root, factor)
+}
+
+// decayNode scales the scores stored at and below node
+func decayNode(node *models.TrieNode, factor float64) {
+	scaleScores(node.Suggestions, factor)
+	scaleScores(node.TopK, factor)
+	for _, child := range node.Children {
+		decayNode(child, factor)
 	}
 }
+
+// promotePath applies an inserted or rescored suggestion to the top-K lists
+// from the deepest node up to the root
+func (t *Trie) promotePath(path []*models.TrieNode, suggestion models.Suggestion) {
+	for i := len(path) - 1; i >= 0; i-- {
+		list, ok := mergeTopK(path[i].TopK, suggestion, t.topK)
+		if !ok {
+			t.refreshTopK(path[i])
+			continue
+		}
+		path[i].TopK = list
+	}
+}
+
+// refreshTopK rebuilds a node's top-K list from its own suggestions and the
+// top-K lists of its children, which must already be up to date
+func (t *Trie) refreshTopK(node *models.TrieNode) {
+	var candidates []models.Suggestion
+	if node.IsEndOfWord {
+		candidates = append(candidates, node.Suggestions...)
+	}
+	for _, child := range node.Children {
+		candidates = append(candidates, child.TopK...)
+	}
+
+	node.TopK = selectTopK(candidates, t.topK)
+}
@@ -1,11 +1,17 @@
 package trie
 
 import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTrie_Insert_And_Search(t *testing.T) {
@@ -91,6 +97,36 @@ func TestTrie_Delete(t *testing.T) {
 	assert.False(t, deleted, "Delete should return false for non-existent term")
 }
 
+func TestIndex_DeleteUnicode(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+
+			words := []string{"cafe", "café", "cafés", "東京", "東京タワー", "東北", "москва", "моск", "😀 smile"}
+			for _, word := range words {
+				index.Insert(models.Suggestion{Term: word, Frequency: 10, Score: 10})
+			}
+
+			// Multi-byte runes share leading bytes, so byte-wise walks go astray
+			assert.True(t, index.Delete("café"))
+			assert.Equal(t, []string{"cafe", "cafés"}, terms(index.Search("caf", 10)))
+			assert.False(t, index.Delete("café"), "already deleted")
+
+			assert.True(t, index.Delete("東京"))
+			assert.Equal(t, []string{"東京タワー"}, terms(index.Search("東京", 10)))
+			assert.Equal(t, []string{"東京タワー", "東北"}, terms(index.Search("東", 10)))
+
+			assert.True(t, index.Delete("МОСКВА"), "deletes are case-insensitive")
+			assert.Equal(t, []string{"моск"}, terms(index.Search("мос", 10)))
+
+			assert.True(t, index.Delete("😀 smile"))
+			assert.False(t, index.Delete("東"), "prefixes are not terms")
+			assert.Equal(t, len(words)-4, index.GetSuggestionsCount())
+		})
+	}
+}
+
 func TestTrie_UpdateFrequency(t *testing.T) {
 	trie := New()
 
@@ -104,7 +140,7 @@ func TestTrie_UpdateFrequency(t *testing.T) {
 	trie.Insert(suggestion)
 
 	// Update frequency
-	trie.UpdateFrequency("test", 500)
+	trie.UpdateFrequency("test", 500, 500)
 
 	// Verify updated frequency
 	results := trie.Search("test", 10)
@@ -113,6 +149,127 @@ func TestTrie_UpdateFrequency(t *testing.T) {
 	assert.Equal(t, float64(500), results[0].Score, "Score should be updated based on frequency")
 }
 
+func TestIndex_Decay(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+			for term, score := range map[string]float64{"apple": 100, "application": 80, "amazon": 90} {
+				index.Insert(models.Suggestion{Term: term, Frequency: int64(score), Score: score})
+			}
+
+			index.Decay(0.5)
+
+			results := index.Search("a", 10)
+			assert.Equal(t, []string{"apple", "amazon", "application"}, terms(results), "order is kept")
+			assert.Equal(t, 50.0, results[0].Score)
+			assert.Equal(t, int64(100), results[0].Frequency, "raw counts are not decayed")
+
+			apple, _ := index.Get("apple")
+			assert.Equal(t, 50.0, apple.Score)
+
+			// Later updates compete with the decayed scores
+			index.UpdateFrequency("application", 60, 60)
+			assert.Equal(t, []string{"application", "apple", "amazon"}, terms(index.Search("a", 10)), "top-K lists were decayed too")
+		})
+	}
+
+	tokens := NewTokenIndex()
+	tokens.Insert(models.Suggestion{Term: "machine learning", Score: 100})
+	tokens.Decay(0.25)
+	assert.Equal(t, 25.0, tokens.Search("lea", 10)[0].Score)
+}
+
+func TestIndex_AddFrequency(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+			index.Insert(models.Suggestion{Term: "popular", Frequency: 10000, Score: 10000})
+			index.Insert(models.Suggestion{Term: "pop", Frequency: 9990, Score: 9990})
+
+			// A quiet interval adds to the stored frequency instead of replacing it
+			updated, ok := index.AddFrequency("Popular", 3, 3)
+			require.True(t, ok)
+			assert.Equal(t, int64(10003), updated.Frequency)
+			assert.Equal(t, 10003.0, updated.Score)
+
+			// Old hits count fully towards the frequency but less towards the score
+			updated, _ = index.AddFrequency("popular", 2, 0.5)
+			assert.Equal(t, int64(10005), updated.Frequency)
+			assert.Equal(t, 10003.5, updated.Score)
+
+			_, ok = index.AddFrequency("missing", 3, 3)
+			assert.False(t, ok)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					index.AddFrequency("pop", 1, 1)
+				}()
+			}
+			wg.Wait()
+
+			pop, _ := index.Get("pop")
+			assert.Equal(t, int64(10040), pop.Frequency, "concurrent increments are not lost")
+			assert.Equal(t, []string{"pop", "popular"}, terms(index.Search("po", 10)), "top-K lists follow the new scores")
+		})
+	}
+}
+
+func TestIndex_Suggestions(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+			for i, term := range []string{"banana", "app", "apple", "Application", "amazon", "ápice", "apt"} {
+				index.Insert(models.Suggestion{Term: term, Score: float64(i)})
+			}
+
+			var all []string
+			for suggestion := range index.Suggestions("") {
+				all = append(all, suggestion.Term)
+			}
+			assert.Equal(t, []string{"amazon", "app", "apple", "Application", "apt", "banana", "ápice"}, all, "every term in byte order of its lower case form")
+
+			var matched []string
+			for suggestion := range index.Suggestions("APP") {
+				matched = append(matched, suggestion.Term)
+			}
+			assert.Equal(t, []string{"app", "apple", "Application"}, matched)
+
+			// Stopping early releases the lock
+			for range index.Suggestions("a") {
+				break
+			}
+			index.Insert(models.Suggestion{Term: "apricot"})
+
+			for range index.Suggestions("kiwi") {
+				t.Fatal("no terms start with kiwi")
+			}
+
+			// Iterations resume after the last term seen
+			var resumed []string
+			for suggestion := range index.SuggestionsAfter("", "APPLE") {
+				resumed = append(resumed, suggestion.Term)
+			}
+			assert.Equal(t, []string{"Application", "apricot", "apt", "banana", "ápice"}, resumed)
+
+			resumed = nil
+			for suggestion := range index.SuggestionsAfter("ap", "apa") {
+				resumed = append(resumed, suggestion.Term)
+			}
+			assert.Equal(t, []string{"app", "apple", "Application", "apricot", "apt"}, resumed)
+
+			for range index.SuggestionsAfter("app", "apt") {
+				t.Fatal("every term starting with app sorts before apt")
+			}
+		})
+	}
+}
+
 func TestTrie_GetSuggestionsCount(t *testing.T) {
 	trie := New()
 
@@ -157,6 +314,396 @@ func TestTrie_CaseInsensitive(t *testing.T) {
 	}
 }
 
+func TestTrie_TopK(t *testing.T) {
+	trie := NewWithTopK(3, nil)
+
+	for i, term := range []string{"car", "card", "care", "career", "cart", "cat"} {
+		trie.Insert(models.Suggestion{
+			Term:      term,
+			Frequency: int64(i + 1),
+			Score:     float64(i + 1),
+			UpdatedAt: time.Now(),
+		})
+	}
+
+	// Limits within K come from the precomputed list
+	results := trie.Search("ca", 3)
+	assert.Equal(t, []string{"cat", "cart", "career"}, terms(results))
+
+	// Limits above K fall back to walking the subtree
+	results = trie.Search("car", 10)
+	assert.Equal(t, []string{"cart", "career", "care", "card", "car"}, terms(results))
+
+	// Raising a score moves the term into every ancestor's list
+	trie.UpdateFrequency("car", 100, 100)
+	assert.Equal(t, []string{"car", "cat", "cart"}, terms(trie.Search("c", 3)))
+
+	// Lowering a score lets terms from deeper in the subtree back in
+	trie.UpdateFrequency("car", 0, 0)
+	assert.Equal(t, []string{"cat", "cart", "career"}, terms(trie.Search("c", 3)))
+
+	// Deleting a term removes it from every ancestor's list
+	assert.True(t, trie.Delete("cat"))
+	assert.Equal(t, []string{"cart", "career", "care"}, terms(trie.Search("c", 3)))
+
+	// Deleting a prefix of other terms keeps the longer terms intact
+	assert.True(t, trie.Delete("car"))
+	assert.Equal(t, []string{"cart", "career", "care"}, terms(trie.Search("car", 3)))
+	assert.Equal(t, 4, trie.GetSuggestionsCount())
+}
+
+func TestTrie_TopKMatchesFullScan(t *testing.T) {
+	trie := NewWithTopK(5, nil)
+	rng := rand.New(rand.NewSource(42))
+	words := []string{"a", "ab", "abc", "abd", "abcd", "b", "ba", "bab", "abba", "bb"}
+
+	for i := 0; i < 2000; i++ {
+		word := words[rng.Intn(len(words))]
+		switch rng.Intn(3) {
+		case 0:
+			score := rng.Intn(100)
+			trie.Insert(models.Suggestion{Term: word, Frequency: int64(score), Score: float64(score)})
+		case 1:
+			frequency := int64(rng.Intn(100))
+			trie.UpdateFrequency(word, frequency, float64(frequency))
+		case 2:
+			trie.Delete(word)
+		}
+
+		for _, prefix := range []string{"a", "ab", "b"} {
+			// A limit above K forces the full subtree walk
+			expected := trie.Search(prefix, 100)
+			if len(expected) > 5 {
+				expected = expected[:5]
+			}
+			assert.Equal(t, expected, trie.Search(prefix, 5), "prefix %q after step %d", prefix, i)
+		}
+	}
+}
+
+func TestRadixTree_MatchesTrie(t *testing.T) {
+	trie := NewWithTopK(5, nil)
+	radix := NewRadixWithTopK(5, nil)
+	rng := rand.New(rand.NewSource(7))
+	words := []string{"a", "ab", "abc", "abd", "abcd", "b", "ba", "bab", "abba", "bb", "café", "cafè", "東京", "東京都"}
+
+	for i := 0; i < 2000; i++ {
+		word := words[rng.Intn(len(words))]
+		switch rng.Intn(3) {
+		case 0:
+			score := rng.Intn(100)
+			suggestion := models.Suggestion{Term: word, Frequency: int64(score), Score: float64(score)}
+			trie.Insert(suggestion)
+			radix.Insert(suggestion)
+		case 1:
+			frequency := int64(rng.Intn(100))
+			trie.UpdateFrequency(word, frequency, float64(frequency))
+			radix.UpdateFrequency(word, frequency, float64(frequency))
+		case 2:
+			assert.Equal(t, trie.Delete(word), radix.Delete(word), "delete %q at step %d", word, i)
+		}
+
+		for _, prefix := range []string{"a", "ab", "abc", "b", "caf", "café", "東"} {
+			assert.Equal(t, trie.Search(prefix, 5), radix.Search(prefix, 5), "prefix %q after step %d", prefix, i)
+			assert.Equal(t, trie.Search(prefix, 50), radix.Search(prefix, 50), "prefix %q after step %d", prefix, i)
+		}
+		assert.Equal(t, trie.GetSuggestionsCount(), radix.GetSuggestionsCount())
+	}
+}
+
+func TestRadixTree_EdgeSplitAndMerge(t *testing.T) {
+	radix := NewRadix()
+
+	radix.Insert(models.Suggestion{Term: "romane", Score: 1})
+	radix.Insert(models.Suggestion{Term: "romanus", Score: 2})
+	radix.Insert(models.Suggestion{Term: "roman", Score: 3})
+
+	assert.Equal(t, []string{"roman", "romanus", "romane"}, terms(radix.Search("rom", 10)))
+	assert.Equal(t, []string{"romanus"}, terms(radix.Search("romanu", 10)))
+
+	// Removing the branching term merges the remaining edges back together
+	assert.True(t, radix.Delete("roman"))
+	assert.True(t, radix.Delete("romane"))
+	assert.Len(t, radix.root.children, 1)
+	assert.Equal(t, "romanus", radix.root.children[0].label)
+	assert.Equal(t, []string{"romanus"}, terms(radix.Search("r", 10)))
+
+	assert.False(t, radix.Delete("roma"))
+	assert.Equal(t, 1, radix.GetSuggestionsCount())
+}
+
+func TestTokenIndex_MatchesInnerWords(t *testing.T) {
+	index := NewTokenIndexWithTopK(3)
+	for term, score := range map[string]float64{
+		"python programming": 50,
+		"programming":        40,
+		"machine learning":   30,
+		"learning machines":  20,
+		"deep-learning":      10,
+	} {
+		index.Insert(models.Suggestion{Term: term, Score: score})
+	}
+
+	assert.Equal(t, []string{"python programming", "programming"}, terms(index.Search("pro", 10)))
+	assert.Equal(t, []string{"machine learning", "learning machines", "deep-learning"}, terms(index.Search("lea", 3)))
+
+	// Every query token must prefix a word, in order
+	assert.Equal(t, []string{"machine learning"}, terms(index.Search("mach lea", 10)))
+	assert.Equal(t, []string{"learning machines"}, terms(index.Search("lea mach", 10)))
+	assert.Empty(t, index.Search("mach pro", 10))
+
+	index.UpdateFrequency("deep-learning", 100, 100)
+	assert.Equal(t, "deep-learning", index.Search("learn", 1)[0].Term)
+
+	assert.True(t, index.Delete("Python Programming"))
+	assert.False(t, index.Delete("python programming"))
+	assert.Equal(t, []string{"programming"}, terms(index.Search("pro", 10)))
+	assert.Empty(t, index.Search("pyth", 10))
+
+	// Repeated words are only listed once
+	index.Insert(models.Suggestion{Term: "tik tok tik", Score: 5})
+	assert.Equal(t, []string{"tik tok tik"}, terms(index.Search("t", 10)))
+	assert.Equal(t, []string{"tik tok tik"}, terms(index.Search("t", 100)))
+}
+
+func TestIndex_SearchFunc(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+			var all []models.Suggestion
+			for i := 0; i < 1000; i++ {
+				category := "tech"
+				if i%10 == 0 {
+					category = "fruit"
+				}
+				// Pairs of terms tie on score
+				suggestion := models.Suggestion{Term: fmt.Sprintf("c%03d", i), Score: float64(1000 - i/2), Category: category}
+				index.Insert(suggestion)
+				all = append(all, suggestion)
+			}
+
+			calls := 0
+			fruit := func(suggestion models.Suggestion) bool {
+				calls++
+				return suggestion.Category == "fruit"
+			}
+			expected := func(prefix string, limit int) []string {
+				var matches []models.Suggestion
+				for _, suggestion := range all {
+					if strings.HasPrefix(suggestion.Term, prefix) && suggestion.Category == "fruit" {
+						matches = append(matches, suggestion)
+					}
+				}
+				sortSuggestions(matches)
+				return terms(matches[:min(limit, len(matches))])
+			}
+
+			for _, tt := range []struct {
+				prefix string
+				limit  int
+			}{
+				{"c", 5},
+				{"c", 100},
+				{"c1", 3},
+				{"c99", 10},
+			} {
+				assert.Equal(t, expected(tt.prefix, tt.limit), terms(index.SearchFunc(tt.prefix, tt.limit, fruit)), "%q limit %d", tt.prefix, tt.limit)
+			}
+
+			// The walk stops once the best matches are found, well before
+			// every term under the prefix is checked
+			calls = 0
+			require.Len(t, index.SearchFunc("c", 5, fruit), 5)
+			assert.LessOrEqual(t, calls, 50)
+
+			assert.Empty(t, index.SearchFunc("d", 5, fruit))
+			assert.Empty(t, index.SearchFunc("c", 5, func(models.Suggestion) bool { return false }))
+		})
+	}
+}
+
+func TestTokenIndex_SearchWalksBestFirst(t *testing.T) {
+	index := NewTokenIndexWithTopK(2)
+	var all []models.Suggestion
+	for i := 0; i < 200; i++ {
+		term := fmt.Sprintf("learn %03d", i)
+		if i%7 == 0 {
+			term = fmt.Sprintf("learn machine %03d", i)
+		}
+		// Pairs of terms tie on score
+		suggestion := models.Suggestion{Term: term, Score: float64(1000 - i/2)}
+		index.Insert(suggestion)
+		all = append(all, suggestion)
+	}
+
+	expected := func(query string, limit int) []string {
+		var matches []models.Suggestion
+		for _, suggestion := range all {
+			if matched, _ := MatchTokens(suggestion.Term, query); matched {
+				matches = append(matches, suggestion)
+			}
+		}
+		sortSuggestions(matches)
+		return terms(matches[:min(limit, len(matches))])
+	}
+
+	for _, tt := range []struct {
+		query string
+		limit int
+	}{
+		{"lea mach", 100},
+		{"lea mach", 5},
+		{"learn machine", 3},
+		{"l", 150},
+		{"mac", 10},
+	} {
+		assert.Equal(t, expected(tt.query, tt.limit), terms(index.Search(tt.query, tt.limit)), "%q limit %d", tt.query, tt.limit)
+	}
+	assert.Empty(t, index.Search("mach lea", 10))
+}
+
+func TestMatchTokens(t *testing.T) {
+	tests := []struct {
+		term, query      string
+		matched, leading bool
+	}{
+		{"machine learning", "mach", true, true},
+		{"machine learning", "mach lea", true, true},
+		{"machine learning", "lea", true, false},
+		{"machine learning", "lea mach", false, false},
+		{"New York", "new y", true, true},
+		{"café crème", "CRÈ", true, false},
+		{"python", "java", false, false},
+		{"python", "", false, false},
+	}
+
+	for _, tt := range tests {
+		matched, leading := MatchTokens(tt.term, tt.query)
+		assert.Equal(t, tt.matched, matched, "%q / %q", tt.term, tt.query)
+		assert.Equal(t, tt.leading, leading, "%q / %q", tt.term, tt.query)
+	}
+}
+
+func TestIndex_FuzzySearch(t *testing.T) {
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		t.Run(indexType, func(t *testing.T) {
+			index, err := NewIndex(indexType, nil)
+			require.NoError(t, err)
+			for term, score := range map[string]float64{"apple": 100, "application": 80, "android": 70, "amazon": 90, "café": 10} {
+				index.Insert(models.Suggestion{Term: term, Score: score})
+			}
+
+			// Transpositions cost a single edit
+			matches := index.FuzzySearch("aplpe", 1, 10)
+			require.Len(t, matches, 1)
+			assert.Equal(t, "apple", matches[0].Suggestion.Term)
+			assert.Equal(t, 1, matches[0].Distance)
+
+			matches = index.FuzzySearch("andriod", 1, 10)
+			require.Len(t, matches, 1)
+			assert.Equal(t, "android", matches[0].Suggestion.Term)
+
+			// The typed text only has to be close to a prefix of the term
+			matches = index.FuzzySearch("appl", 1, 10)
+			assert.Equal(t, 0, matches[0].Distance)
+			assert.ElementsMatch(t, []string{"apple", "application"}, fuzzyTerms(matches[:2]))
+
+			// The edit budget is respected
+			assert.Empty(t, index.FuzzySearch("axxle", 1, 10))
+			assert.Equal(t, []string{"apple"}, fuzzyTerms(index.FuzzySearch("axxle", 2, 10)))
+			assert.Equal(t, []string{"café"}, fuzzyTerms(index.FuzzySearch("cafe", 1, 10)))
+		})
+	}
+}
+
+func TestIndex_FuzzySearchMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	letters := []rune("abcé")
+	var words []string
+	for i := 0; i < 300; i++ {
+		word := make([]rune, 1+rng.Intn(6))
+		for j := range word {
+			word[j] = letters[rng.Intn(len(letters))]
+		}
+		words = append(words, string(word))
+	}
+
+	for _, indexType := range []string{IndexTypeTrie, IndexTypeRadix} {
+		index, err := NewIndex(indexType, nil)
+		require.NoError(t, err)
+		for _, word := range words {
+			index.Insert(models.Suggestion{Term: word, Score: 1})
+		}
+
+		for _, query := range []string{"ab", "bca", "éab", "cabb", "aaaa"} {
+			for maxEdits := 0; maxEdits <= 2; maxEdits++ {
+				expected := make(map[string]int)
+				for _, word := range words {
+					if d := prefixDistance(query, word); d <= maxEdits {
+						expected[word] = d
+					}
+				}
+
+				actual := make(map[string]int)
+				for _, match := range index.FuzzySearch(query, maxEdits, len(words)) {
+					actual[match.Suggestion.Term] = match.Distance
+				}
+				assert.Equal(t, expected, actual, "%s: %q within %d", indexType, query, maxEdits)
+			}
+		}
+	}
+}
+
+// prefixDistance is the smallest optimal string alignment distance between
+// query and any prefix of term
+func prefixDistance(query, term string) int {
+	q, w := []rune(query), []rune(term)
+	d := make([][]int, len(w)+1)
+	for i := range d {
+		d[i] = make([]int, len(q)+1)
+		for j := range d[i] {
+			switch {
+			case i == 0:
+				d[i][j] = j
+			case j == 0:
+				d[i][j] = i
+			default:
+				cost := 1
+				if w[i-1] == q[j-1] {
+					cost = 0
+				}
+				d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+				if i > 1 && j > 1 && w[i-1] == q[j-2] && w[i-2] == q[j-1] {
+					d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+				}
+			}
+		}
+	}
+
+	best := d[0][len(q)]
+	for i := range d {
+		best = min(best, d[i][len(q)])
+	}
+	return best
+}
+
+func fuzzyTerms(matches []FuzzyMatch) []string {
+	result := make([]string, len(matches))
+	for i, match := range matches {
+		result[i] = match.Suggestion.Term
+	}
+	return result
+}
+
+func terms(suggestions []models.Suggestion) []string {
+	result := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		result[i] = suggestion.Term
+	}
+	return result
+}
+
 func BenchmarkTrie_Insert(b *testing.B) {
 	trie := New()
 	suggestion := models.Suggestion{
@@ -192,3 +739,111 @@ func BenchmarkTrie_Search(b *testing.B) {
 		trie.Search("test", 10)
 	}
 }
+
+func BenchmarkTrie_SearchShortPrefix(b *testing.B) {
+	trie := New()
+
+	// Short prefixes sit above most of the index
+	for i := 0; i < 10000; i++ {
+		trie.Insert(models.Suggestion{
+			Term:      fmt.Sprintf("a%d", i),
+			Frequency: int64(i),
+			Score:     float64(i),
+			UpdatedAt: time.Now(),
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		trie.Search("a", 10)
+	}
+}
+
+var benchmarkIndexes = []struct {
+	name string
+	new  func() Index
+}{
+	{IndexTypeTrie, func() Index { return New() }},
+	{IndexTypeRadix, func() Index { return NewRadix() }},
+}
+
+// benchmarkCorpus builds word-like terms that share prefixes the way real queries do
+func benchmarkCorpus(n int) []models.Suggestion {
+	rng := rand.New(rand.NewSource(1))
+	syllables := []string{"ap", "pli", "ca", "tion", "pro", "gram", "ming", "mach", "ine", "learn", "ing", "da", "ta", "base", "web", "dev", "el", "op", "ment"}
+
+	corpus := make([]models.Suggestion, n)
+	for i := range corpus {
+		term := ""
+		for j := 0; j < 2+rng.Intn(4); j++ {
+			term += syllables[rng.Intn(len(syllables))]
+		}
+		corpus[i] = models.Suggestion{
+			Term:      fmt.Sprintf("%s %d", term, i),
+			Frequency: int64(rng.Intn(10000)),
+			Score:     float64(rng.Intn(10000)),
+			UpdatedAt: time.Now(),
+		}
+	}
+	return corpus
+}
+
+func BenchmarkIndex_Memory(b *testing.B) {
+	corpus := benchmarkCorpus(50000)
+
+	for _, impl := range benchmarkIndexes {
+		b.Run(impl.name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+
+				index := impl.new()
+				for _, suggestion := range corpus {
+					index.Insert(suggestion)
+				}
+
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				runtime.KeepAlive(index)
+
+				b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(len(corpus)), "bytes/term")
+			}
+		})
+	}
+}
+
+func BenchmarkIndex_Insert(b *testing.B) {
+	corpus := benchmarkCorpus(50000)
+
+	for _, impl := range benchmarkIndexes {
+		b.Run(impl.name, func(b *testing.B) {
+			index := impl.new()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				index.Insert(corpus[i%len(corpus)])
+			}
+		})
+	}
+}
+
+func BenchmarkIndex_Search(b *testing.B) {
+	corpus := benchmarkCorpus(50000)
+	prefixes := []string{"a", "ap", "pro", "progra", "machine", "learning", "z"}
+
+	for _, impl := range benchmarkIndexes {
+		b.Run(impl.name, func(b *testing.B) {
+			index := impl.new()
+			for _, suggestion := range corpus {
+				index.Insert(suggestion)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				index.Search(prefixes[i%len(prefixes)], 10)
+			}
+		})
+	}
+}
@@ -18,6 +18,7 @@ const (
 	ErrCodeCacheFailure ErrorCode = "CACHE_FAILURE"
 	ErrCodeTrieFailure  ErrorCode = "TRIE_FAILURE"
 	ErrCodeTimeout      ErrorCode = "TIMEOUT"
+	ErrCodeConflict     ErrorCode = "CONFLICT"
 )
 
 // APIError represents a structured API error
@@ -119,6 +120,17 @@ func NewTimeoutError(operation string) *APIError {
 	}
 }
 
+// NewConflictError creates an error for a request that clashes with the
+// current state
+func NewConflictError(message, details string) *APIError {
+	return &APIError{
+		Code:       ErrCodeConflict,
+		Message:    message,
+		Details:    details,
+		HTTPStatus: http.StatusConflict,
+	}
+}
+
 // WrapError wraps an existing error with additional context
 func WrapError(err error, code ErrorCode, message string) *APIError {
 	return &APIError{
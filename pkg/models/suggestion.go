@@ -4,11 +4,34 @@ import "time"
 
 // Suggestion represents an autocomplete suggestion
 type Suggestion struct {
-	Term      string    `json:"term"`
-	Frequency int64     `json:"frequency"`
-	Score     float64   `json:"score"`
-	Category  string    `json:"category,omitempty"`
-	UpdatedAt time.Time `json:"updated_at"`
+	Term      string            `json:"term"`
+	Frequency int64             `json:"frequency"`
+	Score     float64           `json:"score"`
+	Category  string            `json:"category,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+	Metadata  map[string]string `json:"metadata,omitempty"` // Free-form attributes, never modified once stored
+}
+
+// RankedSuggestion is a suggestion with the score it was ranked by for one
+// query. The stored Score is left untouched.
+type RankedSuggestion struct {
+	Suggestion
+	FinalScore  float64      `json:"final_score"`
+	Explanation *Explanation `json:"explanation,omitempty"` // Only when the request asks to explain
+}
+
+// Explanation breaks a final score down into the ranking stages that built it
+type Explanation struct {
+	BaseScore    float64       `json:"base_score"`              // Stored score before ranking
+	EditDistance int           `json:"edit_distance,omitempty"` // Edits needed by a fuzzy match
+	Steps        []RankingStep `json:"steps"`
+}
+
+// RankingStep is the effect of one ranking stage on a score
+type RankingStep struct {
+	Stage      string  `json:"stage"`
+	Multiplier float64 `json:"multiplier,omitempty"` // Score after / score before, omitted when starting from zero
+	Score      float64 `json:"score"`                // Score after the stage
 }
 
 // AutocompleteRequest represents a request for autocomplete suggestions
@@ -17,14 +40,19 @@ type AutocompleteRequest struct {
 	Limit     int    `json:"limit,omitempty"`
 	UserID    string `json:"user_id,omitempty"`
 	SessionID string `json:"session_id,omitempty"`
+	Fuzzy     *bool  `json:"fuzzy,omitempty"` // Overrides the server's fuzzy setting when set
+	Explain   bool   `json:"explain,omitempty"`
+	Category  string `json:"category,omitempty"` // Only suggest terms in this category
+	Locale    string `json:"locale,omitempty"`   // Only suggest terms for this locale, or for any
 }
 
 // AutocompleteResponse represents the response containing suggestions
 type AutocompleteResponse struct {
-	Query       string       `json:"query"`
-	Suggestions []Suggestion `json:"suggestions"`
-	Latency     string       `json:"latency"`
-	Source      string       `json:"source"` // "cache" or "index"
+	Query       string             `json:"query"`
+	Suggestions []RankedSuggestion `json:"suggestions"`
+	Limit       int                `json:"limit"` // Limit applied after the server maximum
+	Latency     string             `json:"latency"`
+	Source      string             `json:"source"` // "cache" or "index"
 }
 
 // SearchLog represents a search query log entry
@@ -36,10 +64,30 @@ type SearchLog struct {
 	IPAddress string    `json:"ip_address,omitempty"`
 }
 
+// SelectionLog records a suggestion picked from an autocomplete response
+type SelectionLog struct {
+	Query     string    `json:"query" binding:"required"`
+	Term      string    `json:"term" binding:"required"`
+	Position  int       `json:"position"` // 1-based position in the response, 0 if unknown
+	UserID    string    `json:"user_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TrendingQuery is a query searched for much more often than usual
+type TrendingQuery struct {
+	Query string    `json:"query"`
+	Score float64   `json:"score"` // Recent rate over the usual rate
+	Count int64     `json:"count"` // Searches within the trend window
+	Boost float64   `json:"boost"` // Ranking boost strength, from 0 to 1
+	Since time.Time `json:"since"`
+}
+
 // TrieNode represents a node in the Trie structure
 type TrieNode struct {
 	Children    map[rune]*TrieNode `json:"children"`
 	IsEndOfWord bool               `json:"is_end_of_word"`
 	Suggestions []Suggestion       `json:"suggestions"`
 	Frequency   int64              `json:"frequency"`
+	TopK        []Suggestion       `json:"top_k"` // Best suggestions in this subtree, ordered by score
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"strings"
+	"unicode/utf8"
 )
 
 // FuzzyMatcher provides fuzzy string matching capabilities
@@ -20,6 +21,17 @@ func NewFuzzyMatcher(threshold int) *FuzzyMatcher {
 	}
 }
 
+// MaxEdits returns how many edits a fuzzy search for query may use: one per
+// three characters typed, capped at the threshold, so a couple of keystrokes
+// don't match half the index
+func (f *FuzzyMatcher) MaxEdits(query string) int {
+	edits := utf8.RuneCountInString(strings.TrimSpace(query)) / 3
+	if edits > f.threshold {
+		return f.threshold
+	}
+	return edits
+}
+
 // LevenshteinDistance calculates the Levenshtein distance between two strings
 func (f *FuzzyMatcher) LevenshteinDistance(s1, s2 string) int {
 	if len(s1) == 0 {
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 var (
@@ -127,13 +128,44 @@ func ValidateSessionID(sessionID string) error {
 	return nil
 }
 
+// ValidateCategory validates a category filter
+func ValidateCategory(category string) error {
+	if utf8.RuneCountInString(category) > 50 {
+		return errors.New("category too long")
+	}
+
+	if !utf8.ValidString(category) {
+		return errors.New("category is not valid UTF-8")
+	}
+
+	return nil
+}
+
+// ValidateLocale validates locale format, e.g. "en" or "en-US"
+func ValidateLocale(locale string) error {
+	if locale == "" {
+		return nil // Optional field
+	}
+
+	pattern := regexp.MustCompile(`^[a-zA-Z]{2,8}([-_][a-zA-Z0-9]{1,8}){0,3}$`)
+	if !pattern.MatchString(locale) {
+		return errors.New("invalid locale format")
+	}
+
+	return nil
+}
+
 // ValidateTerm validates suggestion terms
 func ValidateTerm(term string) error {
 	if len(term) == 0 {
 		return errors.New("term cannot be empty")
 	}
 
-	if len(term) > 200 {
+	if !utf8.ValidString(term) {
+		return errors.New("term is not valid UTF-8")
+	}
+
+	if utf8.RuneCountInString(term) > 200 {
 		return errors.New("term too long")
 	}
 
@@ -2,10 +2,17 @@ package test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,8 +22,11 @@ import (
 
 	"github.com/alexnthnz/search-autocomplete/internal/api"
 	"github.com/alexnthnz/search-autocomplete/internal/cache"
+	"github.com/alexnthnz/search-autocomplete/internal/importer"
 	"github.com/alexnthnz/search-autocomplete/internal/metrics"
+	"github.com/alexnthnz/search-autocomplete/internal/persistence"
 	"github.com/alexnthnz/search-autocomplete/internal/pipeline"
+	"github.com/alexnthnz/search-autocomplete/internal/ranking"
 	"github.com/alexnthnz/search-autocomplete/internal/service"
 	"github.com/alexnthnz/search-autocomplete/pkg/models"
 )
@@ -28,6 +38,17 @@ type IntegrationTestSuite struct {
 	handler  *api.Handler
 	pipeline *pipeline.DataPipeline
 	testData []models.Suggestion
+	logger   *logrus.Logger
+	metrics  *metrics.Metrics
+}
+
+// instance is a service separate from the suite's, with its own pipeline
+// and router
+type instance struct {
+	service  *service.AutocompleteService
+	cache    *cache.InMemoryCache // Nil unless the config enables caching
+	pipeline *pipeline.DataPipeline
+	router   *gin.Engine // Requires the test API key for admin endpoints
 }
 
 func TestIntegrationSuite(t *testing.T) {
@@ -39,7 +60,7 @@ func (s *IntegrationTestSuite) SetupSuite() {
 	gin.SetMode(gin.TestMode)
 
 	// Create shared metrics instance for testing
-	sharedMetrics := metrics.NewMetrics()
+	s.metrics = metrics.NewMetrics()
 
 	// Create test service with in-memory cache
 	config := service.Config{
@@ -50,10 +71,10 @@ func (s *IntegrationTestSuite) SetupSuite() {
 		PersonalizedRec: false,
 	}
 
-	logger := logrus.New()
-	logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
-	cacheInstance := cache.NewInMemoryCache(5*time.Minute, logger, sharedMetrics)
-	s.service = service.NewAutocompleteService(config, cacheInstance, logger, sharedMetrics)
+	s.logger = logrus.New()
+	s.logger.SetLevel(logrus.FatalLevel) // Suppress logs during tests
+	cacheInstance := cache.NewInMemoryCache(cache.MemoryConfig{TTL: 5 * time.Minute}, s.logger, s.metrics)
+	s.service = service.NewAutocompleteService(config, cacheInstance, s.logger, s.metrics)
 
 	// Create pipeline for testing
 	pipelineConfig := pipeline.Config{
@@ -61,10 +82,10 @@ func (s *IntegrationTestSuite) SetupSuite() {
 		FlushInterval: 30 * time.Second,
 		QueueSize:     1000,
 	}
-	s.pipeline = pipeline.NewDataPipeline(s.service, pipelineConfig, logger, sharedMetrics)
+	s.pipeline = pipeline.NewDataPipeline(s.service, pipelineConfig, s.logger, s.metrics)
 
 	// Create handler and router
-	s.handler = api.NewHandler(s.service, s.pipeline, logger, sharedMetrics)
+	s.handler = api.NewHandler(s.service, s.pipeline, s.logger, s.metrics)
 	s.router = api.SetupRouter(s.handler, "test-api-key", true)
 
 	// Prepare test data
@@ -83,6 +104,29 @@ func (s *IntegrationTestSuite) SetupSuite() {
 	}
 }
 
+// newInstance creates an instance loaded with the test data
+func (s *IntegrationTestSuite) newInstance(config service.Config, pipelineConfig pipeline.Config) *instance {
+	inst := s.newEmptyInstance(config, pipelineConfig)
+	for _, suggestion := range s.testData {
+		s.Require().NoError(inst.service.AddSuggestion(suggestion))
+	}
+	return inst
+}
+
+// newEmptyInstance creates an instance with nothing in its index
+func (s *IntegrationTestSuite) newEmptyInstance(config service.Config, pipelineConfig pipeline.Config) *instance {
+	inst := &instance{}
+	var serviceCache cache.Cache
+	if config.CacheEnabled {
+		inst.cache = cache.NewInMemoryCache(cache.MemoryConfig{TTL: time.Minute}, s.logger, s.metrics)
+		serviceCache = inst.cache
+	}
+	inst.service = service.NewAutocompleteService(config, serviceCache, s.logger, s.metrics)
+	inst.pipeline = pipeline.NewDataPipeline(inst.service, pipelineConfig, s.logger, s.metrics)
+	inst.router = api.SetupRouter(api.NewHandler(inst.service, inst.pipeline, s.logger, s.metrics), "test-api-key", false)
+	return inst
+}
+
 func (s *IntegrationTestSuite) TestHealthEndpoint() {
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequest("GET", "/api/v1/health", nil)
@@ -378,6 +422,229 @@ func (s *IntegrationTestSuite) TestAdminEndpoints() {
 	})
 }
 
+func (s *IntegrationTestSuite) TestDeleteUnicodeSuggestion() {
+	for _, term := range []string{"café", "東京"} {
+		s.Require().NoError(s.service.AddSuggestion(models.Suggestion{Term: term, Frequency: 50}))
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/api/v1/admin/suggestions/"+url.PathEscape(term), nil)
+		req.Header.Set("X-API-Key", "test-api-key")
+		s.router.ServeHTTP(w, req)
+		s.Equal(http.StatusOK, w.Code, term)
+
+		deleted, err := s.service.DeleteSuggestion(term)
+		s.NoError(err)
+		s.False(deleted, "%s should already be gone", term)
+	}
+}
+
+func (s *IntegrationTestSuite) TestInnerWordMatching() {
+	svc := s.newEmptyInstance(service.Config{}, pipeline.Config{}).service
+
+	for _, suggestion := range []models.Suggestion{
+		{Term: "python programming", Frequency: 150},
+		{Term: "progress report", Frequency: 100},
+		{Term: "machine learning", Frequency: 80},
+	} {
+		s.Require().NoError(svc.AddSuggestion(suggestion))
+	}
+
+	response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "pro", Limit: 5})
+	s.Require().NoError(err)
+	s.Require().Len(response.Suggestions, 2)
+	s.Equal("progress report", response.Suggestions[0].Term, "leading-word matches rank first")
+	s.Equal("python programming", response.Suggestions[1].Term)
+
+	response, err = svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "mach lea", Limit: 5})
+	s.Require().NoError(err)
+	s.Require().Len(response.Suggestions, 1)
+	s.Equal("machine learning", response.Suggestions[0].Term)
+}
+
+func (s *IntegrationTestSuite) TestServiceConfigEnforced() {
+	router := s.newInstance(service.Config{MaxSuggestions: 3, EnableFuzzy: false}, pipeline.Config{}).router
+
+	get := func(url string) (int, models.AutocompleteResponse) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", url, nil)
+		router.ServeHTTP(w, req)
+
+		var response models.AutocompleteResponse
+		if w.Code == http.StatusOK {
+			s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w.Code, response
+	}
+
+	s.Run("GET limit is clamped to the server maximum", func() {
+		code, response := get("/api/v1/autocomplete?q=a&limit=50")
+		s.Equal(http.StatusOK, code)
+		s.Equal(3, response.Limit)
+		s.Len(response.Suggestions, 3)
+	})
+
+	s.Run("POST limit is clamped to the server maximum", func() {
+		body, _ := json.Marshal(models.AutocompleteRequest{Query: "a", Limit: 100})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/autocomplete", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		s.Equal(http.StatusOK, w.Code)
+
+		var response models.AutocompleteResponse
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Equal(3, response.Limit)
+		s.Len(response.Suggestions, 3)
+	})
+
+	s.Run("Fuzzy follows the config unless the request overrides it", func() {
+		_, response := get("/api/v1/autocomplete?q=andriod")
+		s.Empty(response.Suggestions)
+
+		_, response = get("/api/v1/autocomplete?q=andriod&fuzzy=true")
+		s.Require().NotEmpty(response.Suggestions)
+		s.Equal("android", response.Suggestions[0].Term)
+		s.Equal("fuzzy", response.Source)
+
+		code, _ := get("/api/v1/autocomplete?q=andriod&fuzzy=maybe")
+		s.Equal(http.StatusBadRequest, code)
+	})
+}
+
+func (s *IntegrationTestSuite) TestPersonalizedRanking() {
+	svc := s.newInstance(service.Config{PersonalizedRec: true}, pipeline.Config{}).service
+
+	search := func(userID string) []models.RankedSuggestion {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "a", Limit: 5, UserID: userID})
+		s.Require().NoError(err)
+		return response.Suggestions
+	}
+	s.NotEqual("amazon", search("user123")[0].Term)
+
+	svc.RecordSelection("user123", "", "amazon")
+	svc.RecordSelection("user123", "", "amazon")
+	svc.RecordSearch("user123", "", "amazon")
+
+	s.Equal("amazon", search("user123")[0].Term, "the user's own picks rank first")
+	s.NotEqual("amazon", search("user456")[0].Term, "other users are unaffected")
+}
+
+func (s *IntegrationTestSuite) TestSelectionFeedback() {
+	inst := s.newInstance(service.Config{PersonalizedRec: true}, pipeline.Config{BatchSize: 1, FlushInterval: time.Hour})
+	svc, dataPipeline, router := inst.service, inst.pipeline, inst.router
+	dataPipeline.Start(context.Background())
+	defer dataPipeline.Stop()
+
+	post := func(selection map[string]interface{}) int {
+		body, _ := json.Marshal(selection)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/autocomplete/selections", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	selectionSteps := func(query, userID string) map[string]models.RankingStep {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: query, UserID: userID, Explain: true})
+		s.Require().NoError(err)
+
+		steps := make(map[string]models.RankingStep)
+		for _, suggestion := range response.Suggestions {
+			for _, step := range suggestion.Explanation.Steps {
+				if step.Stage == "selection" {
+					steps[suggestion.Term] = step
+				}
+			}
+		}
+		return steps
+	}
+
+	s.Run("Invalid selections are rejected", func() {
+		s.Equal(http.StatusBadRequest, post(map[string]interface{}{"query": "a"}))
+		s.Equal(http.StatusBadRequest, post(map[string]interface{}{"query": "a", "term": "android", "position": -1}))
+		s.Equal(http.StatusBadRequest, post(map[string]interface{}{"query": "a", "term": "android", "user_id": "bad user!"}))
+	})
+
+	s.Run("Selections boost the term for the query", func() {
+		s.Equal(http.StatusAccepted, post(map[string]interface{}{"query": "a", "term": "android", "position": 5, "user_id": "user123"}))
+
+		s.Eventually(func() bool {
+			return selectionSteps("a", "")["android"].Multiplier > 1
+		}, time.Second, 10*time.Millisecond)
+
+		steps := selectionSteps("a", "")
+		s.InDelta(1.5, steps["android"].Multiplier, 1e-9)
+		s.InDelta(1.0, steps["app"].Multiplier, 1e-9)
+		s.InDelta(1.0, selectionSteps("an", "")["android"].Multiplier, 1e-9, "other queries are unaffected")
+
+		stats := dataPipeline.GetStats()
+		s.Equal(1, stats["pending_updates"], "the pick counts towards the term's frequency")
+	})
+
+	s.Run("Selections feed the user's history", func() {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "an", UserID: "user123", Explain: true})
+		s.Require().NoError(err)
+		s.Require().NotEmpty(response.Suggestions)
+
+		for _, step := range response.Suggestions[0].Explanation.Steps {
+			if step.Stage == "personalization" {
+				s.Greater(step.Multiplier, 1.0)
+			}
+		}
+	})
+}
+
+func (s *IntegrationTestSuite) TestTrendingEndpoint() {
+	inst := s.newInstance(service.Config{}, pipeline.Config{BatchSize: 1, FlushInterval: time.Hour, TrendInterval: 10 * time.Millisecond})
+	svc, dataPipeline, router := inst.service, inst.pipeline, inst.router
+	dataPipeline.Start(context.Background())
+	defer dataPipeline.Stop()
+
+	trending := func() []models.TrendingQuery {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/trending", nil)
+		router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response struct {
+			Trending []models.TrendingQuery `json:"trending"`
+			Count    int                    `json:"count"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Require().Len(response.Trending, response.Count)
+		return response.Trending
+	}
+	s.Empty(trending())
+
+	// A burst of searches for a query nobody has searched for before
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/autocomplete?q=android", nil)
+		router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+	}
+
+	s.Eventually(func() bool {
+		current := trending()
+		return len(current) > 0 && current[0].Count == 10
+	}, 2*time.Second, 20*time.Millisecond)
+
+	top := trending()[0]
+	s.Equal("android", top.Query)
+	s.Greater(top.Score, 1.5)
+	s.Greater(top.Boost, 0.0)
+
+	// Trending terms are boosted in ranking
+	response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "an", Explain: true})
+	s.Require().NoError(err)
+	s.Require().NotEmpty(response.Suggestions)
+	for _, step := range response.Suggestions[0].Explanation.Steps {
+		if step.Stage == "trending" {
+			s.InDelta(1+top.Boost, step.Multiplier, 1e-9)
+		}
+	}
+}
+
 func (s *IntegrationTestSuite) TestRateLimiting() {
 	// This test would need to be adjusted based on actual rate limiting implementation
 	// For now, just test that the endpoint responds
@@ -421,6 +688,52 @@ func (s *IntegrationTestSuite) TestFuzzySearch() {
 	s.GreaterOrEqual(len(response.Suggestions), 0)
 }
 
+func (s *IntegrationTestSuite) TestFuzzySearchTypos() {
+	for query, expected := range map[string]string{"aplpication": "application", "andriod": "android", "amazno": "amazon"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/autocomplete?q="+query, nil)
+		s.router.ServeHTTP(w, req)
+		s.Require().Equal(http.StatusOK, w.Code)
+
+		var response models.AutocompleteResponse
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Require().NotEmpty(response.Suggestions, query)
+		s.Equal(expected, response.Suggestions[0].Term, query)
+	}
+}
+
+func (s *IntegrationTestSuite) TestExplainRanking() {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/v1/autocomplete?q=amazno&fuzzy=true&explain=true", nil)
+	s.router.ServeHTTP(w, req)
+	s.Require().Equal(http.StatusOK, w.Code)
+
+	var response models.AutocompleteResponse
+	s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+	s.Equal("fuzzy", response.Source)
+	s.Require().NotEmpty(response.Suggestions)
+
+	top := response.Suggestions[0]
+	s.Equal("amazon", top.Term)
+	s.Require().NotNil(top.Explanation)
+	s.Equal(top.Score, top.Explanation.BaseScore)
+	s.Equal(1, top.Explanation.EditDistance)
+
+	stages := make(map[string]models.RankingStep)
+	for _, step := range top.Explanation.Steps {
+		stages[step.Stage] = step
+	}
+	s.Contains(stages, "personalization")
+	s.InDelta(0.8, stages["fuzzy"].Multiplier, 1e-9)
+	s.InDelta(top.FinalScore, top.Explanation.Steps[len(top.Explanation.Steps)-1].Score, 1e-6)
+
+	// Explanations are opt-in
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/autocomplete?q=amazon", nil)
+	s.router.ServeHTTP(w, req)
+	s.NotContains(w.Body.String(), "explanation")
+}
+
 func (s *IntegrationTestSuite) TestCacheEffectiveness() {
 	// First request - should hit trie
 	w1 := httptest.NewRecorder()
@@ -446,3 +759,1006 @@ func (s *IntegrationTestSuite) TestCacheEffectiveness() {
 		s.Equal(response1.Suggestions[0].Term, response2.Suggestions[0].Term)
 	}
 }
+
+func (s *IntegrationTestSuite) TestCachedResultsKeepStoredScores() {
+	inst := s.newEmptyInstance(service.Config{CacheEnabled: true}, pipeline.Config{})
+	svc, cacheInstance := inst.service, inst.cache
+	s.Require().NoError(svc.AddSuggestion(models.Suggestion{Term: "kiwi", Frequency: 100, UpdatedAt: time.Now()}))
+
+	req := models.AutocompleteRequest{Query: "ki", Limit: 5}
+	first, err := svc.GetSuggestions(context.Background(), req)
+	s.Require().NoError(err)
+	s.Require().Len(first.Suggestions, 1)
+
+	// Results are cached asynchronously, keyed by the startup index generation
+	s.Eventually(func() bool {
+		_, found := cacheInstance.Get(context.Background(), cacheKey(svc, "10:-:ki"))
+		return found
+	}, time.Second, 10*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		response, err := svc.GetSuggestions(context.Background(), req)
+		s.Require().NoError(err)
+		s.Equal("cache", response.Source)
+		s.Require().Len(response.Suggestions, 1)
+		s.Equal(100.0, response.Suggestions[0].Score, "stored score is not re-boosted")
+		s.InDelta(first.Suggestions[0].FinalScore, response.Suggestions[0].FinalScore, 1e-6)
+	}
+}
+
+func (s *IntegrationTestSuite) TestSnapshotRestore() {
+	path := filepath.Join(s.T().TempDir(), "index.snapshot")
+	s.Require().NoError(s.service.SaveSnapshot(path))
+
+	restored := s.newEmptyInstance(service.Config{IndexType: "radix"}, pipeline.Config{}).service
+
+	count, err := restored.LoadSnapshot(path)
+	s.Require().NoError(err)
+	s.Equal(s.service.GetTrieStats()["suggestions_count"], count)
+
+	response, err := restored.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "app", Limit: 5})
+	s.Require().NoError(err)
+	s.NotEmpty(response.Suggestions)
+}
+
+func (s *IntegrationTestSuite) TestWALReplay() {
+	dir := s.T().TempDir()
+	snapshotPath := filepath.Join(dir, "index.snapshot")
+	walConfig := persistence.WALConfig{Dir: filepath.Join(dir, "wal"), SyncPolicy: persistence.SyncAlways}
+
+	primary := s.newEmptyInstance(service.Config{}, pipeline.Config{}).service
+	wal, err := persistence.OpenWAL(walConfig, s.logger)
+	s.Require().NoError(err)
+	_, err = primary.AttachWAL(wal)
+	s.Require().NoError(err)
+
+	s.Require().NoError(primary.AddSuggestion(models.Suggestion{Term: "kiwi", Frequency: 10, Score: 10}))
+	s.Require().NoError(primary.SaveSnapshot(snapshotPath))
+
+	// These only exist in the log
+	s.Require().NoError(primary.AddSuggestion(models.Suggestion{Term: "kumquat", Frequency: 5, Score: 5}))
+	s.Require().NoError(primary.UpdateFrequency("kiwi", 50))
+	deleted, err := primary.DeleteSuggestion("kumquat")
+	s.Require().NoError(err)
+	s.True(deleted)
+	s.Require().NoError(primary.AddSuggestion(models.Suggestion{Term: "kale", Frequency: 20, Score: 20}))
+	s.Require().NoError(wal.Close())
+
+	recovered := s.newEmptyInstance(service.Config{}, pipeline.Config{}).service
+	_, err = recovered.LoadSnapshot(snapshotPath)
+	s.Require().NoError(err)
+	wal, err = persistence.OpenWAL(walConfig, s.logger)
+	s.Require().NoError(err)
+	defer wal.Close()
+
+	replayed, err := recovered.AttachWAL(wal)
+	s.Require().NoError(err)
+	s.Equal(4, replayed)
+
+	response, err := recovered.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "k", Limit: 5})
+	s.Require().NoError(err)
+	s.Require().Len(response.Suggestions, 2)
+	s.Equal("kiwi", response.Suggestions[0].Term)
+	s.Equal(int64(50), response.Suggestions[0].Frequency)
+	s.Equal("kale", response.Suggestions[1].Term)
+}
+
+func (s *IntegrationTestSuite) TestBatchAddReportsWALFailure() {
+	inst := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+	wal, err := persistence.OpenWAL(persistence.WALConfig{Dir: s.T().TempDir(), SyncPolicy: persistence.SyncAlways}, s.logger)
+	s.Require().NoError(err)
+	_, err = inst.service.AttachWAL(wal)
+	s.Require().NoError(err)
+	s.Require().NoError(wal.Close())
+
+	err = inst.service.BatchAddSuggestions([]models.Suggestion{{Term: "kiwi", Frequency: 10}, {Term: "kale", Frequency: 20}})
+	s.ErrorIs(err, persistence.ErrWALClosed)
+	s.Zero(inst.service.SuggestionCount(), "nothing unlogged is added")
+
+	body, _ := json.Marshal([]models.Suggestion{{Term: "kiwi", Frequency: 10}})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/admin/suggestions/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", "test-api-key")
+	inst.router.ServeHTTP(w, req)
+	s.Equal(http.StatusInternalServerError, w.Code)
+}
+
+func (s *IntegrationTestSuite) TestScoreDecay() {
+	walConfig := persistence.WALConfig{Dir: s.T().TempDir(), SyncPolicy: persistence.SyncAlways}
+	config := service.Config{ScoreHalfLife: time.Hour}
+
+	primary := s.newEmptyInstance(config, pipeline.Config{}).service
+	wal, err := persistence.OpenWAL(walConfig, s.logger)
+	s.Require().NoError(err)
+	_, err = primary.AttachWAL(wal)
+	s.Require().NoError(err)
+
+	// Searches made two hours ago count for a quarter with a one hour half-life
+	s.Require().NoError(primary.AddSuggestion(models.Suggestion{Term: "last year's spike"}))
+	_, err = primary.AddFrequency("last year's spike", 1000, 1000*primary.ScoreWeight(time.Now().Add(-2*time.Hour)))
+	s.Require().NoError(err)
+
+	// Scores are weighted from a fixed epoch, so nothing needs rescaling
+	// until they grow large
+	lsn := wal.LastLSN()
+	s.Require().NoError(primary.DecayScores(time.Now().Add(2 * time.Hour)))
+	s.Equal(lsn, wal.LastLSN(), "no rescale is logged while scores are small")
+
+	scores := func(svc *service.AutocompleteService) map[string]models.RankedSuggestion {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "la"})
+		s.Require().NoError(err)
+
+		byTerm := make(map[string]models.RankedSuggestion)
+		for _, suggestion := range response.Suggestions {
+			byTerm[suggestion.Term] = suggestion
+		}
+		s.Require().Len(byTerm, 2)
+		s.Equal("latest demand", response.Suggestions[0].Term, "recent demand outranks an old spike")
+		return byTerm
+	}
+
+	// Rescaling to a far later epoch changes no score, and suggestions added
+	// afterwards compare with the ones added before
+	s.Require().NoError(primary.DecayScores(time.Now().Add(300 * time.Hour)))
+	s.Equal(lsn+1, wal.LastLSN(), "the rescale is logged")
+	s.Require().NoError(primary.AddSuggestion(models.Suggestion{Term: "latest demand", Frequency: 400}))
+	s.Require().NoError(wal.Close())
+
+	decayed := scores(primary)
+	s.InDelta(250, decayed["last year's spike"].Score, 1)
+	s.InDelta(400, decayed["latest demand"].Score, 1)
+	s.Equal(int64(1000), decayed["last year's spike"].Frequency, "frequency stays a raw count")
+
+	// Rescales are logged, so a replay ends up with the same scores
+	recovered := s.newEmptyInstance(config, pipeline.Config{}).service
+	wal, err = persistence.OpenWAL(walConfig, s.logger)
+	s.Require().NoError(err)
+	defer wal.Close()
+	_, err = recovered.AttachWAL(wal)
+	s.Require().NoError(err)
+
+	s.InDelta(decayed["last year's spike"].Score, scores(recovered)["last year's spike"].Score, 0.1)
+}
+
+func (s *IntegrationTestSuite) TestPipelineAccumulatesFrequencies() {
+	inst := s.newInstance(service.Config{}, pipeline.Config{BatchSize: 1, FlushInterval: 10 * time.Millisecond})
+	svc, dataPipeline := inst.service, inst.pipeline
+	dataPipeline.Start(context.Background())
+
+	frequency := func(term string) int64 {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: term, Limit: 1})
+		s.Require().NoError(err)
+		if len(response.Suggestions) == 0 || response.Suggestions[0].Term != term {
+			return 0
+		}
+		return response.Suggestions[0].Frequency
+	}
+
+	// Searches spread over several flushes all add to the stored count
+	for _, query := range []string{"android", "kotlin", "android", "kotlin", "android"} {
+		s.Require().NoError(dataPipeline.LogQuery(models.SearchLog{Query: query, Timestamp: time.Now()}))
+		time.Sleep(15 * time.Millisecond)
+	}
+	dataPipeline.Stop()
+
+	s.Equal(int64(703), frequency("android"), "a quiet interval doesn't reset a popular term")
+	s.Equal(int64(2), frequency("kotlin"), "new queries become suggestions")
+
+	// Concurrent increments are never lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := svc.AddFrequency("amazon", 5, 5)
+			s.NoError(err)
+			s.True(found)
+		}()
+	}
+	wg.Wait()
+	s.Equal(int64(1000), frequency("amazon"))
+
+	found, err := svc.AddFrequency("missing", 5, 5)
+	s.NoError(err)
+	s.False(found)
+}
+
+func (s *IntegrationTestSuite) TestQueryLogResume() {
+	dir := s.T().TempDir()
+
+	// run starts a pipeline on a fresh index, logs queries and shuts down
+	run := func(fromStart bool, queries ...string) *service.AutocompleteService {
+		queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{Dir: dir, SyncPolicy: persistence.SyncAlways}, s.logger)
+		s.Require().NoError(err)
+		defer queryLog.Close()
+
+		inst := s.newEmptyInstance(service.Config{}, pipeline.Config{BatchSize: 1, FlushInterval: 10 * time.Millisecond})
+		svc, dataPipeline := inst.service, inst.pipeline
+		s.Require().NoError(dataPipeline.AttachQueryLog(queryLog, fromStart))
+		dataPipeline.Start(context.Background())
+
+		for _, query := range queries {
+			s.Require().NoError(dataPipeline.LogQuery(models.SearchLog{Query: query, Timestamp: time.Now()}))
+		}
+		s.Eventually(func() bool {
+			return dataPipeline.GetStats()["query_log"].(map[string]interface{})["lag"] == uint64(0)
+		}, time.Second, 5*time.Millisecond)
+		dataPipeline.Stop()
+
+		committed, err := queryLog.Committed("pipeline")
+		s.Require().NoError(err)
+		s.Equal(queryLog.LastOffset(), committed, "everything processed is committed on shutdown")
+		return svc
+	}
+	frequency := func(svc *service.AutocompleteService, term string) int64 {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: term, Limit: 1})
+		s.Require().NoError(err)
+		if len(response.Suggestions) == 0 || response.Suggestions[0].Term != term {
+			return 0
+		}
+		return response.Suggestions[0].Frequency
+	}
+
+	svc := run(false, "kotlin", "kotlin", "swift")
+	s.Equal(int64(2), frequency(svc, "kotlin"))
+
+	// A restart resumes after the committed offset
+	svc = run(false, "swift")
+	s.Equal(int64(0), frequency(svc, "kotlin"), "processed logs are not applied twice")
+	s.Equal(int64(1), frequency(svc, "swift"))
+
+	// Replaying rebuilds frequencies from all retained history
+	svc = run(true)
+	s.Equal(int64(2), frequency(svc, "kotlin"))
+	s.Equal(int64(2), frequency(svc, "swift"))
+}
+
+func (s *IntegrationTestSuite) TestQueryLogSelections() {
+	dir := s.T().TempDir()
+
+	// run starts a pipeline on a fresh index and waits for it to consume
+	// the log, after logging a search and a selection when asked
+	run := func(fromStart, log bool) *service.AutocompleteService {
+		queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{Dir: dir, SyncPolicy: persistence.SyncAlways}, s.logger)
+		s.Require().NoError(err)
+		defer queryLog.Close()
+
+		inst := s.newEmptyInstance(service.Config{}, pipeline.Config{BatchSize: 1, FlushInterval: 10 * time.Millisecond})
+		svc, dataPipeline := inst.service, inst.pipeline
+		s.Require().NoError(dataPipeline.AttachQueryLog(queryLog, fromStart))
+		dataPipeline.Start(context.Background())
+
+		if log {
+			s.Require().NoError(dataPipeline.LogQuery(models.SearchLog{Query: "kotlin", Timestamp: time.Now()}))
+			s.Require().NoError(dataPipeline.LogSelection(models.SelectionLog{Query: "ko", Term: "kotlin", Position: 2, Timestamp: time.Now()}))
+			s.Equal(uint64(2), queryLog.LastOffset(), "selections are logged like searches")
+		}
+		s.Eventually(func() bool {
+			suggestion, ok := svc.GetSuggestion("kotlin")
+			return ok && suggestion.Frequency == 3
+		}, time.Second, 5*time.Millisecond)
+		dataPipeline.Stop()
+		return svc
+	}
+
+	// The search and the selection both count towards the frequency
+	run(false, true)
+
+	// Replaying the log counts the selection again, and boosts the picked
+	// term for the query it was picked from
+	svc := run(true, false)
+	response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "ko", Explain: true})
+	s.Require().NoError(err)
+	s.Require().Len(response.Suggestions, 1)
+	explanation := response.Suggestions[0].Explanation
+	s.Require().NotNil(explanation)
+	var boost float64
+	for _, step := range explanation.Steps {
+		if step.Stage == ranking.StageSelection {
+			boost = step.Multiplier
+		}
+	}
+	s.Greater(boost, 1.0, "the replayed selection boosts the term")
+}
+
+func (s *IntegrationTestSuite) TestQueryLogHoldsOffsetOnFailure() {
+	dir := s.T().TempDir()
+	pipelineConfig := pipeline.Config{BatchSize: 1, FlushInterval: 10 * time.Millisecond}
+
+	queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{Dir: filepath.Join(dir, "querylog"), SyncPolicy: persistence.SyncAlways}, s.logger)
+	s.Require().NoError(err)
+	defer queryLog.Close()
+
+	// Every mutation fails once the WAL is closed
+	wal, err := persistence.OpenWAL(persistence.WALConfig{Dir: filepath.Join(dir, "wal")}, s.logger)
+	s.Require().NoError(err)
+	inst := s.newEmptyInstance(service.Config{}, pipelineConfig)
+	_, err = inst.service.AttachWAL(wal)
+	s.Require().NoError(err)
+	s.Require().NoError(wal.Close())
+
+	dataPipeline := inst.pipeline
+	s.Require().NoError(dataPipeline.AttachQueryLog(queryLog, false))
+	dataPipeline.Start(context.Background())
+	s.Require().NoError(dataPipeline.LogQuery(models.SearchLog{Query: "kotlin", Timestamp: time.Now()}))
+	s.Eventually(func() bool {
+		return dataPipeline.GetStats()["query_log"].(map[string]interface{})["lag"] == uint64(0)
+	}, time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond) // Let a few flushes fail
+	dataPipeline.Stop()
+
+	committed, err := queryLog.Committed("pipeline")
+	s.Require().NoError(err)
+	s.Zero(committed, "failed updates aren't committed past")
+
+	// A restart applies them
+	inst = s.newEmptyInstance(service.Config{}, pipelineConfig)
+	restarted, dataPipeline := inst.service, inst.pipeline
+	s.Require().NoError(dataPipeline.AttachQueryLog(queryLog, false))
+	dataPipeline.Start(context.Background())
+	s.Eventually(func() bool {
+		_, ok := restarted.GetSuggestion("kotlin")
+		return ok
+	}, time.Second, 5*time.Millisecond)
+	dataPipeline.Stop()
+}
+
+func (s *IntegrationTestSuite) TestQueryLogBackpressure() {
+	queryLog, err := persistence.OpenQueryLog(persistence.QueryLogConfig{Dir: s.T().TempDir()}, s.logger)
+	s.Require().NoError(err)
+	defer queryLog.Close()
+
+	dataPipeline := s.newEmptyInstance(service.Config{}, pipeline.Config{MaxLag: 2, BackpressureTimeout: 20 * time.Millisecond}).pipeline
+	s.Require().NoError(dataPipeline.AttachQueryLog(queryLog, false))
+
+	// With no consumer running the log fills up and callers are told so
+	s.NoError(dataPipeline.LogQuery(models.SearchLog{Query: "kotlin"}))
+	s.NoError(dataPipeline.LogQuery(models.SearchLog{Query: "kotlin"}))
+	s.ErrorIs(dataPipeline.LogQuery(models.SearchLog{Query: "kotlin"}), pipeline.ErrBackpressure)
+	s.ErrorIs(dataPipeline.LogSelection(models.SelectionLog{Query: "ko", Term: "kotlin"}), pipeline.ErrBackpressure)
+	s.Equal(uint64(2), queryLog.LastOffset(), "rejected logs are not written")
+
+	// Once the consumer catches up logging is accepted again
+	dataPipeline.Start(context.Background())
+	defer dataPipeline.Stop()
+	s.Eventually(func() bool {
+		return dataPipeline.LogQuery(models.SearchLog{Query: "kotlin"}) == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func (s *IntegrationTestSuite) TestImportEndpoint() {
+	inst := s.newInstance(service.Config{}, pipeline.Config{})
+	svc, router := inst.service, inst.router
+
+	post := func(query, contentType, body string) (int, importer.Report) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/admin/suggestions/import"+query, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "test-api-key")
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		router.ServeHTTP(w, req)
+
+		var report importer.Report
+		if w.Code == http.StatusOK {
+			s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &report))
+		}
+		return w.Code, report
+	}
+
+	csv := "term,frequency,category,brand\napple,1500,fruit,acme\napricot,300,fruit,\nmango,abc,fruit,\n"
+
+	s.Run("dry run changes nothing", func() {
+		code, report := post("?dry_run=true", "text/csv", csv)
+		s.Equal(http.StatusOK, code)
+		s.True(report.DryRun)
+		s.Equal(1, report.Added)
+		s.Equal(1, report.Updated)
+		s.Equal(1, report.Invalid)
+		s.Require().Len(report.Errors, 1)
+		s.Equal(4, report.Errors[0].Line)
+
+		_, ok := svc.GetSuggestion("apricot")
+		s.False(ok)
+	})
+
+	s.Run("upsert stores valid rows with metadata", func() {
+		code, report := post("?format=csv", "", csv)
+		s.Equal(http.StatusOK, code)
+		s.Equal(1, report.Added)
+		s.Equal(1, report.Updated)
+
+		apple, ok := svc.GetSuggestion("apple")
+		s.Require().True(ok)
+		s.Equal(int64(1500), apple.Frequency)
+		s.Equal(map[string]string{"brand": "acme"}, apple.Metadata)
+
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: "apr", Limit: 5})
+		s.Require().NoError(err)
+		s.Require().NotEmpty(response.Suggestions)
+		s.Equal("apricot", response.Suggestions[0].Term)
+	})
+
+	s.Run("replace removes terms missing from the file", func() {
+		jsonl := `{"term": "apple", "frequency": 10}` + "\n" + `{"term": "kiwi", "frequency": 5, "metadata": {"origin": "nz"}}` + "\n"
+		code, report := post("?mode=replace", "application/x-ndjson", jsonl)
+		s.Equal(http.StatusOK, code)
+		s.Equal(len(s.testData), report.Removed)
+		s.Equal(2, svc.SuggestionCount())
+
+		_, ok := svc.GetSuggestion("amazon")
+		s.False(ok)
+	})
+
+	s.Run("a failed import reports how far it got", func() {
+		// Every write fails once the WAL is closed
+		failing := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+		wal, err := persistence.OpenWAL(persistence.WALConfig{Dir: s.T().TempDir()}, s.logger)
+		s.Require().NoError(err)
+		_, err = failing.service.AttachWAL(wal)
+		s.Require().NoError(err)
+		s.Require().NoError(wal.Close())
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/admin/suggestions/import?format=csv", strings.NewReader(csv))
+		req.Header.Set("X-API-Key", "test-api-key")
+		failing.router.ServeHTTP(w, req)
+		s.Equal(http.StatusInternalServerError, w.Code)
+
+		var response struct {
+			Code   string          `json:"code"`
+			Import importer.Report `json:"import"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Equal("INTERNAL_ERROR", response.Code)
+		s.Equal(3, response.Import.Rows)
+		s.Equal(1, response.Import.Invalid)
+	})
+
+	s.Run("unreadable files are rejected", func() {
+		code, _ := post("?format=csv", "", "frequency\n10\n")
+		s.Equal(http.StatusBadRequest, code)
+
+		code, _ = post("", "application/json", "[]")
+		s.Equal(http.StatusBadRequest, code, "format is required")
+
+		code, _ = post("?format=csv&mode=merge", "", csv)
+		s.Equal(http.StatusBadRequest, code)
+	})
+}
+
+func (s *IntegrationTestSuite) TestExportEndpoint() {
+	inst := s.newInstance(service.Config{}, pipeline.Config{})
+	svc, router := inst.service, inst.router
+	s.Require().NoError(svc.AddSuggestion(models.Suggestion{Term: "avocado", Frequency: 40, Category: "fruit", Metadata: map[string]string{"origin": "mexico"}}))
+
+	export := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/admin/suggestions/export"+query, nil)
+		req.Header.Set("X-API-Key", "test-api-key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	terms := func(body string) []string {
+		var result []string
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			var suggestion models.Suggestion
+			s.Require().NoError(json.Unmarshal([]byte(line), &suggestion))
+			result = append(result, suggestion.Term)
+		}
+		return result
+	}
+
+	s.Run("streams every suggestion in term order", func() {
+		w := export("")
+		s.Equal(http.StatusOK, w.Code)
+		s.Equal("application/x-ndjson", w.Header().Get("Content-Type"))
+		s.Equal("6", w.Result().Trailer.Get("X-Suggestion-Count"))
+		s.Equal([]string{"amazon", "android", "app", "apple", "application", "avocado"}, terms(w.Body.String()))
+	})
+
+	s.Run("filters by prefix and category", func() {
+		s.Equal([]string{"app", "application"}, terms(export("?prefix=APP&category=tech").Body.String()))
+		s.Equal([]string{"apple", "avocado"}, terms(export("?category=fruit").Body.String()))
+		s.Equal("0", export("?prefix=zzz").Result().Trailer.Get("X-Suggestion-Count"))
+	})
+
+	s.Run("csv exports import back", func() {
+		w := export("?format=csv")
+		s.Equal(http.StatusOK, w.Code)
+		s.True(strings.HasPrefix(w.Body.String(), "term,frequency,score,category,updated_at,metadata\n"))
+
+		restored := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+		req, _ := http.NewRequest("POST", "/api/v1/admin/suggestions/import?format=csv", bytes.NewReader(w.Body.Bytes()))
+		req.Header.Set("X-API-Key", "test-api-key")
+		imported := httptest.NewRecorder()
+		restored.router.ServeHTTP(imported, req)
+		s.Require().Equal(http.StatusOK, imported.Code)
+		s.Equal(6, restored.service.SuggestionCount())
+
+		avocado, ok := restored.service.GetSuggestion("avocado")
+		s.Require().True(ok)
+		s.Equal(int64(40), avocado.Frequency)
+		s.Equal(map[string]string{"origin": "mexico"}, avocado.Metadata)
+	})
+
+	s.Run("large exports are read a page at a time", func() {
+		large := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+		for i := 0; i < 2500; i++ {
+			s.Require().NoError(large.service.AddSuggestion(models.Suggestion{Term: fmt.Sprintf("term %04d", i), Frequency: 1}))
+		}
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/admin/suggestions/export", nil)
+		req.Header.Set("X-API-Key", "test-api-key")
+		large.router.ServeHTTP(w, req)
+		s.Equal("2500", w.Result().Trailer.Get("X-Suggestion-Count"))
+
+		var expected []string
+		for i := 0; i < 2500; i++ {
+			expected = append(expected, fmt.Sprintf("term %04d", i))
+		}
+		s.Equal(expected, terms(w.Body.String()), "no term is repeated or skipped between pages")
+	})
+
+	s.Run("case variants of a term aren't split between pages", func() {
+		large := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+		var expected []string
+		add := func(term string) {
+			s.Require().NoError(large.service.AddSuggestion(models.Suggestion{Term: term, Frequency: 1}))
+			expected = append(expected, term)
+		}
+		for i := 0; i < 999; i++ {
+			add(fmt.Sprintf("term %04d", i))
+		}
+		// The 1000th suggestion ends the first page, and shares its index
+		// key with the two after it
+		add("Term 0999")
+		add("term 0999")
+		add("TERM 0999")
+		for i := 1000; i < 1500; i++ {
+			add(fmt.Sprintf("term %04d", i))
+		}
+		s.Require().Equal(1502, large.service.SuggestionCount())
+
+		var exported []string
+		for suggestion := range large.service.ExportSuggestions("", "") {
+			exported = append(exported, suggestion.Term)
+		}
+		s.ElementsMatch(expected, exported, "every case variant is exported exactly once")
+	})
+
+	s.Run("rejects unsupported formats and missing keys", func() {
+		s.Equal(http.StatusBadRequest, export("?format=tsv").Code)
+		s.Equal(http.StatusBadRequest, export("?format=xml").Code)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/v1/admin/suggestions/export", nil)
+		router.ServeHTTP(w, req)
+		s.Equal(http.StatusUnauthorized, w.Code)
+	})
+}
+
+func (s *IntegrationTestSuite) TestBackfill() {
+	inst := s.newEmptyInstance(service.Config{ScoreHalfLife: 24 * time.Hour}, pipeline.Config{BatchSize: 2})
+	svc, dataPipeline := inst.service, inst.pipeline
+	s.Require().NoError(svc.AddSuggestion(models.Suggestion{Term: "apple", Frequency: 1000, Score: 1000}))
+
+	now := time.Now()
+	dir := s.T().TempDir()
+
+	jsonl := strings.Join([]string{
+		fmt.Sprintf(`{"query": "kiwi", "user_id": "u1", "timestamp": %q}`, now.Add(-48*time.Hour).Format(time.RFC3339Nano)),
+		fmt.Sprintf(`{"query": "Kiwi", "timestamp": %q}`, now.Add(-time.Minute).Format(time.RFC3339Nano)),
+		"",
+		`{"query": ""}`,
+		"not a log line",
+	}, "\n")
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte(jsonl), 0o644))
+
+	accessLog := func(at time.Time, target string, status int) string {
+		return fmt.Sprintf(`203.0.113.7 - - [%s] "GET %s HTTP/1.1" %d 512 "-" "curl/8.0"`, at.Format("02/Jan/2006:15:04:05 -0700"), target, status)
+	}
+	var gz bytes.Buffer
+	writer := gzip.NewWriter(&gz)
+	fmt.Fprintln(writer, accessLog(now.Add(-time.Minute), "/api/v1/autocomplete?q=kiwi&limit=5", 200))
+	fmt.Fprintln(writer, accessLog(now.Add(-48*time.Hour), "/api/v1/autocomplete?q=apple", 200))
+	fmt.Fprintln(writer, accessLog(now.Add(-time.Minute), "/api/v1/autocomplete?q=mango", 500))
+	fmt.Fprintln(writer, accessLog(now.Add(-time.Minute), "/api/v1/health", 200))
+	s.Require().NoError(writer.Close())
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "b.log.gz"), gz.Bytes(), 0o644))
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, ".partial"), []byte(`{"query": "ignored"}`), 0o644))
+
+	progress, err := dataPipeline.Backfill(context.Background(), pipeline.BackfillConfig{Dir: dir})
+	s.Require().NoError(err)
+
+	s.Equal(2, progress.Files)
+	s.Equal(2, progress.FilesDone)
+	s.Zero(progress.FilesFailed)
+	s.Equal(int64(8), progress.Lines)
+	s.Equal(int64(4), progress.Queries)
+	s.Equal(int64(4), progress.Skipped)
+	s.WithinDuration(now.Add(-48*time.Hour), progress.Oldest, time.Second)
+	s.False(progress.FinishedAt.IsZero())
+	s.Equal(progress, dataPipeline.GetStats()["backfill"])
+
+	// Every search counts towards the frequency, but a two day old one adds
+	// only a quarter to the score with a one day half-life
+	kiwi, ok := svc.GetSuggestion("kiwi")
+	s.Require().True(ok)
+	s.Equal(int64(3), kiwi.Frequency)
+	s.InDelta(2.25, kiwi.Score, 0.01)
+
+	apple, _ := svc.GetSuggestion("apple")
+	s.Equal(int64(1001), apple.Frequency)
+	s.InDelta(1000.25, apple.Score, 0.01)
+
+	_, ok = svc.GetSuggestion("ignored")
+	s.False(ok, "hidden files are skipped")
+
+	_, err = dataPipeline.Backfill(context.Background(), pipeline.BackfillConfig{Dir: filepath.Join(dir, "missing")})
+	s.Error(err)
+}
+
+func (s *IntegrationTestSuite) TestIndexRebuild() {
+	snapshotPath := filepath.Join(s.T().TempDir(), "index.snapshot")
+	inst := s.newInstance(service.Config{CacheEnabled: true, SnapshotPath: snapshotPath}, pipeline.Config{})
+	svc, cacheInstance := inst.service, inst.cache
+
+	request := func(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", "test-api-key")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	search := func(query string) *models.AutocompleteResponse {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: query, Limit: 5})
+		s.Require().NoError(err)
+		return response
+	}
+
+	// Cache results from the startup generation
+	s.Equal("trie", search("ap").Source)
+	s.Eventually(func() bool {
+		_, found := cacheInstance.Get(context.Background(), cacheKey(svc, "10:-:ap"))
+		return found
+	}, time.Second, 10*time.Millisecond)
+	s.Equal("cache", search("ap").Source)
+	startup := svc.IndexStatus().Active.Generation
+
+	s.Run("invalid rows keep the live index", func() {
+		w := request(inst.router, "POST", "/api/v1/admin/index/rebuild?source=import&format=csv", "term,frequency\napricot,300\nmango,abc\n")
+		s.Equal(http.StatusBadRequest, w.Code)
+
+		var response struct {
+			Import importer.Report `json:"import"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Equal(1, response.Import.Invalid)
+
+		status := svc.IndexStatus()
+		s.Equal(startup, status.Active.Generation)
+		s.Nil(status.Previous)
+		s.False(status.Rebuilding)
+		_, ok := svc.GetSuggestion("apricot")
+		s.False(ok)
+	})
+
+	s.Run("rebuild swaps in a new generation", func() {
+		w := request(inst.router, "POST", "/api/v1/admin/index/rebuild?source=import&format=csv", "term,frequency\napricot,300\nkiwi,50\n")
+		s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+		var response struct {
+			Index service.IndexStatus `json:"index"`
+		}
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &response))
+		s.Greater(response.Index.Active.Generation, startup)
+		s.Equal("import", response.Index.Active.Source)
+		s.Equal(2, response.Index.Active.Suggestions)
+		s.Require().NotNil(response.Index.Previous)
+		s.Equal(startup, response.Index.Previous.Generation)
+
+		_, ok := svc.GetSuggestion("apple")
+		s.False(ok)
+
+		// Results cached for the old generation are never served again
+		response2 := search("ap")
+		s.Equal("trie", response2.Source)
+		s.Require().Len(response2.Suggestions, 1)
+		s.Equal("apricot", response2.Suggestions[0].Term)
+	})
+
+	s.Run("mutations made during a rebuild are caught up", func() {
+		imported := svc.IndexStatus().Active.Generation
+		status, err := svc.Rebuild("test", func(b *service.IndexBuilder) error {
+			b.Add(models.Suggestion{Term: "banana", Frequency: 10})
+
+			_, err := svc.Rebuild("test", func(*service.IndexBuilder) error { return nil })
+			s.ErrorIs(err, service.ErrRebuildInProgress)
+
+			s.True(svc.IndexStatus().Rebuilding)
+			s.NoError(svc.AddSuggestion(models.Suggestion{Term: "blueberry", Frequency: 20}))
+			_, ok := svc.GetSuggestion("banana")
+			s.False(ok, "the new index isn't live while it loads")
+			return nil
+		})
+		s.Require().NoError(err)
+		s.Greater(status.Active.Generation, imported)
+
+		for _, term := range []string{"banana", "blueberry"} {
+			_, ok := svc.GetSuggestion(term)
+			s.True(ok, term)
+		}
+	})
+
+	s.Run("rollback restores the replaced index", func() {
+		s.NoError(svc.AddSuggestion(models.Suggestion{Term: "cherry", Frequency: 30}))
+		replaced := svc.IndexStatus().Active.Generation
+
+		w := request(inst.router, "POST", "/api/v1/admin/index/rollback", "")
+		s.Require().Equal(http.StatusOK, w.Code, w.Body.String())
+
+		status := svc.IndexStatus()
+		s.Greater(status.Active.Generation, replaced, "the restored index gets a new id")
+		s.Equal("import", status.Active.Source)
+
+		_, ok := svc.GetSuggestion("banana")
+		s.False(ok)
+		for _, term := range []string{"apricot", "blueberry", "cherry"} {
+			_, ok := svc.GetSuggestion(term)
+			s.True(ok, "%s was added to the kept index too", term)
+		}
+	})
+
+	s.Run("the swapped index survives a restart", func() {
+		restarted := s.newEmptyInstance(service.Config{}, pipeline.Config{}).service
+		count, err := restarted.LoadSnapshot(snapshotPath)
+		s.Require().NoError(err)
+		s.Equal(svc.SuggestionCount(), count)
+		s.Equal(svc.IndexStatus().Active.Generation, restarted.IndexStatus().Active.Generation)
+
+		// Without a WAL, rebuilding from the snapshot goes back to it
+		s.NoError(restarted.AddSuggestion(models.Suggestion{Term: "date", Frequency: 5}))
+		status, err := restarted.Rebuild("snapshot", func(b *service.IndexBuilder) error {
+			return restarted.LoadSnapshotInto(b, snapshotPath)
+		})
+		s.Require().NoError(err)
+		s.Equal(count, status.Active.Suggestions)
+		_, ok := restarted.GetSuggestion("date")
+		s.False(ok, "the snapshot on disk is reloaded, not the live index")
+
+		// With one, changes logged since the snapshot are replayed
+		wal, err := persistence.OpenWAL(persistence.WALConfig{Dir: s.T().TempDir(), SyncPolicy: persistence.SyncAlways}, s.logger)
+		s.Require().NoError(err)
+		defer wal.Close()
+		_, err = restarted.AttachWAL(wal)
+		s.Require().NoError(err)
+		s.NoError(restarted.AddSuggestion(models.Suggestion{Term: "date", Frequency: 5}))
+		s.NoError(restarted.UpdateFrequency("apricot", 900))
+
+		status, err = restarted.Rebuild("snapshot", func(b *service.IndexBuilder) error {
+			return restarted.LoadSnapshotInto(b, snapshotPath)
+		})
+		s.Require().NoError(err)
+		s.Equal(count+1, status.Active.Suggestions)
+		_, ok = restarted.GetSuggestion("date")
+		s.True(ok, "changes logged since the snapshot are kept")
+		apricot, _ := restarted.GetSuggestion("apricot")
+		s.Equal(int64(900), apricot.Frequency)
+	})
+
+	s.Run("status and errors", func() {
+		w := request(inst.router, "GET", "/api/v1/admin/index", "")
+		s.Equal(http.StatusOK, w.Code)
+		var status service.IndexStatus
+		s.Require().NoError(json.Unmarshal(w.Body.Bytes(), &status))
+		s.Equal(svc.IndexStatus().Active.Generation, status.Active.Generation)
+
+		s.Equal(http.StatusBadRequest, request(inst.router, "POST", "/api/v1/admin/index/rebuild?source=nowhere", "").Code)
+
+		fresh := s.newEmptyInstance(service.Config{}, pipeline.Config{})
+		s.Greater(fresh.service.IndexStatus().Active.Generation, status.Active.Generation, "a restart without a snapshot doesn't reuse an id")
+		for path, code := range map[string]int{
+			"/api/v1/admin/index/rollback":                http.StatusConflict,
+			"/api/v1/admin/index/rebuild?source=snapshot": http.StatusBadRequest,
+		} {
+			s.Equal(code, request(fresh.router, "POST", path, "").Code, path)
+		}
+	})
+}
+
+func (s *IntegrationTestSuite) TestCrossInstanceInvalidation() {
+	bus := cache.NewLocalBus()
+
+	// Two instances, each with its own cache
+	a := s.newInstance(service.Config{CacheEnabled: true}, pipeline.Config{}).service
+	a.AttachInvalidationBus(bus)
+	inst := s.newInstance(service.Config{CacheEnabled: true}, pipeline.Config{})
+	b, bCache := inst.service, inst.cache
+	b.AttachInvalidationBus(bus)
+
+	cached := func(query string) bool {
+		_, found := bCache.Get(context.Background(), cacheKey(b, "10:-:"+query))
+		return found
+	}
+	warm := func(queries ...string) {
+		for _, query := range queries {
+			_, err := b.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: query, Limit: 5})
+			s.Require().NoError(err)
+			s.Require().Eventually(func() bool { return cached(query) }, time.Second, 10*time.Millisecond)
+		}
+	}
+
+	warm("ap", "am")
+	s.Require().NoError(a.UpdateFrequency("apple", 5000))
+	s.Eventually(func() bool { return !cached("ap") }, time.Second, 10*time.Millisecond, "the other instance dropped the changed prefix")
+	s.True(cached("am"), "unrelated prefixes stay cached")
+
+	// Swapping in a new index on one instance purges the others' caches
+	warm("ap")
+	load := func(terms ...string) func(*service.IndexBuilder) error {
+		return func(b *service.IndexBuilder) error {
+			for _, term := range terms {
+				b.Add(models.Suggestion{Term: term, Frequency: 10})
+			}
+			return nil
+		}
+	}
+	swapped, err := a.Rebuild("test", load("kiwi", "kale"))
+	s.Require().NoError(err)
+	s.Zero(bCache.Stats().Entries)
+
+	// Replicas swapping in the same suggestions share cached results
+	status, err := b.Rebuild("test", load("kale", "kiwi"))
+	s.Require().NoError(err)
+	s.Equal(swapped.Active.Generation, status.Active.Generation)
+
+	status, err = a.Rebuild("test", load("kiwi"))
+	s.Require().NoError(err)
+	s.Greater(status.Active.Generation, swapped.Active.Generation)
+	status, err = b.Rebuild("test", load("kale"))
+	s.Require().NoError(err)
+	s.NotEqual(a.IndexStatus().Active.Generation, status.Active.Generation, "different suggestions never share an id")
+}
+
+func (s *IntegrationTestSuite) TestInnerWordInvalidation() {
+	inst := s.newEmptyInstance(service.Config{CacheEnabled: true}, pipeline.Config{})
+	svc, cacheInstance := inst.service, inst.cache
+	s.Require().NoError(svc.AddSuggestion(models.Suggestion{Term: "New York Pizza", Frequency: 100, UpdatedAt: time.Now()}))
+	s.Require().NoError(svc.AddSuggestion(models.Suggestion{Term: "yorkshire tea", Frequency: 500, UpdatedAt: time.Now()}))
+
+	cached := func(query string) bool {
+		_, found := cacheInstance.Get(context.Background(), cacheKey(svc, "10:-:"+query))
+		return found
+	}
+	terms := func(query string) []string {
+		response, err := svc.GetSuggestions(context.Background(), models.AutocompleteRequest{Query: query, Limit: 5})
+		s.Require().NoError(err)
+		var terms []string
+		for _, suggestion := range response.Suggestions {
+			terms = append(terms, suggestion.Term)
+		}
+		return terms
+	}
+
+	s.Require().Equal([]string{"yorkshire tea", "New York Pizza"}, terms("york"))
+	s.Require().Eventually(func() bool { return cached("york") }, time.Second, 10*time.Millisecond)
+	s.Require().Equal([]string{"New York Pizza"}, terms("pi"))
+	s.Require().Eventually(func() bool { return cached("pi") }, time.Second, 10*time.Millisecond)
+	s.Require().Equal([]string{"New York Pizza"}, terms("york pi"))
+
+	s.Require().NoError(svc.UpdateFrequency("New York Pizza", 5000))
+	s.Eventually(func() bool { return !cached("york") }, time.Second, 10*time.Millisecond)
+	s.Equal([]string{"New York Pizza", "yorkshire tea"}, terms("york"))
+
+	_, err := svc.DeleteSuggestion("new york pizza")
+	s.Require().NoError(err)
+	s.Eventually(func() bool { return !cached("pi") }, time.Second, 10*time.Millisecond)
+	s.Empty(terms("pi"))
+	s.Empty(terms("york pi"), "inner-word matches for several words are never cached")
+}
+
+func (s *IntegrationTestSuite) TestCacheKeyScheme() {
+	inst := s.newInstance(service.Config{CacheEnabled: true, PersonalizedRec: true}, pipeline.Config{})
+	svc, cacheInstance := inst.service, inst.cache
+	for i := 0; i < 15; i++ {
+		suggestion := models.Suggestion{Term: fmt.Sprintf("apex %02d", i), Frequency: int64(100 + i), Category: "game", UpdatedAt: time.Now()}
+		if i%3 == 0 {
+			suggestion.Metadata = map[string]string{"locale": "fr-FR"}
+		}
+		svc.AddSuggestion(suggestion)
+	}
+
+	cached := func(key string) bool {
+		_, found := cacheInstance.Get(context.Background(), cacheKey(svc, key))
+		return found
+	}
+	search := func(req models.AutocompleteRequest) *models.AutocompleteResponse {
+		response, err := svc.GetSuggestions(context.Background(), req)
+		s.Require().NoError(err)
+		return response
+	}
+	terms := func(response *models.AutocompleteResponse) []string {
+		var terms []string
+		for _, suggestion := range response.Suggestions {
+			terms = append(terms, suggestion.Term)
+		}
+		return terms
+	}
+
+	s.Run("small limits don't cut larger ones short", func() {
+		small := search(models.AutocompleteRequest{Query: "ap", Limit: 2})
+		s.Len(small.Suggestions, 2)
+		s.Eventually(func() bool { return cached("10:-:ap") }, time.Second, 10*time.Millisecond)
+
+		large := search(models.AutocompleteRequest{Query: "ap", Limit: 20})
+		s.Equal("trie", large.Source)
+		s.Len(large.Suggestions, 18)
+
+		again := search(models.AutocompleteRequest{Query: "ap", Limit: 3})
+		s.Equal("cache", again.Source)
+		s.Equal(terms(large)[:3], terms(again))
+	})
+
+	s.Run("filters are cached apart", func() {
+		games := search(models.AutocompleteRequest{Query: "ap", Limit: 20, Category: "Game"})
+		s.Len(games.Suggestions, 15)
+		for _, suggestion := range games.Suggestions {
+			s.Equal("game", suggestion.Category)
+		}
+		s.Eventually(func() bool { return cached("50:game,:ap") }, time.Second, 10*time.Millisecond)
+
+		tech := search(models.AutocompleteRequest{Query: "ap", Limit: 20, Category: "tech"})
+		s.ElementsMatch([]string{"app", "application"}, terms(tech))
+
+		french := search(models.AutocompleteRequest{Query: "apex", Limit: 20, Locale: "fr_FR"})
+		s.Len(french.Suggestions, 15, "suggestions without a locale suit every locale")
+		english := search(models.AutocompleteRequest{Query: "apex", Limit: 20, Locale: "en"})
+		s.Len(english.Suggestions, 10)
+		for _, suggestion := range english.Suggestions {
+			s.Empty(suggestion.Metadata["locale"])
+		}
+	})
+
+	s.Run("cached candidates are ranked for each request", func() {
+		s.Require().Equal([]string{"app"}, terms(search(models.AutocompleteRequest{Query: "ap", Limit: 1})))
+
+		// Boosts gained after caching apply to every cached candidate
+		svc.RecordQuerySelection("ap", "apple", 1)
+		boosted := search(models.AutocompleteRequest{Query: "ap", Limit: 1})
+		s.Equal("cache", boosted.Source)
+		s.Equal([]string{"apple"}, terms(boosted))
+
+		anonymous := search(models.AutocompleteRequest{Query: "a", Limit: 5})
+		s.Require().NotEqual("amazon", anonymous.Suggestions[0].Term)
+		s.Eventually(func() bool { return cached("10:-:a") }, time.Second, 10*time.Millisecond)
+
+		svc.RecordSelection("user123", "", "amazon")
+		svc.RecordSelection("user123", "", "amazon")
+		svc.RecordSearch("user123", "", "amazon")
+
+		personal := search(models.AutocompleteRequest{Query: "a", Limit: 5, UserID: "user123"})
+		s.Equal("cache", personal.Source)
+		s.Equal("amazon", personal.Suggestions[0].Term, "the user's history ranks shared candidates")
+		s.Equal(terms(anonymous), terms(search(models.AutocompleteRequest{Query: "a", Limit: 5})))
+	})
+
+	s.Run("invalidation drops every bucket and filter", func() {
+		search(models.AutocompleteRequest{Query: "apex", Limit: 5, Category: "game"})
+		s.Require().Eventually(func() bool { return cached("10:game,:apex") }, time.Second, 10*time.Millisecond)
+
+		s.Require().NoError(svc.UpdateFrequency("apex 01", 5000))
+		for _, key := range []string{"10:game,:apex", "50:game,:ap", "10:-:ap", "50:-:ap", "10:-:a"} {
+			s.Eventually(func() bool { return !cached(key) }, time.Second, 10*time.Millisecond, key)
+		}
+	})
+}
+
+// cacheKey returns the key svc caches an entry under in its live index
+// generation
+func cacheKey(svc *service.AutocompleteService, entry string) string {
+	return fmt.Sprintf("%d:%s", svc.IndexStatus().Active.Generation, entry)
+}